@@ -49,6 +49,7 @@ func startRun(cmd *cobra.Command, args []string) {
 
 	// 2. 注册业务路由（核心：解耦路由定义与引擎实现）
 	engine.RegisterRoutes(router.RegisterBusinessRoutes)
+	router.ServeMetrics(svcCtx)
 
 	// 3. 启动服务器（阻塞，支持优雅关闭）
 	engine.Run()
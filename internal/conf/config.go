@@ -1,6 +1,7 @@
 package conf
 
 import (
+	"errors"
 	"log"
 	"time"
 
@@ -11,20 +12,204 @@ import (
 const configFileName = "config"
 
 type DNSConfig struct {
-	Port int    `mapstructure:"port"`
-	Host string `mapstructure:"host"`
+	Port int             `mapstructure:"port"`
+	Host string          `mapstructure:"host"`
+	TLS  ServerTLSConfig `mapstructure:"tls"` // DoT/DoQ/DoH 证书
+	DoT  DoTConfig       `mapstructure:"dot"` // DNS-over-TLS 监听
+	DoH  DoHConfig       `mapstructure:"doh"` // DNS-over-HTTPS 服务
+	DoQ  DoQConfig       `mapstructure:"doq"` // DNS-over-QUIC 监听
+	ACL  ACLConfig       `mapstructure:"acl"` // 查询访问控制
+
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"` // 客户端查询限速与应答限速（RRL）
+
+	ViewECS bool `mapstructure:"view_ecs"` // 选择视图时优先使用EDNS Client Subnet中的地址（仅适用于可信的转发方）
+}
+
+// ACLConfig 查询访问控制（网段为CIDR或单个IP；列表为空表示不限制）
+type ACLConfig struct {
+	AllowQuery     []string `mapstructure:"allow_query"`     // 允许查询本地解析数据的客户端网段
+	AllowRecursion []string `mapstructure:"allow_recursion"` // 允许递归（转发上游）的客户端网段
+	Deny           []string `mapstructure:"deny"`            // 拒绝的客户端网段，优先于允许列表
+	Action         string   `mapstructure:"action"`          // 拒绝方式：refuse（返回REFUSED，默认）/drop（UDP查询静默丢弃）
+}
+
+// RateLimitConfig 按客户端网段的查询限速（令牌桶）
+type RateLimitConfig struct {
+	Enabled    bool      `mapstructure:"enabled"`     // 是否启用查询限速
+	QPS        float64   `mapstructure:"qps"`         // 每个客户端网段每秒允许的查询数
+	Burst      int       `mapstructure:"burst"`       // 允许的突发查询数
+	IPv4Prefix int       `mapstructure:"ipv4_prefix"` // IPv4客户端按此前缀长度合并计数
+	IPv6Prefix int       `mapstructure:"ipv6_prefix"` // IPv6客户端按此前缀长度合并计数
+	Exempt     []string  `mapstructure:"exempt"`      // 不限速的客户端网段（同时豁免RRL）
+	RRL        RRLConfig `mapstructure:"rrl"`         // 应答限速
+}
+
+// RRLConfig BIND风格的应答限速（Response Rate Limiting），只作用于UDP应答
+type RRLConfig struct {
+	Enabled            bool          `mapstructure:"enabled"`              // 是否启用
+	ResponsesPerSecond int           `mapstructure:"responses_per_second"` // 同一客户端网段每秒允许的相同应答数
+	NXDomainsPerSecond int           `mapstructure:"nxdomains_per_second"` // NXDOMAIN应答的限速，0表示同 responses_per_second
+	ErrorsPerSecond    int           `mapstructure:"errors_per_second"`    // 错误应答（SERVFAIL/REFUSED等）的限速，0表示同 responses_per_second
+	Window             time.Duration `mapstructure:"window"`               // 统计窗口：超限后最长持续限速的时间
+	Slip               int           `mapstructure:"slip"`                 // 每slip个被限速的应答中返回一个截断应答（TC位），0表示全部丢弃
+	IPv4Prefix         int           `mapstructure:"ipv4_prefix"`          // IPv4客户端按此前缀长度合并计数
+	IPv6Prefix         int           `mapstructure:"ipv6_prefix"`          // IPv6客户端按此前缀长度合并计数
+}
+
+// ServerTLSConfig DoT/DoQ/DoH 使用的证书文件（文件变化后自动重新加载）
+type ServerTLSConfig struct {
+	CertFile string `mapstructure:"cert_file"` // 证书文件（PEM，可包含证书链）
+	KeyFile  string `mapstructure:"key_file"`  // 私钥文件（PEM）
+}
+
+// DoTConfig DNS-over-TLS 监听配置
+type DoTConfig struct {
+	Enabled bool `mapstructure:"enabled"` // 是否启用
+	Port    int  `mapstructure:"port"`    // 监听端口，默认853
+}
+
+// DoQConfig DNS-over-QUIC 监听配置（RFC 9250）
+type DoQConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`      // 是否启用
+	Port        int           `mapstructure:"port"`         // 监听端口（UDP），默认853
+	MaxStreams  int           `mapstructure:"max_streams"`  // 每个连接允许的并发查询流数量
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"` // 连接空闲超时
+}
+
+// DoHConfig DNS-over-HTTPS 服务配置
+type DoHConfig struct {
+	Enabled bool   `mapstructure:"enabled"` // 是否启用
+	Port    int    `mapstructure:"port"`    // 独立HTTPS监听端口，0表示挂载到管理接口（gin）上
+	Path    string `mapstructure:"path"`    // 请求路径，默认 /dns-query
+}
+
+// CacheConfig 转发响应缓存配置
+type CacheConfig struct {
+	Enabled     bool `mapstructure:"enabled"`      // 是否启用缓存
+	Size        int  `mapstructure:"size"`         // 最大缓存条目数
+	MinTTL      int  `mapstructure:"min_ttl"`      // 最小缓存时间（秒）
+	MaxTTL      int  `mapstructure:"max_ttl"`      // 最大缓存时间（秒），0表示不限制
+	NegativeTTL int  `mapstructure:"negative_ttl"` // 否定应答缺少SOA时的缓存时间（秒）
+}
+
+// UpstreamConfig 单个上游DNS服务器配置
+type UpstreamConfig struct {
+	Address string        `mapstructure:"address"` // 上游地址：host:port、tcp://host:port、tls://host:port#servername、https://host/dns-query
+	Timeout time.Duration `mapstructure:"timeout"` // 单次查询超时，0表示使用 forward.timeout
+}
+
+// ForwardConfig 上游转发策略配置
+type ForwardConfig struct {
+	Strategy         string           `mapstructure:"strategy"`          // 上游选择策略：sequential/parallel/round_robin/fastest
+	Timeout          time.Duration    `mapstructure:"timeout"`           // 默认单次查询超时
+	BreakerThreshold int              `mapstructure:"breaker_threshold"` // 连续失败多少次后暂时跳过该上游，0表示不熔断
+	BreakerCooldown  time.Duration    `mapstructure:"breaker_cooldown"`  // 熔断后跳过的时长
+	Upstreams        []UpstreamConfig `mapstructure:"upstreams"`         // 上游列表，为空时使用 upstream
+	CAFile           string           `mapstructure:"ca_file"`           // 校验 tls:// 与 https:// 上游证书的CA文件（PEM），为空时使用系统根证书
+	Bootstrap        []string         `mapstructure:"bootstrap"`         // 解析上游地址中主机名的引导DNS（ip:port），为空时使用系统解析器
+}
+
+// ViewConfig 解析视图（split-horizon）：按客户端地址选择不同的解析记录
+type ViewConfig struct {
+	Name    string   `mapstructure:"name"`    // 视图名称，域名与记录通过 view 字段归属到视图
+	Clients []string `mapstructure:"clients"` // 客户端网段（CIDR或单个IP），多个视图都匹配时最长前缀优先
+}
+
+// BlocklistConfig 域名拦截列表配置
+type BlocklistConfig struct {
+	Enabled         bool              `mapstructure:"enabled"`          // 是否启用
+	Mode            string            `mapstructure:"mode"`             // 拦截应答：nxdomain（默认）/zero_ip（0.0.0.0与::）/sinkhole
+	SinkholeIPv4    string            `mapstructure:"sinkhole_ipv4"`    // sinkhole 模式A查询应答的地址
+	SinkholeIPv6    string            `mapstructure:"sinkhole_ipv6"`    // sinkhole 模式AAAA查询应答的地址，为空时返回NODATA
+	TTL             int               `mapstructure:"ttl"`              // 拦截应答的TTL（秒）
+	RefreshInterval time.Duration     `mapstructure:"refresh_interval"` // 定时重新加载列表的间隔，0表示只在启动与配置变更时加载
+	Sources         []BlocklistSource `mapstructure:"sources"`          // 列表来源
+	Allowlist       []string          `mapstructure:"allowlist"`        // 放行的域名（包含其子域名），优先于拦截列表
+}
+
+// BlocklistSource 拦截列表来源（url与path二选一）
+type BlocklistSource struct {
+	Name   string `mapstructure:"name"`   // 来源名称，默认使用url或path
+	URL    string `mapstructure:"url"`    // 远程列表地址（http/https）
+	Path   string `mapstructure:"path"`   // 本地列表文件
+	Format string `mapstructure:"format"` // 列表格式：auto（默认，逐行识别）/hosts/plain/adblock
+}
+
+// RPZConfig 响应策略区域（RPZ）配置
+type RPZConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`          // 是否启用
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"` // 定时重新加载策略区域的间隔，0表示只在启动与配置变更时加载
+	Zones           []RPZZone     `mapstructure:"zones"`            // 策略区域，按配置顺序匹配，先命中的区域优先
+}
+
+// RPZZone 单个策略区域（path与primary二选一）
+type RPZZone struct {
+	Name    string `mapstructure:"name"`    // 区域名称（如 rpz.example.com），触发规则按相对该名称的所有者名称解析
+	Path    string `mapstructure:"path"`    // 本地区域文件
+	Primary string `mapstructure:"primary"` // 通过AXFR拉取区域的主服务器（ip:port）
+}
+
+// QueryLogConfig 查询日志配置
+type QueryLogConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`   // 是否记录查询日志
+	Dir      string        `mapstructure:"dir"`       // 日志目录
+	MaxSize  int           `mapstructure:"max_size"`  // 单个日志文件的最大大小（MB），超出后轮转
+	MaxAge   time.Duration `mapstructure:"max_age"`   // 轮转后的日志文件保留时长，0表示不按时间清理
+	MaxFiles int           `mapstructure:"max_files"` // 最多保留的轮转文件数，0表示不限制
+}
+
+// DnstapConfig dnstap 输出配置
+type DnstapConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`    // 是否输出 dnstap
+	Address   string        `mapstructure:"address"`    // 输出地址：unix:///path/to.sock、tcp://host:port 或 file:///path/to/file
+	Identity  string        `mapstructure:"identity"`   // 服务器标识，为空时使用主机名
+	Version   string        `mapstructure:"version"`    // 服务器版本标识
+	QueueSize int           `mapstructure:"queue_size"` // 待发送队列长度，接收方跟不上时丢弃
+	MaxAge    time.Duration `mapstructure:"max_age"`    // 文件输出：重新打开时保留的历史文件的保留时长，0表示不按时间清理
+	MaxFiles  int           `mapstructure:"max_files"`  // 文件输出：最多保留的历史文件数，0表示不限制
+}
+
+// TSIGKey TSIG 密钥（动态更新等请求的签名认证）
+type TSIGKey struct {
+	Name      string `mapstructure:"name"`      // 密钥名称，与客户端使用的密钥名一致（如 dhcp-key）
+	Algorithm string `mapstructure:"algorithm"` // 算法：hmac-sha256（默认）/hmac-sha1/hmac-sha224/hmac-sha384/hmac-sha512
+	Secret    string `mapstructure:"secret"`    // Base64 编码的密钥
+}
+
+// UpdateConfig 动态更新（RFC 2136）配置，更新请求必须使用允许的TSIG密钥签名
+type UpdateConfig struct {
+	Enabled bool         `mapstructure:"enabled"` // 是否接受动态更新
+	Zones   []UpdateZone `mapstructure:"zones"`   // 允许动态更新的区域，未列出的区域拒绝更新
+}
+
+// UpdateZone 允许动态更新的区域及可使用的密钥
+type UpdateZone struct {
+	Name string   `mapstructure:"name"` // 区域名称（须为已配置的域名）
+	Keys []string `mapstructure:"keys"` // 允许的TSIG密钥名称
 }
 
-type Record struct {
-	Name  string `mapstructure:"name"`
-	Type  string `mapstructure:"type"`
-	Value string `mapstructure:"value"`
-	TTL   int    `mapstructure:"ttl"`
+// TransferConfig 区域传送（AXFR/IXFR）配置，只通过TCP提供
+type TransferConfig struct {
+	Enabled bool           `mapstructure:"enabled"` // 是否允许区域传送
+	Zones   []TransferZone `mapstructure:"zones"`   // 允许传送的区域，未列出的区域拒绝传送
 }
 
-type Domain struct {
-	Name    string   `mapstructure:"name"`
-	Records []Record `mapstructure:"records"`
+// TransferZone 允许传送的区域及访问控制，allow 与 keys 至少配置一项
+type TransferZone struct {
+	Name   string   `mapstructure:"name"`   // 区域名称（须为已配置的域名）
+	Allow  []string `mapstructure:"allow"`  // 允许传送的客户端网段，为空时不限制来源
+	Keys   []string `mapstructure:"keys"`   // 传送请求须使用的TSIG密钥名称，为空时不要求签名
+	Notify []string `mapstructure:"notify"` // 区域变更后发送NOTIFY的从服务器地址（host 或 host:port）
+}
+
+// MetricsConfig Prometheus 指标配置
+type MetricsConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`      // 是否提供指标接口
+	Path        string `mapstructure:"path"`         // 指标路径
+	Listen      string `mapstructure:"listen"`       // 独立监听地址（如 :9153），为空时挂载到管理接口（gin）上
+	Username    string `mapstructure:"username"`     // 基本认证用户名，须与 password 同时配置
+	Password    string `mapstructure:"password"`     // 基本认证密码
+	BearerToken string `mapstructure:"bearer_token"` // Bearer 令牌，配置后也可通过 Authorization: Bearer <token> 访问
 }
 
 type JWTConfig struct {
@@ -49,15 +234,26 @@ type GinConfig struct {
 	WriteTimeout       time.Duration `mapstructure:"write_timeout"`        // 写入超时
 	IdleTimeout        time.Duration `mapstructure:"idle_timeout"`         // 空闲超时
 	MaxMultipartMemory int64         `mapstructure:"max_multipart_memory"` // 最大上传内存
+	TrustedProxies     []string      `mapstructure:"trusted_proxies"`      // 可信反向代理（IP或CIDR），仅信任其转发头中的客户端地址
 }
 
 type Config struct {
-	Server   DNSConfig `mapstructure:"server"`
-	Upstream []string  `mapstructure:"upstream"`
-	Domains  []Domain  `mapstructure:"domains"`
-	JWT      JWTConfig `mapstructure:"jwt"`
-	Gin      GinConfig `mapstructure:"gin"`
-	Login    LoginUser `mapstructure:"login"`
+	Server    DNSConfig       `mapstructure:"server"`
+	Upstream  []string        `mapstructure:"upstream"`
+	Forward   ForwardConfig   `mapstructure:"forward"`
+	Cache     CacheConfig     `mapstructure:"cache"`
+	Views     []ViewConfig    `mapstructure:"views"`
+	Blocklist BlocklistConfig `mapstructure:"blocklist"`
+	RPZ       RPZConfig       `mapstructure:"rpz"`
+	QueryLog  QueryLogConfig  `mapstructure:"query_log"`
+	Dnstap    DnstapConfig    `mapstructure:"dnstap"`
+	TSIGKeys  []TSIGKey       `mapstructure:"tsig_keys"`
+	Update    UpdateConfig    `mapstructure:"dynamic_update"`
+	Transfer  TransferConfig  `mapstructure:"zone_transfer"`
+	Metrics   MetricsConfig   `mapstructure:"metrics"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	Gin       GinConfig       `mapstructure:"gin"`
+	Login     LoginUser       `mapstructure:"login"`
 }
 
 // GetUpstream 获取上游DNS服务器列表（暂时简化）
@@ -68,17 +264,85 @@ func (c *Config) GetUpstream() []string {
 	return upstreamCopy
 }
 
-// GetDomains 获取域名配置列表（暂时简化）
-func (c *Config) GetDomains() []Domain {
-	// 返回副本，避免外部修改
-	domainsCopy := make([]Domain, len(c.Domains))
-	for i, domain := range c.Domains {
-		domainsCopy[i] = Domain{
-			Name:    domain.Name,
-			Records: append([]Record{}, domain.Records...),
+// GetForward 获取转发策略配置，未单独配置上游列表时使用 upstream
+func (c *Config) GetForward() ForwardConfig {
+	forward := c.Forward
+	if len(forward.Upstreams) == 0 {
+		for _, addr := range c.Upstream {
+			forward.Upstreams = append(forward.Upstreams, UpstreamConfig{Address: addr})
 		}
+	} else {
+		forward.Upstreams = append([]UpstreamConfig(nil), forward.Upstreams...)
 	}
-	return domainsCopy
+	return forward
+}
+
+// GetViews 获取解析视图配置
+func (c *Config) GetViews() []ViewConfig {
+	views := make([]ViewConfig, len(c.Views))
+	for i, view := range c.Views {
+		view.Clients = append([]string(nil), view.Clients...)
+		views[i] = view
+	}
+	return views
+}
+
+// GetBlocklist 获取拦截列表配置
+func (c *Config) GetBlocklist() BlocklistConfig {
+	blocklist := c.Blocklist
+	blocklist.Sources = append([]BlocklistSource(nil), blocklist.Sources...)
+	blocklist.Allowlist = append([]string(nil), blocklist.Allowlist...)
+	return blocklist
+}
+
+// GetRPZ 获取响应策略区域配置
+func (c *Config) GetRPZ() RPZConfig {
+	rpz := c.RPZ
+	rpz.Zones = append([]RPZZone(nil), rpz.Zones...)
+	return rpz
+}
+
+// GetQueryLog 获取查询日志配置
+func (c *Config) GetQueryLog() QueryLogConfig {
+	return c.QueryLog
+}
+
+// GetDnstap 获取 dnstap 输出配置
+func (c *Config) GetDnstap() DnstapConfig {
+	return c.Dnstap
+}
+
+// GetTSIGKeys 获取TSIG密钥列表
+func (c *Config) GetTSIGKeys() []TSIGKey {
+	return append([]TSIGKey(nil), c.TSIGKeys...)
+}
+
+// GetUpdate 获取动态更新配置
+func (c *Config) GetUpdate() UpdateConfig {
+	update := c.Update
+	update.Zones = append([]UpdateZone(nil), update.Zones...)
+	return update
+}
+
+// GetTransfer 获取区域传送配置
+func (c *Config) GetTransfer() TransferConfig {
+	transfer := c.Transfer
+	transfer.Zones = append([]TransferZone(nil), transfer.Zones...)
+	return transfer
+}
+
+// GetMetrics 获取指标配置
+func (c *Config) GetMetrics() MetricsConfig {
+	return c.Metrics
+}
+
+// Validate 校验无法在使用处安全回退的配置组合
+func (c *Config) Validate() error {
+	// 只配置用户名或密码时基本认证不生效，未配置令牌时指标接口将不做任何校验
+	if m := c.Metrics; (m.Username == "") != (m.Password == "") {
+		return errors.New("metrics.username 与 metrics.password 须同时配置")
+	}
+	return nil
 }
 
 // GetServer 获取服务器配置（暂时简化）
@@ -95,6 +359,7 @@ func New() (*Config, *viper.Viper, string) {
 	v.AddConfigPath(".")
 	v.AddConfigPath("/etc/dnsm/")
 	v.AddConfigPath("./conf")
+	setDefaults(v)
 
 	// 创建配置变量
 	var config Config
@@ -115,7 +380,9 @@ func New() (*Config, *viper.Viper, string) {
 					"223.5.5.5:53",
 					"223.6.6.6:53",
 				},
-				Domains: []Domain{},
+			}
+			if err := v.Unmarshal(&config); err != nil {
+				log.Fatalf("Unable to decode default config: %v", err)
 			}
 			// 当配置文件不存在时，使用默认的配置文件路径
 			configPath := "./config.yaml"
@@ -128,6 +395,9 @@ func New() (*Config, *viper.Viper, string) {
 		if err := v.Unmarshal(&config); err != nil {
 			log.Fatalf("Unable to decode into struct: %v", err)
 		}
+		if err := config.Validate(); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
 	}
 	configPath := v.ConfigFileUsed()
 	log.Println("Initial configuration loaded successfully.")
@@ -135,8 +405,49 @@ func New() (*Config, *viper.Viper, string) {
 	return &config, v, configPath
 }
 
+// setDefaults 设置配置项默认值（配置文件中缺省的项使用此处的值）
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.acl.action", "refuse")
+	v.SetDefault("server.rate_limit.qps", 100)
+	v.SetDefault("server.rate_limit.burst", 200)
+	v.SetDefault("server.rate_limit.ipv4_prefix", 32)
+	v.SetDefault("server.rate_limit.ipv6_prefix", 64)
+	v.SetDefault("server.rate_limit.rrl.responses_per_second", 10)
+	v.SetDefault("server.rate_limit.rrl.window", "15s")
+	v.SetDefault("server.rate_limit.rrl.slip", 2)
+	v.SetDefault("server.rate_limit.rrl.ipv4_prefix", 24)
+	v.SetDefault("server.rate_limit.rrl.ipv6_prefix", 56)
+	v.SetDefault("server.dot.port", 853)
+	v.SetDefault("server.doh.path", "/dns-query")
+	v.SetDefault("server.doq.port", 853)
+	v.SetDefault("server.doq.max_streams", 100)
+	v.SetDefault("server.doq.idle_timeout", "30s")
+	v.SetDefault("forward.strategy", "sequential")
+	v.SetDefault("forward.timeout", "3s")
+	v.SetDefault("forward.breaker_threshold", 3)
+	v.SetDefault("forward.breaker_cooldown", "30s")
+	v.SetDefault("blocklist.mode", "nxdomain")
+	v.SetDefault("blocklist.ttl", 60)
+	v.SetDefault("blocklist.refresh_interval", "24h")
+	v.SetDefault("rpz.refresh_interval", "1h")
+	v.SetDefault("query_log.dir", "querylog")
+	v.SetDefault("query_log.max_size", 50)
+	v.SetDefault("query_log.max_age", "168h")
+	v.SetDefault("dnstap.version", "dnsm")
+	v.SetDefault("dnstap.queue_size", 10000)
+	v.SetDefault("dnstap.max_age", "168h")
+	v.SetDefault("metrics.enabled", false)
+	v.SetDefault("metrics.path", "/metrics")
+	v.SetDefault("cache.enabled", true)
+	v.SetDefault("cache.size", 10000)
+	v.SetDefault("cache.min_ttl", 0)
+	v.SetDefault("cache.max_ttl", 86400)
+	v.SetDefault("cache.negative_ttl", 60)
+}
+
 // WatchConfigChanges 启动一个 goroutine 来监听配置文件变化并自动重新加载
-func (c *Config) WatchConfigChanges(v *viper.Viper) {
+// onReload 在每次重新加载后依次调用，加载失败时参数为失败原因（此时保持旧配置）
+func (c *Config) WatchConfigChanges(v *viper.Viper, onReload ...func(err error)) {
 	// 注意：此方法现在使用的是全局viper实例，在实际使用中应该传入正确的viper实例
 	// 为了兼容性暂时保留此实现
 	if v.ConfigFileUsed() != "" {
@@ -146,12 +457,24 @@ func (c *Config) WatchConfigChanges(v *viper.Viper) {
 		v.OnConfigChange(func(e fsnotify.Event) {
 			log.Printf("Config file changed: %s Op: %s", e.Name, e.Op.String())
 
-			// 尝试重新加载配置到临时变量
-			if err := v.Unmarshal(&c); err != nil {
-				log.Printf("Error unmarshalling updated config: %v. Keeping old config.", err)
+			// 尝试重新加载配置到临时变量，校验通过后再替换
+			var next Config
+			err := v.Unmarshal(&next)
+			if err == nil {
+				err = next.Validate()
+			}
+			if err != nil {
+				log.Printf("Error loading updated config: %v. Keeping old config.", err)
+				for _, fn := range onReload {
+					fn(err)
+				}
 				return // 如果新配置有错误，保持旧配置不变
 			}
+			*c = next
 			log.Println("Configuration reloaded successfully and applied.")
+			for _, fn := range onReload {
+				fn(nil)
+			}
 		})
 	} else {
 		log.Println("No config file to watch, skipping config watching.")
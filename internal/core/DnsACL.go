@@ -0,0 +1,200 @@
+package core
+
+import (
+	"cmp"
+	"dnsm/internal/conf"
+	"log"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// 访问控制的拒绝方式
+const (
+	ACLActionRefuse = "refuse" // 返回REFUSED（默认）
+	ACLActionDrop   = "drop"   // UDP查询静默丢弃，其他传输方式仍返回REFUSED
+)
+
+// 查询被拒绝的原因
+const (
+	RefusedDeny      = "deny"      // 命中拒绝列表
+	RefusedQuery     = "query"     // 不在 allow_query 中
+	RefusedRecursion = "recursion" // 不在 allow_recursion 中（查询需要转发上游）
+)
+
+// maxRefusedClients 拒绝统计最多保留的客户端数量，超出时淘汰最久未被拒绝的客户端
+const maxRefusedClients = 10000
+
+// -------------------------- 基础数据结构 --------------------------
+// RefusedStats 单个客户端被拒绝的查询统计
+type RefusedStats struct {
+	Client     string    `json:"client"`      // 客户端地址
+	Count      uint64    `json:"count"`       // 被拒绝的查询数
+	Deny       uint64    `json:"deny"`        // 其中命中拒绝列表的次数
+	Query      uint64    `json:"query"`       // 其中不允许查询的次数
+	Recursion  uint64    `json:"recursion"`   // 其中不允许递归的次数
+	LastName   string    `json:"last_name"`   // 最近一次被拒绝的查询名
+	LastRefuse time.Time `json:"last_refuse"` // 最近一次被拒绝的时间
+}
+
+// aclTable 编译后的访问控制规则（配置重载时整体替换）
+type aclTable struct {
+	allowQuery     []netip.Prefix
+	allowRecursion []netip.Prefix
+	deny           []netip.Prefix
+	drop           bool
+}
+
+// refusedCounter 按客户端统计被拒绝的查询
+type refusedCounter struct {
+	mu      sync.Mutex
+	clients *lruTable[netip.Addr, *RefusedStats]
+}
+
+// -------------------------- 规则构建与匹配 --------------------------
+// buildACLTable 根据配置构建访问控制规则，无效的网段记录日志后跳过
+func buildACLTable(cfg conf.ACLConfig) *aclTable {
+	t := &aclTable{
+		allowQuery:     parseACLPrefixes("allow_query", cfg.AllowQuery),
+		allowRecursion: parseACLPrefixes("allow_recursion", cfg.AllowRecursion),
+		deny:           parseACLPrefixes("deny", cfg.Deny),
+	}
+	switch cfg.Action {
+	case "", ACLActionRefuse:
+	case ACLActionDrop:
+		t.drop = true
+	default:
+		log.Printf("Unknown ACL action %q, falling back to %s", cfg.Action, ACLActionRefuse)
+	}
+	return t
+}
+
+// parseACLPrefixes 解析访问控制列表中的网段
+func parseACLPrefixes(list string, clients []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(clients))
+	for _, client := range clients {
+		prefix, err := parseClientPrefix(client)
+		if err != nil {
+			log.Printf("Skipping invalid client network %s in acl.%s: %v", client, list, err)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// check 判断客户端能否查询本地解析数据，不允许时返回拒绝原因
+func (t *aclTable) check(addr netip.Addr) (string, bool) {
+	if containsAddr(t.deny, addr) {
+		return RefusedDeny, false
+	}
+	if len(t.allowQuery) > 0 && !containsAddr(t.allowQuery, addr) {
+		return RefusedQuery, false
+	}
+	return "", true
+}
+
+// recursion 判断客户端能否递归查询（转发上游）
+func (t *aclTable) recursion(addr netip.Addr) bool {
+	return len(t.allowRecursion) == 0 || containsAddr(t.allowRecursion, addr)
+}
+
+// containsAddr 判断地址是否位于任一网段内
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// -------------------------- 拒绝应答 --------------------------
+// refuse 拒绝查询：记录统计后返回REFUSED，配置为drop时UDP查询不作应答；返回写回的应答，未应答时为nil
+func (e *DNSEngine) refuse(w dns.ResponseWriter, req *dns.Msg, client netip.Addr, reason string) *dns.Msg {
+	name := ""
+	if len(req.Question) > 0 {
+		name = req.Question[0].Name
+	}
+	e.refused.add(client, name, reason)
+
+	if e.acl.Load().drop && isUDP(w) {
+		return nil
+	}
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeRefused)
+	e.writeMsg(w, req, m)
+	return m
+}
+
+// ReloadACL 配置重载后重建访问控制规则
+func (e *DNSEngine) ReloadACL() {
+	e.acl.Store(buildACLTable(e.conf.GetServer().ACL))
+}
+
+// RefusedStats 返回各客户端被拒绝的查询统计（按拒绝次数降序）
+func (e *DNSEngine) RefusedStats() []RefusedStats {
+	return e.refused.stats()
+}
+
+// ResetRefusedStats 清空拒绝统计
+func (e *DNSEngine) ResetRefusedStats() {
+	e.refused.reset()
+}
+
+// -------------------------- 拒绝统计 --------------------------
+func newRefusedCounter() *refusedCounter {
+	return &refusedCounter{clients: newLRUTable[netip.Addr, *RefusedStats](maxRefusedClients)}
+}
+
+// add 记录一次被拒绝的查询
+func (c *refusedCounter) add(client netip.Addr, name, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, exists := c.clients.get(client)
+	if !exists {
+		s = &RefusedStats{Client: client.String()}
+		c.clients.add(client, s)
+	}
+	s.Count++
+	switch reason {
+	case RefusedDeny:
+		s.Deny++
+	case RefusedQuery:
+		s.Query++
+	case RefusedRecursion:
+		s.Recursion++
+	}
+	s.LastName = name
+	s.LastRefuse = time.Now()
+}
+
+// stats 返回统计快照（按拒绝次数降序）
+func (c *refusedCounter) stats() []RefusedStats {
+	c.mu.Lock()
+	stats := make([]RefusedStats, 0, c.clients.len())
+	for _, s := range c.clients.values() {
+		stats = append(stats, *s)
+	}
+	c.mu.Unlock()
+
+	slices.SortFunc(stats, func(a, b RefusedStats) int {
+		if n := cmp.Compare(b.Count, a.Count); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Client, b.Client)
+	})
+	return stats
+}
+
+// reset 清空统计
+func (c *refusedCounter) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clients = newLRUTable[netip.Addr, *RefusedStats](maxRefusedClients)
+}
@@ -0,0 +1,564 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"dnsm/internal/conf"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// 拦截应答方式
+const (
+	BlockModeNXDomain = "nxdomain" // 返回NXDOMAIN（默认）
+	BlockModeZeroIP   = "zero_ip"  // A查询返回0.0.0.0，AAAA查询返回::
+	BlockModeSinkhole = "sinkhole" // 返回配置的sinkhole地址
+)
+
+// 拦截列表格式
+const (
+	BlocklistFormatAuto    = "auto"    // 逐行识别（默认）
+	BlocklistFormatHosts   = "hosts"   // hosts文件：IP 名称...
+	BlocklistFormatPlain   = "plain"   // 每行一个域名
+	BlocklistFormatAdblock = "adblock" // ||example.com^ 与 @@||example.com^
+)
+
+const (
+	blocklistFetchTimeout = 60 * time.Second
+	maxBlocklistSize      = 64 << 20 // 单个列表最大字节数
+	allowlistSource       = "allowlist"
+)
+
+// 列表条目类型
+const (
+	blockExact  = iota // 只拦截该名称（hosts/plain 格式）
+	blockSuffix        // 拦截该名称及其子域名（adblock ||example.com^）
+	allowSuffix        // 放行该名称及其子域名（adblock @@||example.com^）
+)
+
+// hostsIgnored hosts文件中不作为拦截条目的常见名称
+var hostsIgnored = map[string]bool{
+	"localhost.": true, "localhost.localdomain.": true, "local.": true, "broadcasthost.": true,
+	"ip6-localhost.": true, "ip6-loopback.": true, "ip6-localnet.": true, "ip6-mcastprefix.": true,
+	"ip6-allnodes.": true, "ip6-allrouters.": true, "ip6-allhosts.": true, "0.0.0.0.": true,
+}
+
+// -------------------------- 基础数据结构 --------------------------
+// BlocklistSourceStatus 拦截列表来源的加载状态
+type BlocklistSourceStatus struct {
+	Name       string    `json:"name"`                 // 来源名称
+	Location   string    `json:"location"`             // url 或 path
+	Format     string    `json:"format"`               // 列表格式
+	Entries    int       `json:"entries"`              // 有效条目数（拦截与放行）
+	Blocked    uint64    `json:"blocked"`              // 因该来源被拦截的查询数
+	LastLoaded time.Time `json:"last_loaded"`          // 最近一次成功加载的时间
+	LastError  string    `json:"last_error,omitempty"` // 最近一次加载失败的原因（失败时保留上次成功加载的条目）
+}
+
+// BlockCheck 名称的拦截检查结果
+type BlockCheck struct {
+	Name    string `json:"name"`             // 查询名称
+	Blocked bool   `json:"blocked"`          // 是否被拦截
+	Allowed bool   `json:"allowed"`          // 是否命中放行规则
+	Rule    string `json:"rule,omitempty"`   // 命中的规则名称
+	Source  string `json:"source,omitempty"` // 规则来源
+}
+
+// blockEntries 单个来源解析出的条目
+type blockEntries struct {
+	exact  []string
+	suffix []string
+	allow  []string
+}
+
+// blockSource 拦截列表来源及其最近一次加载结果
+type blockSource struct {
+	cfg     conf.BlocklistSource
+	status  BlocklistSourceStatus
+	entries *blockEntries
+	hits    *atomic.Uint64 // 命中次数（刷新时按来源位置沿用）
+}
+
+// blockMatcher 编译后的只读匹配表（每次刷新整体重建并通过原子指针发布）
+type blockMatcher struct {
+	exact   map[string]int // 规范化名称 -> 来源下标
+	suffix  map[string]int
+	allow   map[string]int // -1 表示配置中的 allowlist
+	sources []*blockSource
+}
+
+// blockSettings 拦截应答参数
+type blockSettings struct {
+	enabled bool
+	mode    string
+	ttl     uint32
+	ipv4    net.IP // 为nil时A查询返回NODATA
+	ipv6    net.IP // 为nil时AAAA查询返回NODATA
+}
+
+// Blocklist 域名拦截列表：加载 hosts/plain/adblock 格式的本地或远程列表，定时刷新
+type Blocklist struct {
+	settings atomic.Pointer[blockSettings]
+	matcher  atomic.Pointer[blockMatcher] // 未启用或尚未加载时为nil
+	client   *http.Client
+	reload   chan struct{} // 配置变更后通知刷新循环立即刷新
+
+	mu        sync.Mutex // 保护 cfg 与 sources
+	cfg       conf.BlocklistConfig
+	sources   []*blockSource
+	refreshMu sync.Mutex // 串行化刷新
+}
+
+// NewBlocklist 创建拦截列表，列表在 Run 启动后加载
+func NewBlocklist(cfg conf.BlocklistConfig) *Blocklist {
+	b := &Blocklist{
+		client: &http.Client{Timeout: blocklistFetchTimeout},
+		reload: make(chan struct{}, 1),
+		cfg:    cfg,
+	}
+	b.settings.Store(newBlockSettings(cfg))
+	return b
+}
+
+// newBlockSettings 根据配置生成拦截应答参数
+func newBlockSettings(cfg conf.BlocklistConfig) *blockSettings {
+	s := &blockSettings{enabled: cfg.Enabled, mode: cfg.Mode, ttl: uint32(max(cfg.TTL, 0))}
+	switch cfg.Mode {
+	case "", BlockModeNXDomain:
+		s.mode = BlockModeNXDomain
+	case BlockModeZeroIP:
+		s.ipv4, s.ipv6 = net.IPv4zero, net.IPv6zero
+	case BlockModeSinkhole:
+		if s.ipv4 = net.ParseIP(cfg.SinkholeIPv4).To4(); s.ipv4 == nil {
+			log.Printf("Invalid blocklist sinkhole_ipv4 %q, answering 0.0.0.0", cfg.SinkholeIPv4)
+			s.ipv4 = net.IPv4zero
+		}
+		if cfg.SinkholeIPv6 != "" {
+			if s.ipv6 = net.ParseIP(cfg.SinkholeIPv6); s.ipv6 == nil {
+				log.Printf("Invalid blocklist sinkhole_ipv6 %q, answering NODATA for AAAA", cfg.SinkholeIPv6)
+			}
+		}
+	default:
+		log.Printf("Unknown blocklist mode %q, falling back to %s", cfg.Mode, BlockModeNXDomain)
+		s.mode = BlockModeNXDomain
+	}
+	return s
+}
+
+// -------------------------- 生命周期 --------------------------
+// Run 加载列表并按 refresh_interval 定时刷新，直到ctx结束；配置变更时立即刷新
+func (b *Blocklist) Run(ctx context.Context) {
+	runRefreshLoop(ctx, b.reload, func() time.Duration {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.cfg.RefreshInterval
+	}, func() {
+		if b.settings.Load().enabled {
+			_ = b.Refresh()
+		}
+	})
+}
+
+// runRefreshLoop 立即执行一次refresh，之后每隔interval（每轮重新读取，0表示不定时）或收到reload通知时再次执行，直到ctx结束
+func runRefreshLoop(ctx context.Context, reload <-chan struct{}, interval func() time.Duration, refresh func()) {
+	// 启动时立即加载，丢弃启动前积累的刷新通知
+	select {
+	case <-reload:
+	default:
+	}
+	for {
+		refresh()
+
+		var tick <-chan time.Time
+		var timer *time.Timer
+		if d := interval(); d > 0 {
+			timer = time.NewTimer(d)
+			tick = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-reload:
+		case <-tick:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Configure 应用新配置：应答参数立即生效，来源或刷新间隔等变化时通知刷新循环重新加载
+func (b *Blocklist) Configure(cfg conf.BlocklistConfig) {
+	b.settings.Store(newBlockSettings(cfg))
+
+	b.mu.Lock()
+	changed := !reflect.DeepEqual(b.cfg, cfg)
+	b.cfg = cfg
+	b.mu.Unlock()
+
+	if !cfg.Enabled {
+		b.matcher.Store(nil)
+	}
+	if changed {
+		select {
+		case b.reload <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Refresh 重新加载全部来源并发布新的匹配表；单个来源加载失败时沿用其上次成功加载的条目
+func (b *Blocklist) Refresh() error {
+	b.refreshMu.Lock()
+	defer b.refreshMu.Unlock()
+
+	b.mu.Lock()
+	cfg, previous := b.cfg, b.sources
+	b.mu.Unlock()
+	if !cfg.Enabled {
+		b.matcher.Store(nil)
+		return fmt.Errorf("拦截列表未启用")
+	}
+
+	prevs := make(map[string]*blockSource, len(previous))
+	for _, src := range previous {
+		prevs[sourceKey(src.cfg)] = src
+	}
+	sources := make([]*blockSource, 0, len(cfg.Sources))
+	for _, sc := range cfg.Sources {
+		src := &blockSource{cfg: sc, hits: new(atomic.Uint64)}
+		src.status = BlocklistSourceStatus{Name: sourceName(sc), Location: sc.URL + sc.Path, Format: sc.Format}
+		if src.status.Format == "" {
+			src.status.Format = BlocklistFormatAuto
+		}
+		if prev := prevs[sourceKey(sc)]; prev != nil {
+			src.entries, src.hits = prev.entries, prev.hits
+			src.status.Entries, src.status.LastLoaded = prev.status.Entries, prev.status.LastLoaded
+		}
+
+		entries, err := b.load(sc)
+		if err != nil {
+			log.Printf("Failed to load blocklist %s: %v", src.status.Name, err)
+			src.status.LastError = err.Error()
+		} else {
+			src.entries = entries
+			src.status.Entries = len(entries.exact) + len(entries.suffix) + len(entries.allow)
+			src.status.LastLoaded = time.Now()
+		}
+		sources = append(sources, src)
+	}
+
+	matcher := buildBlockMatcher(sources, cfg.Allowlist)
+	b.mu.Lock()
+	b.sources = sources
+	// 刷新期间配置被关闭时不再发布
+	if b.cfg.Enabled {
+		b.matcher.Store(matcher)
+	}
+	b.mu.Unlock()
+	log.Printf("Blocklist refreshed: %d exact and %d suffix rules from %d sources", len(matcher.exact), len(matcher.suffix), len(sources))
+	return nil
+}
+
+// sourceKey 来源的唯一标识（位置与格式相同的来源沿用上次的加载结果）
+func sourceKey(sc conf.BlocklistSource) string {
+	return sc.URL + "|" + sc.Path + "|" + sc.Format
+}
+
+// sourceName 来源名称，未配置时使用url或path
+func sourceName(sc conf.BlocklistSource) string {
+	if sc.Name != "" {
+		return sc.Name
+	}
+	return sc.URL + sc.Path
+}
+
+// -------------------------- 列表加载与解析 --------------------------
+// load 读取并解析单个来源
+func (b *Blocklist) load(sc conf.BlocklistSource) (*blockEntries, error) {
+	if (sc.URL == "") == (sc.Path == "") {
+		return nil, fmt.Errorf("url 与 path 必须且只能配置一个")
+	}
+	switch sc.Format {
+	case "", BlocklistFormatAuto, BlocklistFormatHosts, BlocklistFormatPlain, BlocklistFormatAdblock:
+	default:
+		return nil, fmt.Errorf("不支持的列表格式: %s", sc.Format)
+	}
+
+	var r io.ReadCloser
+	if sc.Path != "" {
+		f, err := os.Open(sc.Path)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	} else {
+		resp, err := b.client.Get(sc.URL)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("下载失败: HTTP %d", resp.StatusCode)
+		}
+		r = resp.Body
+	}
+	defer r.Close()
+	return parseBlocklist(io.LimitReader(r, maxBlocklistSize), sc.Format)
+}
+
+// parseBlocklist 逐行解析列表，无法识别的行直接跳过
+func parseBlocklist(r io.Reader, format string) (*blockEntries, error) {
+	entries := &blockEntries{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		kind, names := parseBlocklistLine(scanner.Text(), format)
+		for _, name := range names {
+			switch kind {
+			case blockExact:
+				entries.exact = append(entries.exact, name)
+			case blockSuffix:
+				entries.suffix = append(entries.suffix, name)
+			case allowSuffix:
+				entries.allow = append(entries.allow, name)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// parseBlocklistLine 解析一行，返回条目类型与规范化名称
+func parseBlocklistLine(line, format string) (int, []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == '!' || line[0] == '[' {
+		return 0, nil
+	}
+	if format == "" || format == BlocklistFormatAuto {
+		if strings.HasPrefix(line, "||") || strings.HasPrefix(line, "@@||") {
+			format = BlocklistFormatAdblock
+		}
+	}
+	if format == BlocklistFormatAdblock {
+		return parseAdblockRule(line)
+	}
+
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	// hosts格式：IP 名称...
+	if format != BlocklistFormatPlain && net.ParseIP(fields[0]) != nil {
+		names := make([]string, 0, len(fields)-1)
+		for _, field := range fields[1:] {
+			if name, ok := blockName(field); ok && !hostsIgnored[name] {
+				names = append(names, name)
+			}
+		}
+		return blockExact, names
+	}
+	if format == BlocklistFormatHosts || len(fields) != 1 {
+		return 0, nil
+	}
+	if name, ok := blockName(fields[0]); ok {
+		return blockExact, []string{name}
+	}
+	return 0, nil
+}
+
+// parseAdblockRule 解析adblock域名规则（||example.com^ 与 @@||example.com^），
+// 带路径、通配符或除 $important 外修饰符的规则对DNS无意义，直接跳过
+func parseAdblockRule(line string) (int, []string) {
+	kind := blockSuffix
+	if strings.HasPrefix(line, "@@") {
+		kind = allowSuffix
+		line = line[2:]
+	}
+	if !strings.HasPrefix(line, "||") {
+		return 0, nil
+	}
+	rule := line[2:]
+	if i := strings.IndexByte(rule, '$'); i >= 0 {
+		if rule[i+1:] != "important" {
+			return 0, nil
+		}
+		rule = rule[:i]
+	}
+	rule = strings.TrimSuffix(rule, "|")
+	if !strings.HasSuffix(rule, "^") {
+		return 0, nil
+	}
+	if name, ok := blockName(strings.TrimSuffix(rule, "^")); ok {
+		return kind, []string{name}
+	}
+	return 0, nil
+}
+
+// blockName 校验并规范化列表中的域名
+func blockName(s string) (string, bool) {
+	if s == "" || strings.ContainsAny(s, "/*:?=") {
+		return "", false
+	}
+	if _, ok := dns.IsDomainName(s); !ok {
+		return "", false
+	}
+	name := canonicalName(s)
+	return name, name != "."
+}
+
+// -------------------------- 匹配 --------------------------
+// buildBlockMatcher 合并全部来源与配置的放行列表（同一名称归属于第一个包含它的来源）
+func buildBlockMatcher(sources []*blockSource, allowlist []string) *blockMatcher {
+	m := &blockMatcher{
+		exact:   make(map[string]int),
+		suffix:  make(map[string]int),
+		allow:   make(map[string]int),
+		sources: sources,
+	}
+	for _, entry := range allowlist {
+		if name, ok := blockName(strings.TrimPrefix(strings.TrimSpace(entry), "*.")); ok {
+			m.allow[name] = -1
+		}
+	}
+	for i, src := range sources {
+		if src.entries == nil {
+			continue
+		}
+		for _, table := range []struct {
+			names []string
+			out   map[string]int
+		}{{src.entries.exact, m.exact}, {src.entries.suffix, m.suffix}, {src.entries.allow, m.allow}} {
+			for _, name := range table.names {
+				if _, exists := table.out[name]; !exists {
+					table.out[name] = i
+				}
+			}
+		}
+	}
+	return m
+}
+
+// check 检查规范化名称：放行规则优先，其次精确拦截，最后按后缀拦截；被拦截时同时返回来源下标
+func (m *blockMatcher) check(name string) (BlockCheck, int) {
+	result := BlockCheck{Name: name}
+	if rule, src, ok := matchSuffix(m.allow, name); ok {
+		result.Allowed, result.Rule, result.Source = true, rule, m.sourceName(src)
+		return result, src
+	}
+	if src, ok := m.exact[name]; ok {
+		result.Blocked, result.Rule, result.Source = true, name, m.sourceName(src)
+		return result, src
+	}
+	if rule, src, ok := matchSuffix(m.suffix, name); ok {
+		result.Blocked, result.Rule, result.Source = true, rule, m.sourceName(src)
+		return result, src
+	}
+	return result, -1
+}
+
+// matchSuffix 查找覆盖name的最具体后缀规则（自身或任一父域名）
+func matchSuffix(table map[string]int, name string) (string, int, bool) {
+	if len(table) == 0 {
+		return "", 0, false
+	}
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if src, ok := table[name[off:]]; ok {
+			return name[off:], src, true
+		}
+	}
+	return "", 0, false
+}
+
+func (m *blockMatcher) sourceName(i int) string {
+	if i < 0 {
+		return allowlistSource
+	}
+	return m.sources[i].status.Name
+}
+
+// Check 检查名称是否被拦截（未启用或尚未加载时总是不拦截），只用于查询，不计入命中统计
+func (b *Blocklist) Check(name string) BlockCheck {
+	m := b.matcher.Load()
+	if m == nil {
+		return BlockCheck{Name: canonicalName(name)}
+	}
+	result, _ := m.check(canonicalName(name))
+	return result
+}
+
+// match 检查查询名称是否被拦截，被拦截时计入来源的命中统计
+func (b *Blocklist) match(qname string) (BlockCheck, bool) {
+	m := b.matcher.Load()
+	if m == nil {
+		return BlockCheck{}, false
+	}
+	result, src := m.check(canonicalName(qname))
+	if result.Blocked {
+		m.sources[src].hits.Add(1)
+	}
+	return result, result.Blocked
+}
+
+// Sources 返回各来源的加载状态
+func (b *Blocklist) Sources() []BlocklistSourceStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	statuses := make([]BlocklistSourceStatus, 0, len(b.sources))
+	for _, src := range b.sources {
+		status := src.status
+		status.Blocked = src.hits.Load()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// -------------------------- 拦截应答 --------------------------
+// answer 按拦截方式生成应答：nxdomain 返回NXDOMAIN；zero_ip/sinkhole 对A/AAAA返回对应地址，其他类型返回NODATA
+func (b *Blocklist) answer(m *dns.Msg, q dns.Question) {
+	s := b.settings.Load()
+	if s.mode == BlockModeNXDomain {
+		m.Rcode = dns.RcodeNameError
+		return
+	}
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: s.ttl}
+	switch {
+	case q.Qtype == dns.TypeA && s.ipv4 != nil:
+		m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: s.ipv4})
+	case q.Qtype == dns.TypeAAAA && s.ipv6 != nil:
+		m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: s.ipv6})
+	}
+}
+
+// BlocklistSources 返回拦截列表各来源的加载状态
+func (e *DNSEngine) BlocklistSources() []BlocklistSourceStatus {
+	return e.blocklist.Sources()
+}
+
+// RefreshBlocklist 立即重新加载拦截列表
+func (e *DNSEngine) RefreshBlocklist() error {
+	return e.blocklist.Refresh()
+}
+
+// CheckBlocked 检查名称是否会被拦截
+func (e *DNSEngine) CheckBlocked(name string) BlockCheck {
+	return e.blocklist.Check(name)
+}
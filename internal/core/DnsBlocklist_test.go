@@ -0,0 +1,94 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseBlocklistLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		line      string
+		wantKind  int
+		wantNames []string
+	}{
+		{name: "hosts", format: BlocklistFormatHosts, line: "0.0.0.0 ads.example.test tracker.example.test", wantKind: blockExact, wantNames: []string{"ads.example.test.", "tracker.example.test."}},
+		{name: "hosts skips localhost", format: BlocklistFormatHosts, line: "127.0.0.1 localhost", wantKind: blockExact},
+		{name: "hosts trailing comment", format: BlocklistFormatAuto, line: "0.0.0.0 Ads.Example.Test # ads", wantKind: blockExact, wantNames: []string{"ads.example.test."}},
+		{name: "hosts rejects plain line", format: BlocklistFormatHosts, line: "ads.example.test"},
+		{name: "plain", format: BlocklistFormatPlain, line: "ads.example.test", wantKind: blockExact, wantNames: []string{"ads.example.test."}},
+		{name: "plain rejects several names", format: BlocklistFormatPlain, line: "a.example.test b.example.test"},
+		{name: "auto plain", format: BlocklistFormatAuto, line: "ads.example.test", wantKind: blockExact, wantNames: []string{"ads.example.test."}},
+		{name: "adblock block", format: BlocklistFormatAdblock, line: "||ads.example.test^", wantKind: blockSuffix, wantNames: []string{"ads.example.test."}},
+		{name: "adblock allow", format: BlocklistFormatAuto, line: "@@||cdn.ads.example.test^", wantKind: allowSuffix, wantNames: []string{"cdn.ads.example.test."}},
+		{name: "adblock important", format: BlocklistFormatAuto, line: "||ads.example.test^$important", wantKind: blockSuffix, wantNames: []string{"ads.example.test."}},
+		{name: "adblock other modifier", format: BlocklistFormatAdblock, line: "||ads.example.test^$third-party"},
+		{name: "adblock path", format: BlocklistFormatAdblock, line: "||ads.example.test/banner^"},
+		{name: "adblock wildcard", format: BlocklistFormatAdblock, line: "||ads*.example.test^"},
+		{name: "adblock cosmetic", format: BlocklistFormatAdblock, line: "example.test##.banner"},
+		{name: "comment", format: BlocklistFormatAuto, line: "# ads.example.test"},
+		{name: "adblock comment", format: BlocklistFormatAuto, line: "! Title: list"},
+		{name: "section header", format: BlocklistFormatAuto, line: "[Adblock Plus 2.0]"},
+		{name: "invalid name", format: BlocklistFormatPlain, line: "ads..example.test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, names := parseBlocklistLine(tt.line, tt.format)
+			if len(tt.wantNames) > 0 && kind != tt.wantKind || !slices.Equal(names, tt.wantNames) {
+				t.Errorf("parseBlocklistLine(%q, %s) = %d %v, want %d %v", tt.line, tt.format, kind, names, tt.wantKind, tt.wantNames)
+			}
+		})
+	}
+}
+
+// TestBlocklistAllowlistPriority 放行规则（配置的 allowlist 与 adblock @@ 规则）优先于精确与后缀拦截
+func TestBlocklistAllowlistPriority(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	b := NewBlocklist(conf.BlocklistConfig{
+		Enabled: true,
+		Sources: []conf.BlocklistSource{
+			{Name: "hosts", Path: write("hosts.txt", "0.0.0.0 exact.example.test\n0.0.0.0 only.example.test\n0.0.0.0 keep.example.test\n")},
+			{Name: "adblock", Path: write("adblock.txt", "||ads.example.test^\n@@||cdn.ads.example.test^\n||exact.example.test^\n")},
+		},
+		Allowlist: []string{"*.partner.ads.example.test", "keep.example.test"},
+	})
+	if err := b.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		qname       string
+		wantBlocked bool
+		wantAllowed bool
+		wantSource  string
+	}{
+		{name: "exact from hosts", qname: "exact.example.test.", wantBlocked: true, wantSource: "hosts"},
+		{name: "exact does not cover subdomains", qname: "www.only.example.test.", wantBlocked: false},
+		{name: "suffix", qname: "ads.example.test.", wantBlocked: true, wantSource: "adblock"},
+		{name: "suffix covers subdomains", qname: "x.y.ads.example.test.", wantBlocked: true, wantSource: "adblock"},
+		{name: "adblock allow rule", qname: "img.cdn.ads.example.test.", wantAllowed: true, wantSource: "adblock"},
+		{name: "allowlist over suffix", qname: "partner.ads.example.test.", wantAllowed: true, wantSource: allowlistSource},
+		{name: "allowlist over exact", qname: "keep.example.test.", wantAllowed: true, wantSource: allowlistSource},
+		{name: "not listed", qname: "www.example.test.", wantBlocked: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := b.Check(tt.qname)
+			if got.Blocked != tt.wantBlocked || got.Allowed != tt.wantAllowed || got.Source != tt.wantSource {
+				t.Errorf("Check(%s) = %+v, want blocked %v allowed %v from %q", tt.qname, got, tt.wantBlocked, tt.wantAllowed, tt.wantSource)
+			}
+		})
+	}
+}
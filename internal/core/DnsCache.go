@@ -0,0 +1,265 @@
+package core
+
+import (
+	"container/list"
+	"dnsm/internal/conf"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// -------------------------- 基础数据结构 --------------------------
+// cacheKey 缓存键：查询名（小写）+ 查询类型 + 查询类 + DNSSEC OK位
+type cacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+	do     bool
+}
+
+// cacheEntry 缓存条目
+type cacheEntry struct {
+	key      cacheKey
+	msg      *dns.Msg  // 上游响应副本
+	storedAt time.Time // 写入时间，用于计算剩余TTL
+	expireAt time.Time // 过期时间
+}
+
+// CacheStats 缓存统计信息
+type CacheStats struct {
+	Enabled  bool    `json:"enabled"`   // 是否启用
+	Size     int     `json:"size"`      // 当前条目数
+	Capacity int     `json:"capacity"`  // 最大条目数
+	Hits     uint64  `json:"hits"`      // 命中次数
+	Misses   uint64  `json:"misses"`    // 未命中次数
+	HitRatio float64 `json:"hit_ratio"` // 命中率
+}
+
+// -------------------------- 缓存实现 --------------------------
+// DNSCache 转发响应缓存（按TTL过期，按LRU淘汰）
+type DNSCache struct {
+	mu       sync.Mutex
+	capacity int
+	minTTL   uint32
+	maxTTL   uint32
+	negTTL   uint32
+	items    map[cacheKey]*list.Element
+	lru      *list.List // 队首为最近使用
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewDNSCache 创建转发响应缓存，未启用时返回nil（nil缓存的所有方法均可安全调用）
+func NewDNSCache(cfg conf.CacheConfig) *DNSCache {
+	if !cfg.Enabled || cfg.Size <= 0 {
+		return nil
+	}
+	return &DNSCache{
+		capacity: cfg.Size,
+		minTTL:   uint32(max(cfg.MinTTL, 0)),
+		maxTTL:   uint32(max(cfg.MaxTTL, 0)),
+		negTTL:   uint32(max(cfg.NegativeTTL, 0)),
+		items:    make(map[cacheKey]*list.Element, cfg.Size),
+		lru:      list.New(),
+	}
+}
+
+// Get 查询缓存，命中时返回按剩余时间修正TTL后的响应副本
+func (c *DNSCache) Get(req *dns.Msg) (*dns.Msg, bool) {
+	if c == nil || len(req.Question) == 0 {
+		return nil, false
+	}
+	key := newCacheKey(req)
+	now := time.Now()
+
+	c.mu.Lock()
+	elem, ok := c.items[key]
+	if !ok {
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !now.Before(entry.expireAt) {
+		// 已过期，直接删除
+		c.lru.Remove(elem)
+		delete(c.items, key)
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	msg := entry.msg.Copy()
+	elapsed := uint32(now.Sub(entry.storedAt) / time.Second)
+	c.mu.Unlock()
+
+	c.hits.Add(1)
+
+	// 扣减已经过的时间
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			hdr := rr.Header()
+			if hdr.Ttl > elapsed {
+				hdr.Ttl -= elapsed
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+	msg.Id = req.Id
+	msg.Question = req.Question
+	return msg, true
+}
+
+// Set 写入缓存（仅缓存NOERROR/NXDOMAIN且未截断的响应）
+func (c *DNSCache) Set(req, resp *dns.Msg) {
+	if c == nil || resp == nil || len(req.Question) == 0 || resp.Truncated {
+		return
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return
+	}
+
+	ttl := c.ttlOf(resp)
+	if ttl == 0 {
+		return
+	}
+
+	now := time.Now()
+	key := newCacheKey(req)
+	entry := &cacheEntry{
+		key:      key,
+		msg:      resp.Copy(),
+		storedAt: now,
+		expireAt: now.Add(time.Duration(ttl) * time.Second),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.lru.PushFront(entry)
+
+	// 超出容量时淘汰最久未使用的条目
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Purge 删除查询名满足条件的缓存条目，返回删除数量
+func (c *DNSCache) Purge(match func(name string) bool) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key, elem := range c.items {
+		if match(key.name) {
+			c.lru.Remove(elem)
+			delete(c.items, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Flush 清空缓存
+func (c *DNSCache) Flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[cacheKey]*list.Element, c.capacity)
+	c.lru.Init()
+}
+
+// Stats 返回缓存统计信息
+func (c *DNSCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	stats := CacheStats{
+		Enabled:  true,
+		Size:     size,
+		Capacity: c.capacity,
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// -------------------------- 私有辅助方法 --------------------------
+// ttlOf 计算响应的缓存时间：
+// 正常应答取所有记录中最小的TTL；NXDOMAIN/NODATA 按 RFC 2308 取SOA的TTL与MINIMUM中较小者
+func (c *DNSCache) ttlOf(resp *dns.Msg) uint32 {
+	var ttl uint32
+	negative := resp.Rcode == dns.RcodeNameError || len(resp.Answer) == 0
+
+	if negative {
+		ttl = c.negTTL
+		for _, rr := range resp.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl = min(soa.Hdr.Ttl, soa.Minttl)
+				break
+			}
+		}
+	} else {
+		first := true
+		for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+			for _, rr := range section {
+				if rr.Header().Rrtype == dns.TypeOPT {
+					continue
+				}
+				if first || rr.Header().Ttl < ttl {
+					ttl = rr.Header().Ttl
+					first = false
+				}
+			}
+		}
+	}
+
+	if ttl < c.minTTL {
+		ttl = c.minTTL
+	}
+	if c.maxTTL > 0 && ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+	return ttl
+}
+
+// newCacheKey 根据请求生成缓存键
+func newCacheKey(req *dns.Msg) cacheKey {
+	q := req.Question[0]
+	key := cacheKey{
+		name:   strings.ToLower(q.Name),
+		qtype:  q.Qtype,
+		qclass: q.Qclass,
+	}
+	if opt := req.IsEdns0(); opt != nil {
+		key.do = opt.Do()
+	}
+	return key
+}
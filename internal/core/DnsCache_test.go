@@ -0,0 +1,135 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// cacheReply 构造对 name 的应答，ttls 为各条A记录的TTL
+func cacheReply(name string, rcode int, ttls ...uint32) (*dns.Msg, *dns.Msg) {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	resp := new(dns.Msg)
+	resp.SetRcode(req, rcode)
+	for _, ttl := range ttls {
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+			A:   net.ParseIP("192.0.2.1"),
+		})
+	}
+	return req, resp
+}
+
+// withSOA 在权威部分附加SOA
+func withSOA(resp *dns.Msg, ttl, minimum uint32) *dns.Msg {
+	resp.Ns = append(resp.Ns, &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.test.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:     "ns1.example.test.",
+		Mbox:   "hostmaster.example.test.",
+		Minttl: minimum,
+	})
+	return resp
+}
+
+func TestCacheTTL(t *testing.T) {
+	reply := func(rcode int, ttls ...uint32) *dns.Msg {
+		_, resp := cacheReply("www.example.test.", rcode, ttls...)
+		return resp
+	}
+	tests := []struct {
+		name string
+		cfg  conf.CacheConfig
+		resp *dns.Msg
+		want uint32
+	}{
+		{name: "smallest record TTL", resp: reply(dns.RcodeSuccess, 300, 60), want: 60},
+		{name: "NXDOMAIN uses the smaller of SOA TTL and MINIMUM", resp: withSOA(reply(dns.RcodeNameError), 3600, 120), want: 120},
+		{name: "NODATA uses the SOA TTL when it is smaller", resp: withSOA(reply(dns.RcodeSuccess), 30, 300), want: 30},
+		{name: "negative answer without SOA uses negative_ttl", cfg: conf.CacheConfig{NegativeTTL: 45}, resp: reply(dns.RcodeNameError), want: 45},
+		{name: "raised to min_ttl", cfg: conf.CacheConfig{MinTTL: 30}, resp: reply(dns.RcodeSuccess, 5), want: 30},
+		{name: "capped at max_ttl", cfg: conf.CacheConfig{MaxTTL: 600}, resp: reply(dns.RcodeSuccess, 86400), want: 600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Enabled, tt.cfg.Size = true, 10
+			if got := NewDNSCache(tt.cfg).ttlOf(tt.resp); got != tt.want {
+				t.Errorf("ttlOf() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCacheNegativeAnswers NXDOMAIN与NODATA被缓存，SERVFAIL、截断与TTL为0的应答不缓存
+func TestCacheNegativeAnswers(t *testing.T) {
+	tests := []struct {
+		name       string
+		rcode      int
+		truncated  bool
+		soaTTL     uint32
+		wantCached bool
+	}{
+		{name: "NXDOMAIN", rcode: dns.RcodeNameError, soaTTL: 300, wantCached: true},
+		{name: "NODATA", rcode: dns.RcodeSuccess, soaTTL: 300, wantCached: true},
+		{name: "SERVFAIL", rcode: dns.RcodeServerFailure, soaTTL: 300},
+		{name: "truncated", rcode: dns.RcodeNameError, soaTTL: 300, truncated: true},
+		{name: "zero TTL", rcode: dns.RcodeNameError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewDNSCache(conf.CacheConfig{Enabled: true, Size: 10})
+			req, resp := cacheReply("x.example.test.", tt.rcode)
+			resp.Truncated = tt.truncated
+			c.Set(req, withSOA(resp, tt.soaTTL, tt.soaTTL))
+
+			cached, ok := c.Get(req)
+			if ok != tt.wantCached {
+				t.Fatalf("Get() cached = %v, want %v", ok, tt.wantCached)
+			}
+			if ok && (cached.Rcode != tt.rcode || len(cached.Ns) != 1) {
+				t.Errorf("cached response = %v, want rcode %s with the SOA", cached, dns.RcodeToString[tt.rcode])
+			}
+		})
+	}
+}
+
+// TestCacheRemainingTTL 命中时TTL扣减已缓存的时间，过期后不再命中
+func TestCacheRemainingTTL(t *testing.T) {
+	c := NewDNSCache(conf.CacheConfig{Enabled: true, Size: 10})
+	req, resp := cacheReply("www.example.test.", dns.RcodeSuccess, 300, 60)
+	c.Set(req, resp)
+
+	entry := c.items[newCacheKey(req)].Value.(*cacheEntry)
+	entry.storedAt = entry.storedAt.Add(-10 * time.Second)
+
+	query := new(dns.Msg)
+	query.SetQuestion("WWW.Example.Test.", dns.TypeA)
+	cached, ok := c.Get(query)
+	if !ok {
+		t.Fatal("query differing only in case missed the cache")
+	}
+	if cached.Id != query.Id || cached.Question[0].Name != "WWW.Example.Test." {
+		t.Error("cached response should carry the query's ID and question")
+	}
+	if got := []uint32{cached.Answer[0].Header().Ttl, cached.Answer[1].Header().Ttl}; got[0] != 290 || got[1] != 50 {
+		t.Errorf("remaining TTLs = %v, want [290 50]", got)
+	}
+
+	// 同名但DO位不同的查询分别缓存
+	dnssec := req.Copy()
+	dnssec.SetEdns0(1232, true)
+	if _, ok := c.Get(dnssec); ok {
+		t.Error("query with the DO bit hit the entry cached without it")
+	}
+
+	entry.expireAt = time.Now()
+	if _, ok := c.Get(req); ok {
+		t.Error("expired entry was returned")
+	}
+	if stats := c.Stats(); stats.Size != 0 || stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("Stats() = %+v, want size 0, 1 hit and 2 misses", stats)
+	}
+}
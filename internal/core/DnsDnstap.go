@@ -0,0 +1,602 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"dnsm/internal/conf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dnstap 消息类型（dnstap.proto Message.Type）
+const (
+	dnstapClientQuery       = 5
+	dnstapClientResponse    = 6
+	dnstapForwarderQuery    = 7
+	dnstapForwarderResponse = 8
+)
+
+// dnstap 传输协议（dnstap.proto SocketProtocol）
+const (
+	dnstapUDP = 1
+	dnstapTCP = 2
+	dnstapDoT = 3
+	dnstapDoH = 4
+	dnstapDoQ = 7
+)
+
+// Frame Streams 控制帧
+const (
+	fstrmControlAccept    = 0x01
+	fstrmControlStart     = 0x02
+	fstrmControlStop      = 0x03
+	fstrmControlReady     = 0x04
+	fstrmControlFinish    = 0x05
+	fstrmFieldContentType = 0x01
+	fstrmContentType      = "protobuf:dnstap.Dnstap"
+	maxFstrmControlSize   = 512 // 控制帧长度上限（Frame Streams 规范要求不超过512字节）
+)
+
+const (
+	defaultDnstapQueueSize = 10000
+	dnstapTimeout          = 5 * time.Second // 连接、握手与写入超时
+	dnstapFlushInterval    = time.Second
+	dnstapMinBackoff       = time.Second // 输出打开失败后的重试间隔（逐次翻倍）
+	dnstapMaxBackoff       = 30 * time.Second
+	dnstapRotateLayout     = "20060102-150405.000" // 文件输出重新打开时，已有文件重命名所用的时间格式
+)
+
+// -------------------------- 基础数据结构 --------------------------
+// dnstapPeer 一次DNS交互的传输协议与双方地址
+type dnstapPeer struct {
+	protocol uint32
+	query    netip.AddrPort // 发起查询的一方（客户端；转发时为本服务，不记录）
+	response netip.AddrPort // 应答的一方（本服务；转发时为上游）
+}
+
+// dnstapMessage 待编码的 dnstap 消息，DNS报文在提交前已打包
+type dnstapMessage struct {
+	typ          uint32
+	peer         dnstapPeer
+	queryTime    time.Time
+	responseTime time.Time
+	query        []byte
+	response     []byte
+}
+
+// Dnstap dnstap 输出：由后台任务经 Frame Streams 写入Unix套接字、TCP或文件，
+// 接收方跟不上或连接断开时队列写满后直接丢弃消息，不阻塞查询处理
+type Dnstap struct {
+	messages chan dnstapMessage
+	enabled  atomic.Bool
+	dropped  atomic.Uint64 // 尚未汇总到日志的丢弃条数
+	lost     atomic.Uint64 // 累计丢弃条数
+	sent     atomic.Uint64 // 累计写出条数
+	reload   chan struct{} // 配置变化时通知后台任务重新打开输出
+
+	mu  sync.Mutex // 保护 cfg
+	cfg conf.DnstapConfig
+}
+
+// NewDnstap 创建 dnstap 输出，连接在 Run 启动后建立；队列长度修改后需重启生效
+func NewDnstap(cfg conf.DnstapConfig) *Dnstap {
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = defaultDnstapQueueSize
+	}
+	t := &Dnstap{
+		messages: make(chan dnstapMessage, size),
+		reload:   make(chan struct{}, 1),
+		cfg:      cfg,
+	}
+	t.enabled.Store(cfg.Enabled)
+	return t
+}
+
+// Configure 应用新配置，配置有变化时重新打开输出
+func (t *Dnstap) Configure(cfg conf.DnstapConfig) {
+	t.enabled.Store(cfg.Enabled)
+
+	t.mu.Lock()
+	changed := cfg != t.cfg
+	t.cfg = cfg
+	t.mu.Unlock()
+	if changed {
+		select {
+		case t.reload <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Dnstap) config() conf.DnstapConfig {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cfg
+}
+
+// -------------------------- 输出 --------------------------
+// Run 打开输出并持续写出消息，输出失败时按退避间隔重试，直到ctx结束
+func (t *Dnstap) Run(ctx context.Context) {
+	backoff := dnstapMinBackoff
+	for {
+		cfg := t.config()
+		if !cfg.Enabled {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.reload:
+				continue
+			}
+		}
+
+		out, err := openFstrm(cfg)
+		if err != nil {
+			log.Printf("Failed to open dnstap output %s: %v", cfg.Address, err)
+			t.reportDropped()
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.reload:
+				backoff = dnstapMinBackoff
+			case <-time.After(backoff):
+				backoff = min(2*backoff, dnstapMaxBackoff)
+			}
+			continue
+		}
+		backoff = dnstapMinBackoff
+		log.Printf("dnstap output opened on %s", cfg.Address)
+		if err := t.serve(ctx, out, cfg); err != nil {
+			log.Printf("dnstap output %s failed: %v", cfg.Address, err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// serve 向已打开的输出写出消息，ctx结束或配置变化时正常结束数据流
+func (t *Dnstap) serve(ctx context.Context, out *fstrmWriter, cfg conf.DnstapConfig) error {
+	defer out.close()
+	flush := time.NewTicker(dnstapFlushInterval)
+	defer flush.Stop()
+
+	identity := cfg.Identity
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	var frame []byte
+	for {
+		select {
+		case <-ctx.Done():
+			return out.stop()
+		case <-t.reload:
+			return out.stop()
+		case msg := <-t.messages:
+			frame = msg.appendDnstap(frame[:0], identity, cfg.Version)
+			if err := out.writeFrame(frame); err != nil {
+				return err
+			}
+			t.sent.Add(1)
+		case <-flush.C:
+			t.reportDropped()
+			if err := out.flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// reportDropped 将队列已满被丢弃的条数汇总到日志
+func (t *Dnstap) reportDropped() {
+	if n := t.dropped.Swap(0); n > 0 {
+		log.Printf("dnstap queue full, dropped %d messages", n)
+	}
+}
+
+// record 提交一条消息，队列已满时直接丢弃
+func (t *Dnstap) record(msg dnstapMessage) {
+	select {
+	case t.messages <- msg:
+	default:
+		t.dropped.Add(1)
+		t.lost.Add(1)
+	}
+}
+
+// -------------------------- 消息采集 --------------------------
+// clientQuery 记录收到的客户端查询（CLIENT_QUERY）
+func (t *Dnstap) clientQuery(w dns.ResponseWriter, req *dns.Msg, received time.Time) {
+	if !t.enabled.Load() {
+		return
+	}
+	packed, err := req.Pack()
+	if err != nil {
+		return
+	}
+	t.record(dnstapMessage{typ: dnstapClientQuery, peer: clientPeer(w), queryTime: received, query: packed})
+}
+
+// clientResponse 记录写回客户端的应答（CLIENT_RESPONSE）
+func (t *Dnstap) clientResponse(w dns.ResponseWriter, m *dns.Msg) {
+	if !t.enabled.Load() {
+		return
+	}
+	packed, err := m.Pack()
+	if err != nil {
+		return
+	}
+	t.record(dnstapMessage{typ: dnstapClientResponse, peer: clientPeer(w), responseTime: time.Now(), response: packed})
+}
+
+// forwarderQuery 记录发往上游的查询（FORWARDER_QUERY）
+func (t *Dnstap) forwarderQuery(peer dnstapPeer, req *dns.Msg, sent time.Time) {
+	if t == nil || !t.enabled.Load() {
+		return
+	}
+	packed, err := req.Pack()
+	if err != nil {
+		return
+	}
+	t.record(dnstapMessage{typ: dnstapForwarderQuery, peer: peer, queryTime: sent, query: packed})
+}
+
+// forwarderResponse 记录上游返回的应答（FORWARDER_RESPONSE），sent 为查询发出的时间
+func (t *Dnstap) forwarderResponse(peer dnstapPeer, resp *dns.Msg, sent time.Time) {
+	if t == nil || !t.enabled.Load() {
+		return
+	}
+	packed, err := resp.Pack()
+	if err != nil {
+		return
+	}
+	t.record(dnstapMessage{typ: dnstapForwarderResponse, peer: peer, queryTime: sent, responseTime: time.Now(), response: packed})
+}
+
+// clientPeer 按监听类型确定客户端交互的传输协议与双方地址
+func clientPeer(w dns.ResponseWriter) dnstapPeer {
+	peer := dnstapPeer{protocol: dnstapTCP, query: netAddrPort(w.RemoteAddr()), response: netAddrPort(w.LocalAddr())}
+	if cw, ok := w.(*captureWriter); ok {
+		peer.protocol = dnstapDoH
+		if cw.quic {
+			peer.protocol = dnstapDoQ
+		}
+	} else if isUDP(w) {
+		peer.protocol = dnstapUDP
+	} else if cs, ok := w.(dns.ConnectionStater); ok && cs.ConnectionState() != nil {
+		peer.protocol = dnstapDoT
+	}
+	return peer
+}
+
+// upstreamPeer 按上游地址确定转发交互的传输协议与上游地址（上游为主机名时不记录地址）
+func upstreamPeer(a upstreamAddr) dnstapPeer {
+	peer := dnstapPeer{protocol: dnstapUDP}
+	switch a.scheme {
+	case schemeTCP:
+		peer.protocol = dnstapTCP
+	case schemeTLS:
+		peer.protocol = dnstapDoT
+	case schemeHTTPS:
+		peer.protocol = dnstapDoH
+	}
+	addr, err := netip.ParseAddr(a.host)
+	port, _ := strconv.ParseUint(a.port, 10, 16)
+	if err == nil {
+		peer.response = netip.AddrPortFrom(addr.Unmap(), uint16(port))
+	}
+	return peer
+}
+
+func netAddrPort(addr net.Addr) netip.AddrPort {
+	var ap netip.AddrPort
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ap = a.AddrPort()
+	case *net.TCPAddr:
+		ap = a.AddrPort()
+	}
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
+
+// -------------------------- protobuf 编码 --------------------------
+// appendDnstap 按 dnstap.proto 编码为 Dnstap 消息
+func (m *dnstapMessage) appendDnstap(b []byte, identity, version string) []byte {
+	if identity != "" {
+		b = appendProtoBytes(b, 1, []byte(identity))
+	}
+	if version != "" {
+		b = appendProtoBytes(b, 2, []byte(version))
+	}
+	b = appendProtoBytes(b, 14, m.appendMessage(nil))
+	return appendProtoVarint(b, 15, 1) // Dnstap.Type = MESSAGE
+}
+
+// appendMessage 编码 dnstap.proto 中的 Message
+func (m *dnstapMessage) appendMessage(b []byte) []byte {
+	b = appendProtoVarint(b, 1, uint64(m.typ))
+	family := m.peer.query.Addr()
+	if !family.IsValid() {
+		family = m.peer.response.Addr()
+	}
+	if family.IsValid() {
+		if family.Is4() {
+			b = appendProtoVarint(b, 2, 1) // INET
+		} else {
+			b = appendProtoVarint(b, 2, 2) // INET6
+		}
+	}
+	b = appendProtoVarint(b, 3, uint64(m.peer.protocol))
+	if m.peer.query.Addr().IsValid() {
+		b = appendProtoBytes(b, 4, m.peer.query.Addr().AsSlice())
+	}
+	if m.peer.response.Addr().IsValid() {
+		b = appendProtoBytes(b, 5, m.peer.response.Addr().AsSlice())
+	}
+	if m.peer.query.Addr().IsValid() {
+		b = appendProtoVarint(b, 6, uint64(m.peer.query.Port()))
+	}
+	if m.peer.response.Addr().IsValid() {
+		b = appendProtoVarint(b, 7, uint64(m.peer.response.Port()))
+	}
+	if !m.queryTime.IsZero() {
+		b = appendProtoVarint(b, 8, uint64(m.queryTime.Unix()))
+		b = appendProtoFixed32(b, 9, uint32(m.queryTime.Nanosecond()))
+	}
+	if m.query != nil {
+		b = appendProtoBytes(b, 10, m.query)
+	}
+	if !m.responseTime.IsZero() {
+		b = appendProtoVarint(b, 12, uint64(m.responseTime.Unix()))
+		b = appendProtoFixed32(b, 13, uint32(m.responseTime.Nanosecond()))
+	}
+	if m.response != nil {
+		b = appendProtoBytes(b, 14, m.response)
+	}
+	return b
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3) // wire type 0
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendProtoFixed32(b []byte, field int, v uint32) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|5)
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+// -------------------------- Frame Streams --------------------------
+// fstrmWriter Frame Streams 写入端：套接字输出使用双向模式（READY/ACCEPT 握手，结束时等待 FINISH），
+// 文件输出使用单向模式（每次打开时重新创建文件）
+type fstrmWriter struct {
+	conn net.Conn // 套接字输出，文件输出时为nil
+	file *os.File
+	w    *bufio.Writer
+}
+
+// openFstrm 按地址打开输出并开始数据流，地址形如 unix:///path、tcp://host:port、file:///path
+func openFstrm(cfg conf.DnstapConfig) (*fstrmWriter, error) {
+	address := cfg.Address
+	scheme, target, ok := strings.Cut(address, "://")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("dnstap 输出地址 %s 不合法", address)
+	}
+	switch scheme = strings.ToLower(scheme); scheme {
+	case "file":
+		// 每个文件只包含一段完整的数据流：已有内容的文件先按时间重命名保留，再创建新文件
+		if err := rotateDnstapFile(target); err != nil {
+			return nil, err
+		}
+		pruneDnstapFiles(target, cfg.MaxAge, cfg.MaxFiles)
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		out := &fstrmWriter{file: f, w: bufio.NewWriter(f)}
+		out.writeControl(fstrmControlStart)
+		if err := out.flush(); err != nil {
+			out.close()
+			return nil, err
+		}
+		return out, nil
+	case "unix", "tcp":
+		conn, err := net.DialTimeout(scheme, target, dnstapTimeout)
+		if err != nil {
+			return nil, err
+		}
+		out := &fstrmWriter{conn: conn, w: bufio.NewWriter(conn)}
+		if err := out.handshake(); err != nil {
+			out.close()
+			return nil, err
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("dnstap 输出地址 %s 使用了不支持的协议 %s", address, scheme)
+	}
+}
+
+// rotateDnstapFile 将已有内容的输出文件重命名为带时间的文件，如 dnsm.dnstap -> dnsm-20240101-150405.000.dnstap
+func rotateDnstapFile(target string) error {
+	info, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return os.Remove(target)
+	}
+	ext := filepath.Ext(target)
+	rotated := strings.TrimSuffix(target, ext) + "-" + time.Now().Format(dnstapRotateLayout) + ext
+	return os.Rename(target, rotated)
+}
+
+// pruneDnstapFiles 删除 target 轮转出的文件中超过保留时长或超出保留数量的文件
+func pruneDnstapFiles(target string, maxAge time.Duration, maxFiles int) {
+	if maxAge <= 0 && maxFiles <= 0 {
+		return
+	}
+	for i, name := range rotatedDnstapFiles(target) {
+		remove := maxFiles > 0 && i >= maxFiles
+		if !remove && maxAge > 0 {
+			if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > maxAge {
+				remove = true
+			}
+		}
+		if remove {
+			if err := os.Remove(name); err != nil {
+				log.Printf("Failed to remove expired dnstap file %s: %v", name, err)
+			}
+		}
+	}
+}
+
+// rotatedDnstapFiles 返回 target 轮转出的文件（新文件在前）
+func rotatedDnstapFiles(target string) []string {
+	dir, base := filepath.Split(target)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if entry.IsDir() || !ok || !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		if _, err := time.Parse(dnstapRotateLayout, strings.TrimSuffix(stamp, ext)); err == nil {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	// 文件名中的时间保证字典序即时间顺序
+	slices.Sort(files)
+	slices.Reverse(files)
+	return files
+}
+
+// handshake 双向模式握手：发送 READY，等待接收方 ACCEPT 后发送 START
+func (f *fstrmWriter) handshake() error {
+	f.writeControl(fstrmControlReady)
+	if err := f.flush(); err != nil {
+		return err
+	}
+	typ, err := f.readControl()
+	if err != nil {
+		return err
+	}
+	if typ != fstrmControlAccept {
+		return fmt.Errorf("dnstap 接收方未接受连接（控制帧类型 %d）", typ)
+	}
+	f.writeControl(fstrmControlStart)
+	return f.flush()
+}
+
+// writeControl 写入控制帧（READY/START 携带内容类型）
+func (f *fstrmWriter) writeControl(typ uint32) {
+	payload := binary.BigEndian.AppendUint32(nil, typ)
+	if typ == fstrmControlReady || typ == fstrmControlStart {
+		payload = binary.BigEndian.AppendUint32(payload, fstrmFieldContentType)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(fstrmContentType)))
+		payload = append(payload, fstrmContentType...)
+	}
+	header := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(payload))) // 长度为0的转义标记 + 控制帧长度
+	_, _ = f.w.Write(header)
+	_, _ = f.w.Write(payload)
+}
+
+// readControl 读取接收方的控制帧，返回控制帧类型
+func (f *fstrmWriter) readControl() (uint32, error) {
+	if err := f.conn.SetReadDeadline(time.Now().Add(dnstapTimeout)); err != nil {
+		return 0, err
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(f.conn, header[:]); err != nil {
+		return 0, err
+	}
+	size := binary.BigEndian.Uint32(header[4:])
+	if binary.BigEndian.Uint32(header[:4]) != 0 || size < 4 || size > maxFstrmControlSize {
+		return 0, fmt.Errorf("dnstap 接收方返回了无效的控制帧")
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(f.conn, payload); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(payload), nil
+}
+
+// writeFrame 写入数据帧
+func (f *fstrmWriter) writeFrame(data []byte) error {
+	if f.conn != nil {
+		if err := f.conn.SetWriteDeadline(time.Now().Add(dnstapTimeout)); err != nil {
+			return err
+		}
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	if _, err := f.w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := f.w.Write(data)
+	return err
+}
+
+func (f *fstrmWriter) flush() error {
+	if f.conn != nil {
+		if err := f.conn.SetWriteDeadline(time.Now().Add(dnstapTimeout)); err != nil {
+			return err
+		}
+	}
+	return f.w.Flush()
+}
+
+// stop 结束数据流：发送 STOP，双向模式下等待接收方 FINISH
+func (f *fstrmWriter) stop() error {
+	f.writeControl(fstrmControlStop)
+	if err := f.flush(); err != nil {
+		return err
+	}
+	if f.conn == nil {
+		return nil
+	}
+	typ, err := f.readControl()
+	if err != nil {
+		return err
+	}
+	if typ != fstrmControlFinish {
+		return fmt.Errorf("dnstap 接收方未确认结束（控制帧类型 %d）", typ)
+	}
+	return nil
+}
+
+func (f *fstrmWriter) close() {
+	if f.conn != nil {
+		_ = f.conn.Close()
+		return
+	}
+	_ = f.file.Close()
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestDnstapFileRetention 重新打开文件输出时保留最近的历史文件，超出数量或保留时长的被删除，无关文件不受影响
+func TestDnstapFileRetention(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		maxFiles int
+		want     []string // 保留的历史文件（不含本次重命名的文件），新文件在前
+	}{
+		{name: "unlimited", want: []string{"dnsm-20240103-000000.000.dnstap", "dnsm-20240102-000000.000.dnstap", "dnsm-20240101-000000.000.dnstap"}},
+		{name: "max files", maxFiles: 2, want: []string{"dnsm-20240103-000000.000.dnstap"}},
+		{name: "max age", maxAge: 24 * time.Hour, want: []string{"dnsm-20240103-000000.000.dnstap", "dnsm-20240102-000000.000.dnstap"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			write := func(name string, age time.Duration) {
+				path := filepath.Join(dir, name)
+				if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				mtime := time.Now().Add(-age)
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			write("dnsm-20240101-000000.000.dnstap", 72*time.Hour)
+			write("dnsm-20240102-000000.000.dnstap", time.Hour)
+			write("dnsm-20240103-000000.000.dnstap", time.Hour)
+			write("dnsm-notes.dnstap", 72*time.Hour)
+			write("dnsm.dnstap", 0)
+
+			target := filepath.Join(dir, "dnsm.dnstap")
+			out, err := openFstrm(conf.DnstapConfig{Address: "file://" + target, MaxAge: tt.maxAge, MaxFiles: tt.maxFiles})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out.close()
+
+			files := rotatedDnstapFiles(target)
+			if len(files) == 0 {
+				t.Fatal("the existing output file was not kept")
+			}
+			var kept []string
+			for _, name := range files[1:] {
+				kept = append(kept, filepath.Base(name))
+			}
+			if !slices.Equal(kept, tt.want) {
+				t.Errorf("kept %v, want %v", kept, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "dnsm-notes.dnstap")); err != nil {
+				t.Errorf("unrelated file was removed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	dohJSONContentType = "application/dns-json"
+	maxDoHRequestSize  = dns.MaxMsgSize
+)
+
+// -------------------------- DoH 服务端（RFC 8484） --------------------------
+// ServeDoH 处理 DNS-over-HTTPS 请求，所有查询都经由 HandleRequest 处理：
+//   - GET  ?dns=<base64url>                 RFC 8484 报文格式
+//   - POST application/dns-message          RFC 8484 报文格式
+//   - GET  ?name=<域名>&type=<类型>          JSON格式（application/dns-json）
+func (e *DNSEngine) ServeDoH(w http.ResponseWriter, r *http.Request) {
+	e.ServeDoHFrom(w, r, netip.Addr{})
+}
+
+// ServeDoHFrom 同 ServeDoH，client 有效时以其作为客户端地址，否则使用连接的远端地址；
+// DoH挂载在反向代理之后时，由调用方按可信代理从转发头中解析出 client
+func (e *DNSEngine) ServeDoHFrom(w http.ResponseWriter, r *http.Request, client netip.Addr) {
+	var req *dns.Msg
+	jsonAPI := false
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		if param := query.Get("dns"); param != "" {
+			wire, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(param, "="))
+			if err != nil {
+				http.Error(w, "invalid dns parameter", http.StatusBadRequest)
+				return
+			}
+			if req = unpackDoH(w, wire); req == nil {
+				return
+			}
+		} else if query.Get("name") != "" {
+			var err error
+			if req, err = jsonQuery(query.Get("name"), query.Get("type"), query.Get("do"), query.Get("cd")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			jsonAPI = true
+		} else {
+			http.Error(w, "missing dns or name parameter", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, dohContentType) {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		wire, err := io.ReadAll(io.LimitReader(r.Body, maxDoHRequestSize+1))
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if len(wire) > maxDoHRequestSize {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if req = unpackDoH(w, wire); req == nil {
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rw := newDoHResponseWriter(r, client)
+	e.HandleRequest(rw, req)
+	if rw.msg == nil {
+		http.Error(w, "no response", http.StatusInternalServerError)
+		return
+	}
+
+	if ttl, ok := minTTL(rw.msg); ok {
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(ttl), 10))
+	}
+	if jsonAPI {
+		w.Header().Set("Content-Type", dohJSONContentType)
+		if err := json.NewEncoder(w).Encode(newDoHJSONResponse(rw.msg)); err != nil {
+			log.Printf("Failed to write DoH JSON response: %v", err)
+		}
+		return
+	}
+
+	packed, err := rw.msg.Pack()
+	if err != nil {
+		http.Error(w, "failed to pack response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", dohContentType)
+	if _, err := w.Write(packed); err != nil {
+		log.Printf("Failed to write DoH response: %v", err)
+	}
+}
+
+// unpackDoH 解析报文格式的查询，失败时写回400并返回nil
+func unpackDoH(w http.ResponseWriter, wire []byte) *dns.Msg {
+	req := new(dns.Msg)
+	if err := req.Unpack(wire); err != nil {
+		http.Error(w, "invalid dns message", http.StatusBadRequest)
+		return nil
+	}
+	return req
+}
+
+// jsonQuery 根据JSON格式的查询参数构造查询报文，类型可为名称（AAAA）或数字（28），默认A
+func jsonQuery(name, qtype, do, cd string) (*dns.Msg, error) {
+	if _, ok := dns.IsDomainName(name); !ok {
+		return nil, fmt.Errorf("invalid name parameter")
+	}
+	t := dns.TypeA
+	if qtype != "" {
+		if v, ok := dns.StringToType[strings.ToUpper(qtype)]; ok {
+			t = v
+		} else if n, err := strconv.ParseUint(qtype, 10, 16); err == nil {
+			t = uint16(n)
+		} else {
+			return nil, fmt.Errorf("invalid type parameter")
+		}
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), t)
+	req.CheckingDisabled = isTrue(cd)
+	if isTrue(do) {
+		req.SetEdns0(maxUDPPayloadSize, true)
+	}
+	return req, nil
+}
+
+// isTrue 解析布尔查询参数（1/true）
+func isTrue(v string) bool {
+	return v == "1" || strings.EqualFold(v, "true")
+}
+
+// minTTL 返回应答中所有记录的最小TTL（不含OPT），没有记录时返回false
+func minTTL(m *dns.Msg) (uint32, bool) {
+	var ttl uint32
+	found := false
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			if !found || rr.Header().Ttl < ttl {
+				ttl, found = rr.Header().Ttl, true
+			}
+		}
+	}
+	return ttl, found
+}
+
+// -------------------------- JSON 格式 --------------------------
+// dohJSONResponse JSON格式应答（与常见公共DoH服务的 application/dns-json 格式一致）
+type dohJSONResponse struct {
+	Status    int               `json:"Status"`
+	TC        bool              `json:"TC"`
+	RD        bool              `json:"RD"`
+	RA        bool              `json:"RA"`
+	AD        bool              `json:"AD"`
+	CD        bool              `json:"CD"`
+	Question  []dohJSONQuestion `json:"Question"`
+	Answer    []dohJSONRR       `json:"Answer,omitempty"`
+	Authority []dohJSONRR       `json:"Authority,omitempty"`
+}
+
+type dohJSONQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+type dohJSONRR struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+func newDoHJSONResponse(m *dns.Msg) dohJSONResponse {
+	resp := dohJSONResponse{
+		Status: m.Rcode,
+		TC:     m.Truncated,
+		RD:     m.RecursionDesired,
+		RA:     m.RecursionAvailable,
+		AD:     m.AuthenticatedData,
+		CD:     m.CheckingDisabled,
+	}
+	for _, q := range m.Question {
+		resp.Question = append(resp.Question, dohJSONQuestion{Name: q.Name, Type: q.Qtype})
+	}
+	resp.Answer = jsonRRs(m.Answer)
+	resp.Authority = jsonRRs(m.Ns)
+	return resp
+}
+
+func jsonRRs(rrs []dns.RR) []dohJSONRR {
+	var out []dohJSONRR
+	for _, rr := range rrs {
+		h := rr.Header()
+		out = append(out, dohJSONRR{
+			Name: h.Name,
+			Type: h.Rrtype,
+			TTL:  h.Ttl,
+			Data: strings.TrimPrefix(rr.String(), h.String()),
+		})
+	}
+	return out
+}
+
+// -------------------------- ResponseWriter 适配 --------------------------
+// captureWriter 将 HandleRequest 写回的应答保存下来，由DoH/DoQ处理函数编码后返回
+// 远端地址使用TCP地址类型，应答按流式传输处理，不会按UDP大小截断
+type captureWriter struct {
+	local  net.Addr
+	remote net.Addr
+	msg    *dns.Msg
+	quic   bool // 来自DoQ连接（dnstap中区分DoH与DoQ）
+}
+
+func newCaptureWriter(local, remote net.Addr) *captureWriter {
+	return &captureWriter{local: local, remote: remote}
+}
+
+// newDoHResponseWriter 以HTTP请求的本地地址与客户端地址创建 captureWriter，client 无效时使用连接的远端地址
+func newDoHResponseWriter(r *http.Request, client netip.Addr) *captureWriter {
+	var local, remote net.Addr = &net.TCPAddr{}, &net.TCPAddr{}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		local = addr
+	}
+	if client.IsValid() {
+		remote = net.TCPAddrFromAddrPort(netip.AddrPortFrom(client.Unmap(), 0))
+	} else if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		remote = addr
+	}
+	return newCaptureWriter(local, remote)
+}
+
+func (w *captureWriter) LocalAddr() net.Addr  { return w.local }
+func (w *captureWriter) RemoteAddr() net.Addr { return w.remote }
+
+func (w *captureWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	w.msg = m
+	return len(b), nil
+}
+
+func (w *captureWriter) Close() error        { return nil }
+func (w *captureWriter) TsigStatus() error   { return errTSIGUnsupported }
+func (w *captureWriter) TsigTimersOnly(bool) {}
+func (w *captureWriter) Hijack()             {}
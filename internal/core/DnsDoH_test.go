@@ -0,0 +1,30 @@
+package core
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+// TestDoHResponseWriterClient 调用方解析出的客户端地址优先于连接的远端地址
+func TestDoHResponseWriterClient(t *testing.T) {
+	r := httptest.NewRequest("GET", "/dns-query", nil)
+	r.RemoteAddr = "127.0.0.1:40000"
+
+	tests := []struct {
+		name   string
+		client netip.Addr
+		want   string
+	}{
+		{name: "connection address", want: "127.0.0.1:40000"},
+		{name: "forwarded client", client: netip.MustParseAddr("198.51.100.7"), want: "198.51.100.7:0"},
+		{name: "IPv4-mapped client", client: netip.MustParseAddr("::ffff:198.51.100.7"), want: "198.51.100.7:0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newDoHResponseWriter(r, tt.client).RemoteAddr().String(); got != tt.want {
+				t.Errorf("RemoteAddr() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
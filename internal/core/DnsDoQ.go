@@ -0,0 +1,178 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// DoQ 错误码（RFC 9250 4.3）
+const (
+	doqNoError       quic.ApplicationErrorCode = 0x0
+	doqInternalError quic.ApplicationErrorCode = 0x1
+	doqProtocolError quic.ApplicationErrorCode = 0x2
+)
+
+const (
+	doqALPN               = "doq"            // RFC 9250 规定的ALPN
+	defaultDoQMaxStreams  = 100              // 每个连接默认允许的并发查询流数量
+	defaultDoQIdleTimeout = 30 * time.Second // 默认连接空闲超时
+)
+
+// -------------------------- DoQ 服务端（RFC 9250） --------------------------
+// doqServer DNS-over-QUIC 服务：每个双向流承载一个查询（2字节长度前缀 + DNS报文），经由 HandleRequest 处理
+type doqServer struct {
+	addr       string
+	tlsConfig  *tls.Config
+	quicConfig *quic.Config
+	handler    dns.Handler
+
+	mu       sync.Mutex
+	listener *quic.Listener
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// newDoQServer 创建DoQ服务，maxStreams 为每个连接的并发流上限，idleTimeout 为连接空闲超时
+func newDoQServer(addr string, tlsConfig *tls.Config, maxStreams int, idleTimeout time.Duration, handler dns.Handler) *doqServer {
+	if maxStreams <= 0 {
+		maxStreams = defaultDoQMaxStreams
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = defaultDoQIdleTimeout
+	}
+	tlsConfig.NextProtos = []string{doqALPN}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &doqServer{
+		addr:      addr,
+		tlsConfig: tlsConfig,
+		quicConfig: &quic.Config{
+			MaxIncomingStreams:    int64(maxStreams),
+			MaxIncomingUniStreams: -1, // DoQ 只使用双向流
+			MaxIdleTimeout:        idleTimeout,
+		},
+		handler: handler,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// ListenAndServe 监听并处理连接，Shutdown 后返回nil
+func (s *doqServer) ListenAndServe() error {
+	listener, err := quic.ListenAddr(s.addr, s.tlsConfig, s.quicConfig)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept(s.ctx)
+		if err != nil {
+			if s.ctx.Err() != nil || errors.Is(err, quic.ErrServerClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown 关闭监听及所有连接
+func (s *doqServer) Shutdown() error {
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// serveConn 处理一个连接上的所有查询流
+func (s *doqServer) serveConn(conn *quic.Conn) {
+	for {
+		stream, err := conn.AcceptStream(s.ctx)
+		if err != nil {
+			// 客户端关闭、空闲超时或服务关闭
+			_ = conn.CloseWithError(doqNoError, "")
+			return
+		}
+		go s.serveStream(conn, stream)
+	}
+}
+
+// serveStream 读取流上的查询，应答后关闭流；报文不合法或ID非0时以协议错误关闭连接
+func (s *doqServer) serveStream(conn *quic.Conn, stream *quic.Stream) {
+	_ = stream.SetDeadline(time.Now().Add(s.quicConfig.MaxIdleTimeout))
+
+	req, err := readDoQMsg(stream)
+	if err != nil {
+		log.Printf("Invalid DoQ query from %s: %v", conn.RemoteAddr(), err)
+		_ = conn.CloseWithError(doqProtocolError, err.Error())
+		return
+	}
+
+	w := newCaptureWriter(conn.LocalAddr(), streamAddr(conn.RemoteAddr()))
+	w.quic = true
+	s.handler.ServeDNS(w, req)
+	if w.msg == nil {
+		stream.CancelWrite(quic.StreamErrorCode(doqInternalError))
+		return
+	}
+
+	w.msg.Id = 0
+	packed, err := w.msg.Pack()
+	if err != nil {
+		log.Printf("Failed to pack DoQ response for %s: %v", conn.RemoteAddr(), err)
+		stream.CancelWrite(quic.StreamErrorCode(doqInternalError))
+		return
+	}
+	buf := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(buf, uint16(len(packed)))
+	copy(buf[2:], packed)
+	if _, err := stream.Write(buf); err != nil {
+		log.Printf("Failed to write DoQ response to %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	_ = stream.Close()
+}
+
+// readDoQMsg 读取2字节长度前缀的查询报文，RFC 9250 要求查询ID为0
+func readDoQMsg(r io.Reader) (*dns.Msg, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	wire := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, wire); err != nil {
+		return nil, err
+	}
+	req := new(dns.Msg)
+	if err := req.Unpack(wire); err != nil {
+		return nil, err
+	}
+	if req.Id != 0 {
+		return nil, fmt.Errorf("message id must be 0, got %d", req.Id)
+	}
+	return req, nil
+}
+
+// streamAddr 将QUIC连接的UDP地址转换为TCP地址类型，使应答按流式传输处理而不按UDP大小截断
+func streamAddr(addr net.Addr) net.Addr {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return &net.TCPAddr{IP: udp.IP, Port: udp.Port, Zone: udp.Zone}
+	}
+	return addr
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// doqFrame 为报文加上2字节长度前缀
+func doqFrame(wire []byte) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(wire))), wire...)
+}
+
+func TestReadDoQMsg(t *testing.T) {
+	pack := func(id uint16) []byte {
+		req := question("www.example.test.", dns.TypeA)
+		req.Id = id
+		wire, err := req.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wire
+	}
+	valid := pack(0)
+
+	tests := []struct {
+		name  string
+		input []byte
+		ok    bool
+	}{
+		{name: "valid query", input: doqFrame(valid), ok: true},
+		{name: "nonzero id", input: doqFrame(pack(1234))},
+		{name: "missing length", input: valid[:1]},
+		{name: "short message", input: doqFrame(valid)[:len(valid)]},
+		{name: "malformed message", input: doqFrame([]byte{0, 0, 1})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := readDoQMsg(bytes.NewReader(tt.input))
+			if (err == nil) != tt.ok {
+				t.Fatalf("readDoQMsg() error = %v, want ok = %v", err, tt.ok)
+			}
+			if tt.ok && (len(req.Question) != 1 || req.Question[0].Name != "www.example.test.") {
+				t.Errorf("readDoQMsg() = %v, want the www.example.test. query", req)
+			}
+		})
+	}
+}
+
+// TestDoQResponseNotTruncated DoQ应答按流式传输处理，不按UDP大小截断
+func TestDoQResponseNotTruncated(t *testing.T) {
+	remote := streamAddr(&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000})
+	tcp, ok := remote.(*net.TCPAddr)
+	if !ok || !tcp.IP.Equal(net.ParseIP("2001:db8::1")) || tcp.Port != 40000 {
+		t.Fatalf("streamAddr() = %#v, want a TCP address with the same IP and port", remote)
+	}
+	if isUDP(newCaptureWriter(&net.TCPAddr{}, remote)) {
+		t.Error("DoQ response writer is treated as UDP")
+	}
+}
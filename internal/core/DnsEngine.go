@@ -1,12 +1,18 @@
 package core
 
 import (
+	"context"
 	"dnsm/internal/conf"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
@@ -17,283 +23,495 @@ type IEngine interface {
 	Start() error
 	Stop() error
 	HandleRequest(w dns.ResponseWriter, req *dns.Msg)
-	FindRecord(qname string, qtype uint16) (*conf.Record, bool)
+	FindRecord(view, qname string, qtype uint16) (*Record, bool)
 	IsDomainConfigured(qname string) bool
 	ForwardRequest(req *dns.Msg) (*dns.Msg, error)
 	Match(qname, rule string) bool
 }
 
+// maxUDPPayloadSize 本服务通过EDNS0通告的UDP报文上限（DNS Flag Day 2020 推荐值）
+const maxUDPPayloadSize = 1232
+
 // DefaultDNSEngine 是DNSEngine接口的默认实现
 type DNSEngine struct {
-	conf   *conf.Config
-	server *dns.Server
+	conf         *conf.Config
+	manager      DNSManager                       // 本地域名数据源（动态更新经由其写入并持久化）
+	index        atomic.Pointer[zoneIndex]        // 默认视图的本地解析索引（由DNSManager变更回调重建并发布）
+	views        atomic.Pointer[viewTable]        // 解析视图及各视图的解析索引（随域名数据与视图配置重建）
+	viewMu       sync.Mutex                       // 串行化解析索引与视图表的重建
+	cache        *DNSCache                        // 转发响应缓存（未启用时为nil）
+	forwarder    atomic.Pointer[UpstreamGroup]    // 默认上游组（配置重载时整体替换）
+	forwardZones atomic.Pointer[forwardZoneTable] // 条件转发规则表（由DNSManager变更回调重建并发布）
+	fwdMu        sync.Mutex                       // 串行化上游组与条件转发规则表的重建
+	acl          atomic.Pointer[aclTable]         // 查询访问控制规则（配置重载时整体替换）
+	refused      *refusedCounter                  // 按客户端统计被拒绝的查询
+	limiter      atomic.Pointer[queryLimiter]     // 查询限速与RRL（配置重载时整体替换）
+	limited      *limitCounter                    // 按客户端网段统计被限速的查询与应答
+	blocklist    *Blocklist                       // 域名拦截列表
+	rpz          *RPZ                             // 响应策略区域
+	secondary    *Secondaries                     // 从区域同步
+	queryLog     *QueryLog                        // 查询日志
+	dnstap       *Dnstap                          // dnstap 输出
+	tsig         *tsigKeyring                     // TSIG密钥（配置重载时替换）
+	metrics      *engineMetrics                   // 查询指标
+	notifyMu     sync.Mutex                       // 保护serials
+	serials      map[string]uint32                // 各区域最近一次发布的序列号（用于判断是否需要发送NOTIFY）
+	mu           sync.Mutex                       // 保护servers、dohServer、doqServer与stopWorkers
+	servers      []*dns.Server                    // 监听中的服务（UDP/TCP/DoT）
+	dohServer    *http.Server                     // 独立监听的DoH服务（未启用或挂载在gin上时为nil）
+	doqServer    *doqServer                       // DoQ服务（未启用时为nil）
+	stopWorkers  context.CancelFunc               // 停止后台任务（拦截列表与RPZ的定时刷新、从区域同步、查询日志与dnstap写入）
 }
 
 // New 创建一个新的DNSEngine实例
-func New(conf *conf.Config) *DNSEngine {
-	return &DNSEngine{
-		conf: conf,
+// 本地解析数据以manager为唯一数据源，manager的每次变更都会同步发布到引擎
+func New(conf *conf.Config, manager DNSManager) *DNSEngine {
+	e := &DNSEngine{
+		conf:      conf,
+		manager:   manager,
+		cache:     NewDNSCache(conf.Cache),
+		refused:   newRefusedCounter(),
+		limited:   newLimitCounter(),
+		blocklist: NewBlocklist(conf.GetBlocklist()),
+		rpz:       NewRPZ(conf.GetRPZ()),
+		queryLog:  NewQueryLog(conf.GetQueryLog()),
+		dnstap:    NewDnstap(conf.GetDnstap()),
+		tsig:      newTSIGKeyring(conf.GetTSIGKeys()),
+		metrics:   newEngineMetrics(),
 	}
+	e.acl.Store(buildACLTable(conf.GetServer().ACL))
+	e.limiter.Store(newQueryLimiter(conf.GetServer().RateLimit))
+	e.index.Store(buildZoneIndex(nil))
+	e.views.Store(buildViewTable(nil, nil))
+	e.forwarder.Store(NewUpstreamGroup(conf.GetForward(), nil))
+	e.forwardZones.Store(buildForwardZoneTable(nil, conf.GetForward(), nil))
+	e.secondary = NewSecondaries(manager, e.tsig)
+	manager.OnChange(e.OnDomainsChanged)
+	manager.OnForwardZonesChange(e.OnForwardZonesChanged)
+	return e
 }
 
 // Start 实现DNSEngine接口的Start方法
+// 在同一地址上同时监听UDP和TCP，按配置启用DoT、DoQ与独立的DoH监听，任一监听失败时关闭其余监听并返回错误
 func (e *DNSEngine) Start() error {
+	cfg := e.conf.GetServer()
 	// 确保 conf.C.Server.Host 是有效的 IP 地址或为空(默认所有接口)
 	addr := ":53" // 默认监听所有接口的 53 端口
-	if e.conf.Server.Host != "" {
-		addr = net.JoinHostPort(e.conf.Server.Host, strconv.Itoa(e.conf.Server.Port))
+	if cfg.Host != "" {
+		addr = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	}
+
+	handler := dns.HandlerFunc(e.HandleRequest) // 所有请求都由HandleRequest处理
+	servers := []*dns.Server{
+		{Addr: addr, Net: "udp", Handler: handler, TsigProvider: e.tsig, MsgAcceptFunc: acceptMsg},
+		{Addr: addr, Net: "tcp", Handler: handler, TsigProvider: e.tsig, MsgAcceptFunc: acceptMsg},
+	}
+
+	// DoT、DoQ 与独立监听的 DoH 共用同一份证书
+	var dohServer *http.Server
+	var doq *doqServer
+	if cfg.DoT.Enabled || cfg.DoQ.Enabled || (cfg.DoH.Enabled && cfg.DoH.Port > 0) {
+		certs, err := newCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return err
+		}
+		if cfg.DoT.Enabled {
+			servers = append(servers, &dns.Server{
+				Addr:          net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.DoT.Port)),
+				Net:           "tcp-tls",
+				TLSConfig:     certs.tlsConfig(),
+				Handler:       handler,
+				TsigProvider:  e.tsig,
+				MsgAcceptFunc: acceptMsg,
+			})
+		}
+		if cfg.DoH.Enabled && cfg.DoH.Port > 0 {
+			mux := http.NewServeMux()
+			mux.HandleFunc(cfg.DoH.Path, e.ServeDoH)
+			dohServer = &http.Server{
+				Addr:              net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.DoH.Port)),
+				Handler:           mux,
+				TLSConfig:         certs.tlsConfig(),
+				ReadHeaderTimeout: 5 * time.Second,
+			}
+		}
+		if cfg.DoQ.Enabled {
+			doq = newDoQServer(net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.DoQ.Port)), certs.tlsConfig(),
+				cfg.DoQ.MaxStreams, cfg.DoQ.IdleTimeout, handler)
+		}
 	}
 
-	e.server = &dns.Server{Addr: addr, Net: "udp"}
-	dns.HandleFunc(".", e.HandleRequest) // 所有请求都由HandleRequest处理
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	e.mu.Lock()
+	e.servers = servers
+	e.dohServer = dohServer
+	e.doqServer = doq
+	e.stopWorkers = stopWorkers
+	e.mu.Unlock()
+	go e.blocklist.Run(workerCtx)
+	go e.rpz.Run(workerCtx)
+	go e.secondary.Run(workerCtx)
+	go e.queryLog.Run(workerCtx)
+	go e.dnstap.Run(workerCtx)
+
+	errCh := make(chan error, len(servers)+2)
+	for _, server := range servers {
+		log.Printf("Starting DNS server on %s/%s\n", server.Addr, server.Net)
+		go func(s *dns.Server) {
+			if err := s.ListenAndServe(); err != nil {
+				errCh <- fmt.Errorf("%s listener on %s: %w", s.Net, s.Addr, err)
+				return
+			}
+			errCh <- nil
+		}(server)
+	}
+	if dohServer != nil {
+		log.Printf("Starting DNS-over-HTTPS server on %s%s\n", dohServer.Addr, cfg.DoH.Path)
+		go func() {
+			if err := dohServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("doh listener on %s: %w", dohServer.Addr, err)
+				return
+			}
+			errCh <- nil
+		}()
+	}
+	if doq != nil {
+		log.Printf("Starting DNS-over-QUIC server on %s\n", doq.addr)
+		go func() {
+			if err := doq.ListenAndServe(); err != nil {
+				errCh <- fmt.Errorf("doq listener on %s: %w", doq.addr, err)
+				return
+			}
+			errCh <- nil
+		}()
+	}
 
-	log.Printf("Starting DNS server on %s\n", addr)
-	return e.server.ListenAndServe()
+	// 等待第一个退出的监听：正常关闭时返回nil，异常时关闭其余监听
+	err := <-errCh
+	if err != nil {
+		_ = e.Stop()
+	}
+	return err
 }
 
 // Stop 实现DNSEngine接口的Stop方法
 func (e *DNSEngine) Stop() error {
-	if e.server != nil {
-		log.Println("Stopping DNS server...")
-		return e.server.Shutdown()
+	e.mu.Lock()
+	servers, dohServer, doq := e.servers, e.dohServer, e.doqServer
+	e.servers, e.dohServer, e.doqServer = nil, nil, nil
+	if e.stopWorkers != nil {
+		e.stopWorkers()
+		e.stopWorkers = nil
+	}
+	e.mu.Unlock()
+
+	if len(servers) == 0 && dohServer == nil && doq == nil {
+		return nil
+	}
+
+	log.Println("Stopping DNS server...")
+	var errs []error
+	for _, server := range servers {
+		// 未成功启动的监听会返回 "server not started"，关闭时忽略
+		if err := server.Shutdown(); err != nil && !strings.Contains(err.Error(), "not started") {
+			errs = append(errs, fmt.Errorf("%s listener: %w", server.Net, err))
+		}
 	}
-	return nil
+	if dohServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := dohServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("doh listener: %w", err))
+		}
+	}
+	if doq != nil {
+		if err := doq.Shutdown(); err != nil {
+			errs = append(errs, fmt.Errorf("doq listener: %w", err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // HandleRequest 实现DNSEngine接口的HandleRequest方法
 func (e *DNSEngine) HandleRequest(w dns.ResponseWriter, req *dns.Msg) {
-	m := new(dns.Msg)
-	m.SetReply(req)
-	m.RecursionAvailable = true
-
-	// 获取第一个问题
+	start := time.Now()
+	e.dnstap.clientQuery(w, req, start)
+	// 没有问题部分的报文格式错误，在访问控制之前应答FORMERR，不计入被拒绝的客户端
 	if len(req.Question) == 0 {
-		_ = w.WriteMsg(m) // 忽略写入错误
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeFormatError)
+		e.writeMsg(w, req, m)
 		return
 	}
 
-	question := req.Question[0]
-	qname := question.Name // 如: www.muname.com.
-	qtype := question.Qtype
-
-	// 1. 首先判断请求的域名是否在本地配置范围内
-	if e.IsDomainConfigured(qname) {
-		// 2a. 如果在本地配置范围内，则尝试查找匹配的记录
-		foundRecord := false // 标记是否找到了匹配且类型正确的记录
-
-		// 查找匹配的记录，优先精确匹配，然后是泛解析匹配
-		record, found := e.FindRecord(qname, qtype)
-		if found {
-			// 根据记录类型创建相应的DNS记录
-			switch record.Type {
-			case "A":
-				if qtype == dns.TypeA {
-					ip := net.ParseIP(record.Value)
-					if ip != nil && ip.To4() != nil {
-						rr := &dns.A{
-							Hdr: dns.RR_Header{
-								Name:   qname,
-								Rrtype: dns.TypeA,
-								Class:  dns.ClassINET,
-								Ttl:    uint32(record.TTL),
-							},
-							A: ip.To4(),
-						}
-						m.Answer = append(m.Answer, rr)
-						foundRecord = true
-					}
-				}
-			case "AAAA":
-				if qtype == dns.TypeAAAA {
-					ip := net.ParseIP(record.Value)
-					if ip != nil && ip.To16() != nil {
-						rr := &dns.AAAA{
-							Hdr: dns.RR_Header{
-								Name:   qname,
-								Rrtype: dns.TypeAAAA,
-								Class:  dns.ClassINET,
-								Ttl:    uint32(record.TTL),
-							},
-							AAAA: ip.To16(),
-						}
-						m.Answer = append(m.Answer, rr)
-						foundRecord = true
-					}
-				}
-			case "CNAME":
-				if qtype == dns.TypeCNAME {
-					// 确保 CNAME 值以 . 结尾（FQDN）
-					cnameValue := record.Value
-					if !strings.HasSuffix(cnameValue, ".") {
-						cnameValue += "."
-					}
-
-					rr := &dns.CNAME{
-						Hdr: dns.RR_Header{
-							Name:   qname,
-							Rrtype: dns.TypeCNAME,
-							Class:  dns.ClassINET,
-							Ttl:    uint32(record.TTL),
-						},
-						Target: cnameValue,
-					}
-					m.Answer = append(m.Answer, rr)
-					foundRecord = true
-				}
-			case "TXT":
-				if qtype == dns.TypeTXT {
-					rr := &dns.TXT{
-						Hdr: dns.RR_Header{
-							Name:   qname,
-							Rrtype: dns.TypeTXT,
-							Class:  dns.ClassINET,
-							Ttl:    uint32(record.TTL),
-						},
-						Txt: []string{record.Value},
-					}
-					m.Answer = append(m.Answer, rr)
-					foundRecord = true
-				}
-				// 其他记录类型的处理可以在这里添加
-			}
+	// 访问控制按连接的远端地址判断（不采信EDNS Client Subnet）
+	client, _ := clientAddr(w, req, false)
+	acl := e.acl.Load()
+	if reason, ok := acl.check(client); !ok {
+		e.finishQuery(req, e.refuse(w, req, client, reason), client, start, queryInfo{source: QuerySourceRefused})
+		return
+	}
+	recursion := acl.recursion(client)
+
+	// 按客户端网段限速：超限的UDP查询直接丢弃，其他传输方式返回REFUSED
+	if prefix, ok := e.limiter.Load().allow(client); !ok {
+		e.limited.add(prefix, func(s *RateLimitStats) { s.Throttled++ })
+		var m *dns.Msg
+		if !isUDP(w) {
+			m = new(dns.Msg)
+			m.SetRcode(req, dns.RcodeRefused)
+			e.writeMsg(w, req, m)
 		}
+		e.finishQuery(req, m, client, start, queryInfo{source: QuerySourceLimited})
+		return
+	}
 
-		if !foundRecord {
-			// 域名匹配但在本地配置中没找到对应 qtype 的记录 -> NOERROR, 空 Answer
-			m.SetRcode(req, dns.RcodeSuccess)
-		}
+	// 动态更新（RFC 2136）
+	if req.Opcode == dns.OpcodeUpdate {
+		e.finishQuery(req, e.handleUpdate(w, req, client), client, start, queryInfo{source: QuerySourceUpdate})
+		return
+	}
+
+	// 区域变更通知（RFC 1996）
+	if req.Opcode == dns.OpcodeNotify {
+		e.finishQuery(req, e.handleNotify(w, req, client), client, start, queryInfo{source: QuerySourceNotify})
+		return
+	}
 
-	} else {
-		// 如果不在本地配置范围内，则直接转发请求
-		upstreamResp, err := e.ForwardRequest(req)
-		if err != nil || upstreamResp == nil {
-			log.Printf("Error forwarding request for %s: %v", qname, err)
-			m.SetRcode(req, dns.RcodeServerFailure)
-			m.RecursionAvailable = false
-		} else {
-			// 直接使用上游响应的 Answer、Authority、Additional
-			m.Answer = upstreamResp.Answer
-			m.Ns = upstreamResp.Ns
-			m.Extra = upstreamResp.Extra
-			m.Rcode = upstreamResp.Rcode
+	// 区域传送（AXFR/IXFR）
+	if len(req.Question) == 1 && (req.Question[0].Qtype == dns.TypeAXFR || req.Question[0].Qtype == dns.TypeIXFR) {
+		e.finishQuery(req, e.handleTransfer(w, req, client), client, start, queryInfo{source: QuerySourceTransfer})
+		return
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.RecursionAvailable = recursion
+
+	// 1. 首先尝试按客户端所属视图的本地区域权威应答
+	info := queryInfo{source: QuerySourceLocal}
+	idx := e.viewIndex(w, req)
+	if !e.answerLocal(idx, m, req, recursion) {
+		// 2. 如果不在本地配置范围内，则转发请求（客户端不允许递归时拒绝）
+		if !recursion {
+			e.finishQuery(req, e.refuse(w, req, client, RefusedRecursion), client, start, queryInfo{source: QuerySourceRefused})
+			return
+		}
+		if !e.resolve(idx, m, req, client, &info) {
+			e.finishQuery(req, nil, client, start, info)
+			return
 		}
 	}
 
-	err := w.WriteMsg(m)
-	if err != nil {
-		log.Printf("Failed to write DNS response for %s: %v", qname, err)
+	if !e.writeRateLimited(w, req, m, client) {
+		// 应答被RRL丢弃
+		info.source = QuerySourceLimited
+		m = nil
 	}
+	e.finishQuery(req, m, client, start, info)
 }
 
-// FindRecord 实现DNSEngine接口的FindRecord方法
-func (e *DNSEngine) FindRecord(qname string, qtype uint16) (*conf.Record, bool) {
-	// 使用线程安全的方法获取域名配置
-	domains := e.conf.GetDomains()
-	// 遍历所有本地配置的域名
-	for _, domainConfig := range domains {
-		// 先查找精确匹配的记录
-		for _, record := range domainConfig.Records {
-			// 检查记录名是否精确匹配 qname
-			recordName := strings.ToLower(strings.TrimSuffix(record.Name, "."))
-			queryName := strings.ToLower(strings.TrimSuffix(qname, "."))
-
-			if recordName == queryName { // 精确匹配
-				// 检查记录类型是否匹配查询类型
-				switch record.Type {
-				case "A":
-					if qtype == dns.TypeA {
-						return &record, true
-					}
-				case "AAAA":
-					if qtype == dns.TypeAAAA {
-						return &record, true
-					}
-				case "CNAME":
-					if qtype == dns.TypeCNAME {
-						return &record, true
-					}
-				case "TXT":
-					if qtype == dns.TypeTXT {
-						return &record, true
-					}
-					// 其他记录类型的检查可以在这里添加
-				}
-			}
+// resolve 应答需要递归的查询：RPZ的QNAME规则优先，其次为拦截列表，然后转发上游并对上游应答应用RPZ的应答规则；
+// 应答来源记录到info，返回false表示按策略丢弃查询，不作应答
+func (e *DNSEngine) resolve(idx *zoneIndex, m, req *dns.Msg, client netip.Addr, info *queryInfo) bool {
+	qname := req.Question[0].Name // 如: www.muname.com.
+	policy := e.rpz.policy()
+	if hit := policy.matchQName(qname); hit != nil {
+		logRPZHit(hit, qname, client)
+		if hit.rule.action != RPZActionPassthru {
+			info.source = QuerySourceRPZ
+			return e.applyRPZ(idx, m, req, hit, nil)
 		}
+		// PASSTHRU：不再检查拦截列表与上游应答
+		policy = nil
+	} else if check, blocked := e.blocklist.match(qname); blocked {
+		log.Printf("Blocked query for %s by rule %s from %s", qname, check.Rule, check.Source)
+		e.blocklist.answer(m, req.Question[0])
+		info.source = QuerySourceBlocked
+		return true
+	}
 
-		// 如果没有找到精确匹配，再查找泛解析匹配
-		for _, record := range domainConfig.Records {
-			// 检查记录名是否是泛解析并且匹配 qname
-			if strings.HasPrefix(record.Name, "*") && e.Match(qname, record.Name) {
-				// 检查记录类型是否匹配查询类型
-				switch record.Type {
-				case "A":
-					if qtype == dns.TypeA {
-						return &record, true
-					}
-				case "AAAA":
-					if qtype == dns.TypeAAAA {
-						return &record, true
-					}
-					// 其他记录类型的检查可以在这里添加
-				}
+	upstreamResp, upstream, err := e.forward(req)
+	info.source, info.upstream = QuerySourceUpstream, upstream
+	if err == nil && upstream == "" {
+		info.source = QuerySourceCache
+	}
+	if err != nil || upstreamResp == nil {
+		log.Printf("Error forwarding request for %s: %v", qname, err)
+		m.SetRcode(req, dns.RcodeServerFailure)
+		m.RecursionAvailable = false
+		return true
+	}
+	// 直接使用上游响应的 Answer、Authority、Additional
+	m.Answer = upstreamResp.Answer
+	m.Ns = upstreamResp.Ns
+	m.Extra = upstreamResp.Extra
+	m.Rcode = upstreamResp.Rcode
+
+	if policy != nil {
+		if hit, chain := e.rpzResponse(policy, qname, upstreamResp); hit != nil {
+			logRPZHit(hit, qname, client)
+			if hit.rule.action != RPZActionPassthru {
+				info.source = QuerySourceRPZ
+				return e.applyRPZ(idx, m, req, hit, chain)
 			}
 		}
 	}
+	return true
+}
+
+// writeMsg 写回响应：补齐EDNS0，并在UDP下按客户端通告的大小截断（设置TC位让客户端改用TCP重试）
+func (e *DNSEngine) writeMsg(w dns.ResponseWriter, req, m *dns.Msg) {
+	if opt := req.IsEdns0(); opt != nil && m.IsEdns0() == nil {
+		m.SetEdns0(maxUDPPayloadSize, opt.Do())
+	}
+
+	if isUDP(w) {
+		m.Truncate(udpSize(req))
+	}
+
+	if err := w.WriteMsg(m); err != nil {
+		name := ""
+		if len(req.Question) > 0 {
+			name = req.Question[0].Name
+		}
+		log.Printf("Failed to write DNS response for %s: %v", name, err)
+		return
+	}
+	e.dnstap.clientResponse(w, m)
+}
+
+// isUDP 判断请求是否来自UDP监听
+func isUDP(w dns.ResponseWriter) bool {
+	_, ok := w.RemoteAddr().(*net.UDPAddr)
+	return ok
+}
+
+// udpSize 返回客户端可接收的UDP响应大小（未携带EDNS0时为512字节）
+func udpSize(req *dns.Msg) int {
+	size := dns.MinMsgSize
+	if opt := req.IsEdns0(); opt != nil && int(opt.UDPSize()) > size {
+		size = int(opt.UDPSize())
+	}
+	return size
+}
 
-	return nil, false
+// FindRecord 实现DNSEngine接口的FindRecord方法
+// 在指定视图中查找（视图记录优先，其次为默认视图记录），view 为空时只查找默认视图
+func (e *DNSEngine) FindRecord(view, qname string, qtype uint16) (*Record, bool) {
+	idx, ok := e.indexOf(view)
+	if !ok {
+		return nil, false
+	}
+	// 查找匹配的记录，优先精确匹配，然后是泛解析匹配
+	records := idx.lookup(canonicalName(qname), qtype)
+	if len(records) == 0 {
+		return nil, false
+	}
+	record := records[0].Record
+	return &record, true
 }
 
-// IsDomainConfigured 实现DNSEngine接口的IsDomainConfigured方法
+// IsDomainConfigured 实现DNSEngine接口的IsDomainConfigured方法，名称在任一视图中由本地负责即返回true
 func (e *DNSEngine) IsDomainConfigured(qname string) bool {
-	// 使用线程安全的方法获取域名配置
-	domains := e.conf.GetDomains()
-	// 遍历所有本地配置的域名
-	for _, domainConfig := range domains {
-		for _, record := range domainConfig.Records {
-			if e.Match(qname, record.Name) {
-				return true // 找到匹配的记录名，也认为是本地配置的域
-			}
+	name := canonicalName(qname)
+	if e.index.Load().contains(name) {
+		return true
+	}
+	for _, v := range e.views.Load().views {
+		if v.index.contains(name) {
+			return true
 		}
 	}
-	return false // 没有在本地配置中找到匹配的域
+	return false
 }
 
 // DefaultDNSForwarder 是DNSForwarder接口的默认实现
 type DefaultDNSForwarder struct{}
 
 // ForwardRequest 实现DNSForwarder接口的ForwardRequest方法
+// 优先从缓存应答，未命中时按条件转发规则（未匹配时使用默认上游）转发并缓存结果
 func (e *DNSEngine) ForwardRequest(req *dns.Msg) (*dns.Msg, error) {
-	client := &dns.Client{
-		Net:          "udp",
-		DialTimeout:  3 * time.Second,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 5 * time.Second,
+	resp, _, err := e.forward(req)
+	return resp, err
+}
+
+// forward 同 ForwardRequest，同时返回实际使用的上游地址（缓存命中时为空）
+func (e *DNSEngine) forward(req *dns.Msg) (*dns.Msg, string, error) {
+	if len(req.Question) == 0 {
+		return nil, "", fmt.Errorf("request has no question")
+	}
+	if resp, ok := e.cache.Get(req); ok {
+		return resp, "", nil
 	}
 
-	// 使用线程安全的方法获取上游DNS服务器列表
-	upstreams := e.conf.GetUpstream()
-	for _, upstream := range upstreams {
-		log.Printf("Attempting to forward query to upstream server: %s", upstream)
+	resp, upstream, err := e.forwarderFor(req.Question[0].Name).Exchange(req, e.dnstap)
+	if err != nil {
+		return nil, upstream, err
+	}
+	e.cache.Set(req, resp)
+	return resp, upstream, nil
+}
 
-		// 复制原始请求（避免修改原 req）
-		reqCopy := req.Copy()
+// ReloadConfig 配置文件重载后重建访问控制规则、限速器、解析视图、拦截列表、RPZ、查询日志、dnstap配置与TSIG密钥、默认上游组与条件转发规则表（沿用已有上游的统计与熔断状态）
+func (e *DNSEngine) ReloadConfig() {
+	e.ReloadACL()
+	e.ReloadRateLimit()
+	e.ReloadViews()
+	e.blocklist.Configure(e.conf.GetBlocklist())
+	e.rpz.Configure(e.conf.GetRPZ())
+	e.queryLog.Configure(e.conf.GetQueryLog())
+	e.dnstap.Configure(e.conf.GetDnstap())
+	e.tsig.configure(e.conf.GetTSIGKeys())
+
+	e.fwdMu.Lock()
+	defer e.fwdMu.Unlock()
+
+	forward := e.conf.GetForward()
+	e.forwarder.Store(NewUpstreamGroup(forward, e.forwarder.Load()))
+	previous := e.forwardZones.Load()
+	e.forwardZones.Store(buildForwardZoneTable(previous.rules, forward, previous))
+}
 
-		resp, _, err := client.Exchange(reqCopy, upstream)
-		if err != nil {
-			log.Printf("Failed to exchange with upstream %s: %v", upstream, err)
-			continue
-		}
-		if resp == nil {
-			log.Printf("Upstream %s returned a nil response message", upstream)
-			continue
+// UpstreamStats 返回各上游的运行状态（默认上游在前，条件转发规则的上游标注所属后缀）
+func (e *DNSEngine) UpstreamStats() []UpstreamStats {
+	stats := e.forwarder.Load().Stats()
+	table := e.forwardZones.Load()
+	for _, rule := range table.rules {
+		zone := canonicalName(rule.Name)
+		for _, s := range table.groups[zone].Stats() {
+			s.Zone = zone
+			stats = append(stats, s)
 		}
+	}
+	return stats
+}
 
-		log.Printf("Successfully forwarded query to %s", upstream)
-		return resp, nil
+// OnDomainsChanged 本地域名数据变更回调：重建并发布默认视图与各解析视图的索引，清除已变为本地解析的名称的缓存，
+// 向序列号变化的区域的从服务器发送NOTIFY，并通知从区域同步比对配置
+// 回调在DNSManager释放写锁后、变更操作返回前同步执行，因此变更对下一次查询立即生效
+func (e *DNSEngine) OnDomainsChanged(domains []Domain) {
+	e.viewMu.Lock()
+	e.index.Store(buildZoneIndex(viewDomains(domains, "")))
+	e.views.Store(buildViewTable(e.conf.GetViews(), domains))
+	e.viewMu.Unlock()
+
+	removed := e.cache.Purge(e.IsDomainConfigured)
+	if removed > 0 {
+		log.Printf("Purged %d cached responses now served locally", removed)
 	}
+	e.notifySecondaries(domains)
+	e.secondary.Wake()
+}
+
+// CacheStats 返回转发缓存统计信息
+func (e *DNSEngine) CacheStats() CacheStats {
+	return e.cache.Stats()
+}
 
-	return nil, fmt.Errorf("failed to get a valid response from any of the configured upstream servers")
+// FlushCache 清空转发缓存
+func (e *DNSEngine) FlushCache() {
+	e.cache.Flush()
 }
 
 // Match 实现DomainMatcher接口的Match方法
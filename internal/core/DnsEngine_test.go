@@ -0,0 +1,61 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// TestLargeResponseTruncation UDP应答按客户端通告的大小截断并设置TC位，TCP应答不截断
+func TestLargeResponseTruncation(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("domains:\n    - name: example.test\n      records:\n")
+	for i := range 20 {
+		fmt.Fprintf(&b, "        - name: big.example.test\n          type: TXT\n          value: %s-%02d\n          ttl: 300\n", strings.Repeat("x", 60), i)
+	}
+	e := newTestEngine(t, nil, b.String())
+
+	tests := []struct {
+		name      string
+		tcp       bool
+		edns      uint16
+		truncated bool
+	}{
+		{name: "udp without edns", truncated: true},
+		{name: "udp with small edns buffer", edns: 1000, truncated: true},
+		{name: "udp with large edns buffer", edns: 4096},
+		{name: "tcp", tcp: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := question("big.example.test.", dns.TypeTXT)
+			if tt.edns > 0 {
+				req.SetEdns0(tt.edns, false)
+			}
+			var w *captureWriter
+			if tt.tcp {
+				w = newCaptureWriter(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}, &net.TCPAddr{IP: net.IPv4(192, 0, 2, 10), Port: 40000})
+			} else {
+				w = newCaptureWriter(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}, &net.UDPAddr{IP: net.IPv4(192, 0, 2, 10), Port: 40000})
+			}
+			e.HandleRequest(w, req)
+			resp := w.msg
+			if resp == nil {
+				t.Fatal("no response")
+			}
+			if resp.Truncated != tt.truncated {
+				t.Errorf("TC = %v, want %v", resp.Truncated, tt.truncated)
+			}
+			if tt.truncated {
+				if size := udpSize(req); resp.Len() > size {
+					t.Errorf("truncated response is %d bytes, want at most %d", resp.Len(), size)
+				}
+			} else if len(resp.Answer) != 20 {
+				t.Errorf("got %d TXT records, want 20", len(resp.Answer))
+			}
+		})
+	}
+}
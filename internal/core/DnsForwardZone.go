@@ -0,0 +1,243 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// -------------------------- 基础数据结构 --------------------------
+// ForwardZone 条件转发规则：以 Name 为后缀的查询转发到指定上游（与配置文件 forward_zones 映射）
+type ForwardZone struct {
+	Name      string   `mapstructure:"name" yaml:"name"`                   // 域名后缀，如 corp.example.com
+	Upstreams []string `mapstructure:"upstreams" yaml:"upstreams"`         // 上游地址列表（host:port）
+	Strategy  string   `mapstructure:"strategy" yaml:"strategy,omitempty"` // 上游选择策略，默认 forward.strategy
+	Timeout   string   `mapstructure:"timeout" yaml:"timeout,omitempty"`   // 单次查询超时（如 2s），默认 forward.timeout
+}
+
+// ForwardZoneListener 条件转发规则变更回调，参数为变更后的全部规则
+// 与 ChangeListener 相同，回调在管理器写锁释放后按变更顺序依次执行，回调中不得修改DNSManager的数据
+type ForwardZoneListener func(zones []ForwardZone)
+
+// Validate 校验条件转发规则
+func (z ForwardZone) Validate() error {
+	if strings.TrimSpace(z.Name) == "" {
+		return fmt.Errorf("转发域名不能为空")
+	}
+	if _, ok := dns.IsDomainName(z.Name); !ok {
+		return fmt.Errorf("转发域名 %s 不合法", z.Name)
+	}
+	if len(z.Upstreams) == 0 {
+		return fmt.Errorf("转发域名 %s 至少需要一个上游", z.Name)
+	}
+	for _, addr := range z.Upstreams {
+		if _, err := parseUpstreamAddr(addr); err != nil {
+			return err
+		}
+	}
+	switch z.Strategy {
+	case "", StrategySequential, StrategyParallel, StrategyRoundRobin, StrategyFastest:
+	default:
+		return fmt.Errorf("不支持的上游选择策略: %s", z.Strategy)
+	}
+	if z.Timeout != "" {
+		if d, err := time.ParseDuration(z.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("超时时间 %s 不合法", z.Timeout)
+		}
+	}
+	return nil
+}
+
+// equal 判断两条规则是否完全相同
+func (z ForwardZone) equal(other ForwardZone) bool {
+	return z.Name == other.Name && z.Strategy == other.Strategy && z.Timeout == other.Timeout &&
+		slices.Equal(z.Upstreams, other.Upstreams)
+}
+
+// forwardConfig 以全局转发配置为默认值，生成该规则的上游组配置
+func (z ForwardZone) forwardConfig(global conf.ForwardConfig) conf.ForwardConfig {
+	cfg := global
+	if z.Strategy != "" {
+		cfg.Strategy = z.Strategy
+	}
+	if d, err := time.ParseDuration(z.Timeout); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	cfg.Upstreams = make([]conf.UpstreamConfig, 0, len(z.Upstreams))
+	for _, addr := range z.Upstreams {
+		cfg.Upstreams = append(cfg.Upstreams, conf.UpstreamConfig{Address: addr})
+	}
+	return cfg
+}
+
+// -------------------------- 引擎侧：后缀匹配 --------------------------
+// forwardZoneTable 条件转发规则表（按规范化后缀索引）
+type forwardZoneTable struct {
+	rules  []ForwardZone
+	groups map[string]*UpstreamGroup
+}
+
+// buildForwardZoneTable 构建规则表，previous 中同名规则的上游统计状态会被沿用
+func buildForwardZoneTable(rules []ForwardZone, global conf.ForwardConfig, previous *forwardZoneTable) *forwardZoneTable {
+	t := &forwardZoneTable{rules: rules, groups: make(map[string]*UpstreamGroup, len(rules))}
+	for _, rule := range rules {
+		name := canonicalName(rule.Name)
+		var prev *UpstreamGroup
+		if previous != nil {
+			prev = previous.groups[name]
+		}
+		t.groups[name] = NewUpstreamGroup(rule.forwardConfig(global), prev)
+	}
+	return t
+}
+
+// match 按最长后缀匹配查询名称，名为 "." 的规则匹配所有名称，未匹配时返回nil
+func (t *forwardZoneTable) match(qname string) (string, *UpstreamGroup) {
+	if len(t.groups) == 0 {
+		return "", nil
+	}
+	name := canonicalName(qname)
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if g, ok := t.groups[name[off:]]; ok {
+			return name[off:], g
+		}
+	}
+	// NextLabel 在最后一个标签之后结束，根区域需单独检查
+	if g, ok := t.groups["."]; ok {
+		return ".", g
+	}
+	return "", nil
+}
+
+// OnForwardZonesChanged 条件转发规则变更回调：重建并发布规则表，并清空缓存中可能已改由其他上游解析的应答
+func (e *DNSEngine) OnForwardZonesChanged(zones []ForwardZone) {
+	e.fwdMu.Lock()
+	defer e.fwdMu.Unlock()
+
+	previous := e.forwardZones.Load()
+	if slices.EqualFunc(zones, previous.rules, ForwardZone.equal) {
+		return
+	}
+	e.forwardZones.Store(buildForwardZoneTable(zones, e.conf.GetForward(), previous))
+	e.cache.Flush()
+	log.Printf("Loaded %d forward zones", len(zones))
+}
+
+// forwarderFor 返回查询名称对应的上游组：优先匹配条件转发规则，否则使用默认上游
+func (e *DNSEngine) forwarderFor(qname string) *UpstreamGroup {
+	if _, g := e.forwardZones.Load().match(qname); g != nil {
+		return g
+	}
+	return e.forwarder.Load()
+}
+
+// -------------------------- 管理器侧：增删改查 --------------------------
+// ListForwardZones 列出所有条件转发规则（实现接口）
+func (m *ViperYAMLManager) ListForwardZones() []ForwardZone {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.forwardZonesSnapshot()
+}
+
+// GetForwardZone 查询单条条件转发规则（实现接口）
+func (m *ViperYAMLManager) GetForwardZone(name string) (ForwardZone, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.forwardZoneIndex(name)
+	if i < 0 {
+		return ForwardZone{}, fmt.Errorf("转发域名 %s 不存在", name)
+	}
+	zone := m.forwardZones[i]
+	zone.Upstreams = slices.Clone(zone.Upstreams)
+	return zone, nil
+}
+
+// AddForwardZone 新增条件转发规则（实现接口）
+func (m *ViperYAMLManager) AddForwardZone(zone ForwardZone) error {
+	m.mu.Lock()
+	defer m.unlock()
+
+	if m.forwardZoneIndex(zone.Name) >= 0 {
+		return fmt.Errorf("转发域名 %s 已存在", zone.Name)
+	}
+	return m.saveForwardZones(append(slices.Clone(m.forwardZones), zone))
+}
+
+// UpdateForwardZone 更新条件转发规则（实现接口）
+func (m *ViperYAMLManager) UpdateForwardZone(name string, zone ForwardZone) error {
+	m.mu.Lock()
+	defer m.unlock()
+
+	i := m.forwardZoneIndex(name)
+	if i < 0 {
+		return fmt.Errorf("转发域名 %s 不存在", name)
+	}
+	if j := m.forwardZoneIndex(zone.Name); j >= 0 && j != i {
+		return fmt.Errorf("转发域名 %s 已存在", zone.Name)
+	}
+	zones := slices.Clone(m.forwardZones)
+	zones[i] = zone
+	return m.saveForwardZones(zones)
+}
+
+// DeleteForwardZone 删除条件转发规则（实现接口）
+func (m *ViperYAMLManager) DeleteForwardZone(name string) error {
+	m.mu.Lock()
+	defer m.unlock()
+
+	i := m.forwardZoneIndex(name)
+	if i < 0 {
+		return fmt.Errorf("转发域名 %s 不存在", name)
+	}
+	return m.saveForwardZones(slices.Delete(slices.Clone(m.forwardZones), i, i+1))
+}
+
+// OnForwardZonesChange 注册条件转发规则变更回调（实现接口），注册时立即以当前规则回调一次
+func (m *ViperYAMLManager) OnForwardZonesChange(listener ForwardZoneListener) {
+	m.mu.Lock()
+	m.forwardListeners = append(m.forwardListeners, listener)
+	zones := m.forwardZonesSnapshot()
+	m.publishMu.Lock()
+	defer m.publishMu.Unlock()
+	m.mu.Unlock()
+	listener(zones)
+}
+
+// forwardZoneIndex 按名称查找规则下标（忽略大小写与结尾的点），不存在时返回-1（调用方需持有锁）
+func (m *ViperYAMLManager) forwardZoneIndex(name string) int {
+	name = canonicalName(name)
+	return slices.IndexFunc(m.forwardZones, func(z ForwardZone) bool { return canonicalName(z.Name) == name })
+}
+
+// forwardZonesSnapshot 生成当前规则的深拷贝（调用方需持有锁）
+func (m *ViperYAMLManager) forwardZonesSnapshot() []ForwardZone {
+	zones := make([]ForwardZone, 0, len(m.forwardZones))
+	for _, zone := range m.forwardZones {
+		zone.Upstreams = slices.Clone(zone.Upstreams)
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// saveForwardZones 以zones替换条件转发规则（调用方需持有写锁）：先无损写回配置文件，成功后再发布；写入失败时恢复原有规则
+func (m *ViperYAMLManager) saveForwardZones(zones []ForwardZone) error {
+	previous := m.forwardZones
+	m.forwardZones = zones
+	if err := m.updateDomainsNode(); err != nil {
+		m.forwardZones = previous
+		return err
+	}
+	m.notifyForwardZonesChange()
+	return nil
+}
+
+// notifyForwardZonesChange 标记条件转发规则已变更，释放写锁时通知回调（调用方需持有写锁）
+func (m *ViperYAMLManager) notifyForwardZonesChange() {
+	m.forwardChanged = true
+}
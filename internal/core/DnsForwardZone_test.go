@@ -0,0 +1,57 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"testing"
+	"time"
+)
+
+func TestForwardZoneMatch(t *testing.T) {
+	global := conf.ForwardConfig{Strategy: StrategySequential, Timeout: 2 * time.Second}
+	rules := []ForwardZone{
+		{Name: "corp.example.test", Upstreams: []string{"192.0.2.1:53"}},
+		{Name: "Lab.Corp.Example.Test.", Upstreams: []string{"192.0.2.2:53"}, Strategy: StrategyFastest, Timeout: "500ms"},
+		{Name: "svc.cluster.local", Upstreams: []string{"192.0.2.3:53"}},
+	}
+	table := buildForwardZoneTable(rules, global, nil)
+
+	tests := []struct {
+		qname string
+		want  string // 匹配的规则，为空表示不匹配
+	}{
+		{qname: "corp.example.test.", want: "corp.example.test."},
+		{qname: "dc1.CORP.example.test.", want: "corp.example.test."},
+		{qname: "host.lab.corp.example.test.", want: "lab.corp.example.test."},
+		{qname: "lab.corp.example.test", want: "lab.corp.example.test."},
+		{qname: "notcorp.example.test."},
+		{qname: "example.test."},
+		{qname: "web.svc.cluster.local.", want: "svc.cluster.local."},
+		{qname: "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.qname, func(t *testing.T) {
+			got, g := table.match(tt.qname)
+			if got != tt.want || (g == nil) != (tt.want == "") {
+				t.Errorf("match(%s) = %q, want %q", tt.qname, got, tt.want)
+			}
+		})
+	}
+
+	// 规则中的策略与超时覆盖全局配置
+	lab := table.groups["lab.corp.example.test."]
+	if lab.strategy != StrategyFastest || lab.upstreams[0].timeout != 500*time.Millisecond {
+		t.Errorf("lab group uses %s with timeout %s, want %s with 500ms", lab.strategy, lab.upstreams[0].timeout, StrategyFastest)
+	}
+	if corp := table.groups["corp.example.test."]; corp.strategy != StrategySequential || corp.upstreams[0].timeout != 2*time.Second {
+		t.Errorf("corp group uses %s with timeout %s, want the global defaults", corp.strategy, corp.upstreams[0].timeout)
+	}
+
+	// 根区域规则匹配其余所有名称；重建时同名规则的上游沿用原有状态
+	rebuilt := buildForwardZoneTable(append(rules, ForwardZone{Name: ".", Upstreams: []string{"192.0.2.4:53"}}), global, table)
+	if got, _ := rebuilt.match("www.example.test."); got != "." {
+		t.Errorf("match(www.example.test.) with a root rule = %q, want \".\"", got)
+	}
+	if rebuilt.groups["corp.example.test."].upstreams[0].state != table.groups["corp.example.test."].upstreams[0].state {
+		t.Error("upstream state was not kept when rebuilding the forward zone table")
+	}
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"log"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// -------------------------- 基础数据结构 --------------------------
+// localRecord 本地记录及其预先解析好的资源记录
+type localRecord struct {
+	Record
+	rr dns.RR // 以规范化记录名为所有者名的资源记录，应答时复制并替换所有者名
+}
+
+// nameNode 单个名称下的全部记录（按记录类型分组）
+type nameNode struct {
+	rrsets map[uint16][]localRecord // 记录类型 -> 记录列表
+	order  string                   // 多值记录集的应答顺序策略（取自记录所属域名）
+	limit  int                      // weighted 策略每次返回的记录数
+	next   atomic.Uint32            // round_robin 策略的轮转计数
+}
+
+// zoneIndex 编译后的只读解析索引
+// 每次域名数据变更时整体重建并通过原子指针发布，查询路径无锁且与记录总数无关
+type zoneIndex struct {
+	zones     map[string]*zone     // 区域顶点（小写FQDN）-> 区域
+	names     map[string]*nameNode // 精确名称（小写FQDN）-> 记录，包含空非终端名称
+	wildcards map[string]*nameNode // 泛解析（去掉"*."后的小写FQDN后缀）-> 记录
+	conflicts []PTRConflict        // 自动生成PTR时发现的冲突（同一IP对应多个名称）
+}
+
+// -------------------------- 索引构建 --------------------------
+// buildZoneIndex 根据域名快照构建解析索引
+func buildZoneIndex(domains []Domain) *zoneIndex {
+	idx := &zoneIndex{
+		zones:     make(map[string]*zone),
+		names:     make(map[string]*nameNode),
+		wildcards: make(map[string]*nameNode),
+	}
+	for _, domain := range domains {
+		if z := newZone(domain); z != nil {
+			idx.zones[z.name] = z
+			idx.names[z.name] = &nameNode{rrsets: make(map[uint16][]localRecord)}
+		}
+	}
+	for _, domain := range domains {
+		for _, record := range domain.Records {
+			owner := canonicalName(record.Name)
+			rr, err := record.RR(owner)
+			if err != nil {
+				log.Printf("Skipping invalid record in domain %s: %v", domain.Name, err)
+				continue
+			}
+			idx.add(domain, localRecord{Record: record, rr: rr})
+		}
+	}
+	idx.addGeneratedPTRs(domains)
+	return idx
+}
+
+// add 将记录加入索引
+func (idx *zoneIndex) add(domain Domain, record localRecord) {
+	owner := record.rr.Header().Name
+	name, table := owner, idx.names
+	if strings.HasPrefix(name, "*.") {
+		name = name[2:]
+		table = idx.wildcards
+	}
+	node, exists := table[name]
+	if !exists {
+		node = &nameNode{rrsets: make(map[uint16][]localRecord)}
+		table[name] = node
+	}
+	rrtype := record.rr.Header().Rrtype
+	node.rrsets[rrtype] = append(node.rrsets[rrtype], record)
+	node.order, node.limit = domain.AnswerOrder, domain.AnswerLimit
+	idx.addEmptyNonTerminals(owner)
+}
+
+// addEmptyNonTerminals 将名称与其所在区域顶点之间的祖先名称登记为空非终端，
+// 使这些名称的查询得到NODATA而不是NXDOMAIN
+func (idx *zoneIndex) addEmptyNonTerminals(name string) {
+	z := idx.findZone(name)
+	if z == nil {
+		return
+	}
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		parent := name[off:]
+		if len(parent) <= len(z.name) {
+			return
+		}
+		if _, exists := idx.names[parent]; !exists {
+			idx.names[parent] = &nameNode{rrsets: make(map[uint16][]localRecord)}
+		}
+	}
+}
+
+// -------------------------- 索引查询 --------------------------
+// exact 精确查找名称
+func (idx *zoneIndex) exact(qname string) *nameNode {
+	return idx.names[qname]
+}
+
+// wildcard 查找覆盖qname的最具体泛解析（自右向左逐级截取后缀，耗时只与标签数相关）
+func (idx *zoneIndex) wildcard(qname string) *nameNode {
+	if len(idx.wildcards) == 0 {
+		return nil
+	}
+	for off, end := dns.NextLabel(qname, 0); !end; off, end = dns.NextLabel(qname, off) {
+		if node, ok := idx.wildcards[qname[off:]]; ok {
+			return node
+		}
+	}
+	return nil
+}
+
+// node 查找名称对应的节点：名称存在（含空非终端）时只使用精确节点，否则尝试泛解析（RFC 4592）
+func (idx *zoneIndex) node(qname string) *nameNode {
+	if node := idx.exact(qname); node != nil {
+		return node
+	}
+	return idx.wildcard(qname)
+}
+
+// lookup 查找名称下指定类型的记录
+func (idx *zoneIndex) lookup(qname string, qtype uint16) []localRecord {
+	if node := idx.node(qname); node != nil {
+		return node.rrsets[qtype]
+	}
+	return nil
+}
+
+// findZone 查找包含qname的最具体区域
+func (idx *zoneIndex) findZone(qname string) *zone {
+	if len(idx.zones) == 0 {
+		return nil
+	}
+	if z, ok := idx.zones[qname]; ok {
+		return z
+	}
+	for off, end := dns.NextLabel(qname, 0); !end; off, end = dns.NextLabel(qname, off) {
+		if z, ok := idx.zones[qname[off:]]; ok {
+			return z
+		}
+	}
+	return nil
+}
+
+// contains 判断名称是否由本地负责（位于已配置区域内，或被区域外的记录覆盖）
+func (idx *zoneIndex) contains(qname string) bool {
+	return idx.findZone(qname) != nil || idx.node(qname) != nil
+}
+
+// ordered 按应答顺序策略排列记录集（不修改索引中的原始切片）
+func (n *nameNode) ordered(records []localRecord) []localRecord {
+	if len(records) < 2 {
+		return records
+	}
+	switch n.order {
+	case AnswerOrderRoundRobin:
+		start := int((n.next.Add(1) - 1) % uint32(len(records)))
+		out := make([]localRecord, 0, len(records))
+		out = append(out, records[start:]...)
+		return append(out, records[:start]...)
+	case AnswerOrderRandom:
+		out := slices.Clone(records)
+		rand.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+		return out
+	case AnswerOrderWeighted:
+		return weightedPick(records, max(n.limit, 1))
+	default:
+		return records
+	}
+}
+
+// weightedPick 按记录权重（未设置或非正数按1计）不放回地随机选取count条记录
+func weightedPick(records []localRecord, count int) []localRecord {
+	pool := slices.Clone(records)
+	out := make([]localRecord, 0, min(count, len(pool)))
+	for len(out) < count && len(pool) > 0 {
+		total := 0
+		for _, r := range pool {
+			total += max(r.Weight, 1)
+		}
+		pick := rand.IntN(total)
+		for i, r := range pool {
+			pick -= max(r.Weight, 1)
+			if pick < 0 {
+				out = append(out, r)
+				pool = slices.Delete(pool, i, i+1)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// canonicalName 规范化名称：小写并补全结尾的点
+func canonicalName(name string) string {
+	return dns.CanonicalName(strings.TrimSpace(name))
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestZoneIndexLookup(t *testing.T) {
+	idx := buildZoneIndex([]Domain{{
+		Name: "example.test",
+		Records: []Record{
+			{Name: "www.example.test", Type: "A", Value: "192.0.2.1", TTL: 300},
+			{Name: "www.example.test", Type: "A", Value: "192.0.2.11", TTL: 300},
+			{Name: "*.example.test", Type: "A", Value: "192.0.2.2", TTL: 300},
+			{Name: "*.sub.example.test", Type: "A", Value: "192.0.2.3", TTL: 300},
+			{Name: "a.b.c.example.test", Type: "A", Value: "192.0.2.4", TTL: 300},
+			{Name: "mail.example.test", Type: "MX", Value: "mx.example.test", Priority: 10, TTL: 300},
+		},
+	}})
+
+	tests := []struct {
+		name     string
+		qname    string
+		qtype    uint16
+		wantNode bool     // 名称存在（含空非终端）或被泛解析覆盖
+		want     []string // 记录值
+	}{
+		{name: "exact", qname: "www.example.test.", qtype: dns.TypeA, wantNode: true, want: []string{"192.0.2.1", "192.0.2.11"}},
+		{name: "exact other type", qname: "www.example.test.", qtype: dns.TypeAAAA, wantNode: true},
+		{name: "exact mx", qname: "mail.example.test.", qtype: dns.TypeMX, wantNode: true, want: []string{"mx.example.test"}},
+		{name: "exact deep name", qname: "a.b.c.example.test.", qtype: dns.TypeA, wantNode: true, want: []string{"192.0.2.4"}},
+		{name: "zone apex", qname: "example.test.", qtype: dns.TypeA, wantNode: true},
+		{name: "wildcard", qname: "foo.example.test.", qtype: dns.TypeA, wantNode: true, want: []string{"192.0.2.2"}},
+		{name: "wildcard several labels deep", qname: "x.y.example.test.", qtype: dns.TypeA, wantNode: true, want: []string{"192.0.2.2"}},
+		{name: "most specific wildcard", qname: "x.sub.example.test.", qtype: dns.TypeA, wantNode: true, want: []string{"192.0.2.3"}},
+		{name: "wildcard other type", qname: "foo.example.test.", qtype: dns.TypeTXT, wantNode: true},
+		{name: "empty non-terminal", qname: "c.example.test.", qtype: dns.TypeA, wantNode: true},
+		{name: "nested empty non-terminal", qname: "b.c.example.test.", qtype: dns.TypeA, wantNode: true},
+		{name: "outside zones", qname: "www.other.test.", qtype: dns.TypeA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if node := idx.node(tt.qname); (node != nil) != tt.wantNode {
+				t.Fatalf("node(%s) found = %v, want %v", tt.qname, node != nil, tt.wantNode)
+			}
+			var got []string
+			for _, r := range idx.lookup(tt.qname, tt.qtype) {
+				got = append(got, r.Value)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("lookup(%s, %s) = %v, want %v", tt.qname, dns.TypeToString[tt.qtype], got, tt.want)
+			}
+		})
+	}
+}
+
+// TestZoneIndexEmptyNonTerminalHidesWildcard 空非终端名称存在，不应由泛解析合成应答（RFC 4592）
+func TestZoneIndexEmptyNonTerminalHidesWildcard(t *testing.T) {
+	idx := buildZoneIndex([]Domain{{
+		Name: "example.test",
+		Records: []Record{
+			{Name: "*.example.test", Type: "A", Value: "192.0.2.2", TTL: 300},
+			{Name: "host.ent.example.test", Type: "A", Value: "192.0.2.5", TTL: 300},
+		},
+	}})
+	if records := idx.lookup("ent.example.test.", dns.TypeA); len(records) != 0 {
+		t.Errorf("lookup(ent.example.test.) = %v, want no records", records)
+	}
+	if node := idx.exact("ent.example.test."); node == nil || len(node.rrsets) != 0 {
+		t.Errorf("ent.example.test. should be indexed as an empty non-terminal")
+	}
+	if !idx.contains("ent.example.test.") {
+		t.Errorf("ent.example.test. should be served locally")
+	}
+}
+
+// benchmarkIndex 构建包含 n 条A记录的索引（分布在多个区域中），返回索引与记录名
+func benchmarkIndex(n int) (*zoneIndex, []string) {
+	const perZone = 10000
+	domains := make([]Domain, 0, n/perZone+1)
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if i%perZone == 0 {
+			domains = append(domains, Domain{Name: fmt.Sprintf("zone%d.bench.test", i/perZone)})
+		}
+		d := &domains[len(domains)-1]
+		name := fmt.Sprintf("host%d.%s", i, d.Name)
+		d.Records = append(d.Records, Record{Name: name, Type: "A", Value: fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff), TTL: 300})
+		names = append(names, dns.Fqdn(name))
+	}
+	return buildZoneIndex(domains), names
+}
+
+// BenchmarkLookup 只测量索引中的名称与类型查找，耗时应与记录总数无关
+func BenchmarkLookup(b *testing.B) {
+	for _, n := range []int{10, 10_000, 1_000_000} {
+		b.Run(fmt.Sprintf("records=%d", n), func(b *testing.B) {
+			idx, names := benchmarkIndex(n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if len(idx.lookup(names[i%len(names)], dns.TypeA)) != 1 {
+					b.Fatal("record not found")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAnswerLocal 测量在已构建的索引上生成完整权威应答（区域查找、记录复制与组装）的耗时
+func BenchmarkAnswerLocal(b *testing.B) {
+	e := &DNSEngine{}
+	for _, n := range []int{10, 10_000, 1_000_000} {
+		b.Run(fmt.Sprintf("records=%d", n), func(b *testing.B) {
+			idx, names := benchmarkIndex(n)
+			// 预先构造的查询均匀分布在全部区域中
+			reqs := make([]*dns.Msg, min(len(names), 1024))
+			for i := range reqs {
+				reqs[i] = new(dns.Msg)
+				reqs[i].SetQuestion(names[i*len(names)/len(reqs)], dns.TypeA)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req := reqs[i%len(reqs)]
+				m := new(dns.Msg)
+				m.SetReply(req)
+				if !e.answerLocal(idx, m, req, false) || len(m.Answer) != 1 || !m.Authoritative {
+					b.Fatal("record not answered")
+				}
+			}
+		})
+	}
+}
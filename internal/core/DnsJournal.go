@@ -0,0 +1,136 @@
+package core
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxJournalDeltas 每个区域保留的IXFR变更条数，更早的变更只能通过AXFR同步
+const maxJournalDeltas = 100
+
+// -------------------------- 基础数据结构 --------------------------
+// ZoneDelta 区域的一次变更（IXFR差异序列，RFC 1995）
+type ZoneDelta struct {
+	From    *dns.SOA // 变更前的SOA
+	To      *dns.SOA // 变更后的SOA
+	Deleted []dns.RR // 删除的记录（不含SOA）
+	Added   []dns.RR // 新增的记录（不含SOA）
+}
+
+// zoneJournal 单个区域的变更日志（按序列号顺序，只保留最近 maxJournalDeltas 条）
+type zoneJournal struct {
+	serial uint32 // 最近发布的序列号（域名删除后保留，重新添加时序列号在此基础上继续递增）
+	deltas []ZoneDelta
+}
+
+// -------------------------- 序列号 --------------------------
+// serialGreater 按序列号算术（RFC 1982）判断a是否大于b
+func serialGreater(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+// initialSerial 未配置序列号的区域首次加载时使用的序列号（当前时间）
+func initialSerial() uint32 {
+	return uint32(time.Now().Unix())
+}
+
+// nextSerial 区域数据变更后的序列号：取上一序列号加一与当前时间中按序列号算术较大者，
+// 使重启后（内存中的变更日志丢失）新的变更仍大于此前发布过的序列号
+func nextSerial(previous uint32) uint32 {
+	serial := previous + 1
+	if now := initialSerial(); serialGreater(now, serial) {
+		serial = now
+	}
+	if serial == 0 {
+		serial = 1
+	}
+	return serial
+}
+
+// -------------------------- 变更计算 --------------------------
+// diffZone 计算区域两个版本之间的差异（只比较默认视图的记录与SOA/NS），序列号以next为准；
+// 区域数据与SOA参数均未变化时返回false
+func diffZone(previous, next Domain) (ZoneDelta, bool) {
+	from := newZone(previous).soa
+	to := newZone(next).soa
+	delta := ZoneDelta{From: from, To: to}
+
+	before := rrSet(previous)
+	after := rrSet(next)
+	for key, rr := range before {
+		if _, ok := after[key]; !ok {
+			delta.Deleted = append(delta.Deleted, rr)
+		}
+	}
+	for key, rr := range after {
+		if _, ok := before[key]; !ok {
+			delta.Added = append(delta.Added, rr)
+		}
+	}
+	sortRRs(delta.Deleted)
+	sortRRs(delta.Added)
+
+	// 只比较序列号以外的SOA字段
+	soa := *to
+	soa.Serial = from.Serial
+	changed := len(delta.Deleted) > 0 || len(delta.Added) > 0 || soa.String() != from.String()
+	return delta, changed
+}
+
+// rrSet 按文本形式（含TTL）索引区域中SOA以外的记录，TTL变化视为删除后重新添加
+func rrSet(domain Domain) map[string]dns.RR {
+	rrs := zoneRRs(domain)
+	set := make(map[string]dns.RR, len(rrs))
+	for _, rr := range rrs {
+		if rr.Header().Rrtype != dns.TypeSOA {
+			set[rr.String()] = rr
+		}
+	}
+	return set
+}
+
+// sortRRs 按文本形式排序，使传送内容稳定
+func sortRRs(rrs []dns.RR) {
+	slices.SortFunc(rrs, func(a, b dns.RR) int { return strings.Compare(a.String(), b.String()) })
+}
+
+// -------------------------- 变更日志 --------------------------
+// append 追加一次变更，超出保留条数时丢弃最早的变更
+func (j *zoneJournal) append(delta ZoneDelta) {
+	j.deltas = append(j.deltas, delta)
+	if len(j.deltas) > maxJournalDeltas {
+		j.deltas = slices.Delete(j.deltas, 0, len(j.deltas)-maxJournalDeltas)
+	}
+}
+
+// reset 域名被删除时清空变更日志，只保留最近发布的序列号
+func (j *zoneJournal) reset() {
+	j.deltas = nil
+}
+
+// since 返回从序列号serial到current的连续变更，日志中找不到serial或变更不连续时返回false
+func (j *zoneJournal) since(serial, current uint32) ([]ZoneDelta, bool) {
+	if serial == current {
+		return nil, true
+	}
+	if j == nil {
+		return nil, false
+	}
+	start := slices.IndexFunc(j.deltas, func(d ZoneDelta) bool { return d.From.Serial == serial })
+	if start < 0 {
+		return nil, false
+	}
+	deltas := j.deltas[start:]
+	for i := 1; i < len(deltas); i++ {
+		if deltas[i].From.Serial != deltas[i-1].To.Serial {
+			return nil, false
+		}
+	}
+	if deltas[len(deltas)-1].To.Serial != current {
+		return nil, false
+	}
+	return slices.Clone(deltas), true
+}
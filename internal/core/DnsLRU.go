@@ -0,0 +1,72 @@
+package core
+
+import "container/list"
+
+// lruTable 容量有限的LRU表（非并发安全，调用方需自行加锁）：插入新键超出容量时淘汰最久未使用的条目，
+// 插入、查找与淘汰的耗时与条目数无关
+type lruTable[K comparable, V any] struct {
+	capacity int
+	items    map[K]*list.Element
+	order    *list.List // 队首为最近使用
+}
+
+// lruItem LRU表中的条目
+type lruItem[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newLRUTable[K comparable, V any](capacity int) *lruTable[K, V] {
+	return &lruTable[K, V]{
+		capacity: max(capacity, 1),
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get 查找键对应的值，找到时标记为最近使用
+func (t *lruTable[K, V]) get(key K) (V, bool) {
+	elem, ok := t.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	t.order.MoveToFront(elem)
+	return elem.Value.(*lruItem[K, V]).value, true
+}
+
+// add 插入键（调用方需确认键不存在），超出容量时先淘汰最久未使用的条目
+func (t *lruTable[K, V]) add(key K, value V) {
+	for len(t.items) >= t.capacity {
+		oldest := t.order.Back()
+		t.order.Remove(oldest)
+		delete(t.items, oldest.Value.(*lruItem[K, V]).key)
+	}
+	t.items[key] = t.order.PushFront(&lruItem[K, V]{key: key, value: value})
+}
+
+// deleteFunc 删除 del 返回true的条目
+func (t *lruTable[K, V]) deleteFunc(del func(key K, value V) bool) {
+	for elem := t.order.Front(); elem != nil; {
+		next := elem.Next()
+		if item := elem.Value.(*lruItem[K, V]); del(item.key, item.value) {
+			t.order.Remove(elem)
+			delete(t.items, item.key)
+		}
+		elem = next
+	}
+}
+
+// values 返回全部条目的值（最近使用的在前）
+func (t *lruTable[K, V]) values() []V {
+	values := make([]V, 0, len(t.items))
+	for elem := t.order.Front(); elem != nil; elem = elem.Next() {
+		values = append(values, elem.Value.(*lruItem[K, V]).value)
+	}
+	return values
+}
+
+// len 返回条目数
+func (t *lruTable[K, V]) len() int {
+	return len(t.items)
+}
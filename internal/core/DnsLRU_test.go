@@ -0,0 +1,63 @@
+package core
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestLRUTableEvictsLeastRecentlyUsed(t *testing.T) {
+	table := newLRUTable[string, int](3)
+	table.add("a", 1)
+	table.add("b", 2)
+	table.add("c", 3)
+	if _, ok := table.get("a"); !ok { // a 变为最近使用，b 成为最久未使用
+		t.Fatal("a not found")
+	}
+	table.add("d", 4)
+
+	if _, ok := table.get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if got, want := table.values(), []int{4, 1, 3}; !slices.Equal(got, want) {
+		t.Errorf("values() = %v, want %v", got, want)
+	}
+
+	table.deleteFunc(func(key string, value int) bool { return value%2 == 1 })
+	if got, want := table.values(), []int{4}; !slices.Equal(got, want) || table.len() != 1 {
+		t.Errorf("values() after deleteFunc = %v, want %v", got, want)
+	}
+}
+
+// TestRefusedCounterBounded 客户端数量超出上限后淘汰最久未被拒绝的客户端，刚加入的客户端保留
+func TestRefusedCounterBounded(t *testing.T) {
+	c := newRefusedCounter()
+	base := netip.MustParseAddr("10.0.0.0").As4()
+	addr := func(i int) netip.Addr {
+		b := base
+		b[1], b[2], b[3] = byte(i>>16), byte(i>>8), byte(i)
+		return netip.AddrFrom4(b)
+	}
+	c.add(addr(0), "keep.test.", RefusedDeny)
+	for i := 1; i < maxRefusedClients+100; i++ {
+		if i%1000 == 0 {
+			c.add(addr(0), "keep.test.", RefusedDeny) // 持续被拒绝的客户端不被淘汰
+		}
+		c.add(addr(i), "flood.test.", RefusedDeny)
+	}
+
+	stats := c.stats()
+	if len(stats) != maxRefusedClients {
+		t.Fatalf("tracked %d clients, want %d", len(stats), maxRefusedClients)
+	}
+	clients := make(map[string]bool, len(stats))
+	for _, s := range stats {
+		clients[s.Client] = true
+	}
+	if !clients[addr(0).String()] || !clients[addr(maxRefusedClients+99).String()] {
+		t.Error("recently refused clients should be kept")
+	}
+	if clients[addr(1).String()] {
+		t.Error("least recently refused client should have been evicted")
+	}
+}
@@ -1,9 +1,12 @@
 package core
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -13,18 +16,91 @@ import (
 )
 
 // -------------------------- 基础数据结构 --------------------------
-// Record DNS解析记录结构体（与配置文件映射）
+// Record DNS解析记录结构体（与配置文件映射）；Name/Type/Value/TTL 不设json标签，保持管理控制台读取的字段名
 type Record struct {
-	Name  string `mapstructure:"name" yaml:"name"` // 记录名（子域名/反向IP）
-	Type  string `mapstructure:"type" yaml:"type"` // 解析类型 A/AAAA/PTR/CNAME 等
-	Value string `mapstructure:"value" yaml:"value"`
-	TTL   int    `mapstructure:"ttl" yaml:"ttl"`
+	Name     string `mapstructure:"name" yaml:"name"`                                             // 记录名（子域名/反向IP）
+	Type     string `mapstructure:"type" yaml:"type"`                                             // 解析类型 A/AAAA/CNAME/TXT/MX/SRV/NS/PTR/CAA/HTTPS/SVCB 等
+	Value    string `mapstructure:"value" yaml:"value"`                                           // 记录值：IP、文本，或 CNAME/MX/SRV/NS/PTR/HTTPS/SVCB 的目标域名
+	TTL      int    `mapstructure:"ttl" yaml:"ttl"`                                               // 生存时间（秒）
+	Priority int    `mapstructure:"priority" yaml:"priority,omitempty" json:"priority,omitempty"` // MX/SRV/HTTPS/SVCB 优先级
+	Weight   int    `mapstructure:"weight" yaml:"weight,omitempty" json:"weight,omitempty"`       // SRV 权重
+	Port     int    `mapstructure:"port" yaml:"port,omitempty" json:"port,omitempty"`             // SRV 端口
+	Flags    int    `mapstructure:"flags" yaml:"flags,omitempty" json:"flags,omitempty"`          // CAA 标志
+	Tag      string `mapstructure:"tag" yaml:"tag,omitempty" json:"tag,omitempty"`                // CAA 标签（issue/issuewild/iodef）
+	Params   string `mapstructure:"params" yaml:"params,omitempty" json:"params,omitempty"`       // HTTPS/SVCB 服务参数（如 alpn=h2 port=443）
+	View     string `mapstructure:"view" yaml:"view,omitempty" json:"view,omitempty"`             // 所属视图，为空表示默认视图（所有客户端可见）
 }
 
-// Domain 域名结构体（包含归属的解析记录）
+// SOA 区域SOA参数（未配置的字段自动生成）
+type SOA struct {
+	MName   string `mapstructure:"mname" yaml:"mname,omitempty" json:"mname,omitempty"`       // 主域名服务器，默认取第一个NS
+	RName   string `mapstructure:"rname" yaml:"rname,omitempty" json:"rname,omitempty"`       // 管理员邮箱（hostmaster.example.com 形式），默认 hostmaster.<域名>
+	Serial  uint32 `mapstructure:"serial" yaml:"serial,omitempty" json:"serial,omitempty"`    // 序列号，0表示首次加载时按当前时间生成；区域数据每次变更时自动递增
+	Refresh uint32 `mapstructure:"refresh" yaml:"refresh,omitempty" json:"refresh,omitempty"` // 从服务器刷新间隔（秒）
+	Retry   uint32 `mapstructure:"retry" yaml:"retry,omitempty" json:"retry,omitempty"`       // 刷新失败重试间隔（秒）
+	Expire  uint32 `mapstructure:"expire" yaml:"expire,omitempty" json:"expire,omitempty"`    // 从服务器数据过期时间（秒）
+	Minimum uint32 `mapstructure:"minimum" yaml:"minimum,omitempty" json:"minimum,omitempty"` // 否定应答缓存时间（秒）
+}
+
+// Secondary 从区域配置：区域数据通过AXFR/IXFR从主服务器同步（只保存在内存中），不能通过接口或动态更新修改
+type Secondary struct {
+	Primaries []string `mapstructure:"primaries" yaml:"primaries" json:"primaries"`   // 主服务器地址（host 或 host:port），按顺序尝试
+	Key       string   `mapstructure:"key" yaml:"key,omitempty" json:"key,omitempty"` // 查询与传送使用的TSIG密钥名称（须在 tsig_keys 中配置）
+}
+
+// SecondaryZone 从区域的配置与同步状态（DNSManager视角）
+type SecondaryZone struct {
+	Domain    string    // 域名
+	Secondary Secondary // 从区域配置
+	Serial    uint32    // 当前数据的SOA序列号
+	Loaded    bool      // 是否已有同步得到的数据（尚未同步或已过期时不对外提供解析）
+}
+
+// ErrSecondaryZone 修改从区域时返回的错误
+var ErrSecondaryZone = errors.New("从区域的数据由主服务器同步，不能修改")
+
+// 多值记录集的应答顺序策略
+const (
+	AnswerOrderFixed      = "fixed"       // 按配置顺序返回（默认）
+	AnswerOrderRoundRobin = "round_robin" // 每次查询轮转起始记录
+	AnswerOrderRandom     = "random"      // 随机打乱顺序
+	AnswerOrderWeighted   = "weighted"    // 按记录权重随机选取 AnswerLimit 条
+)
+
+// Domain 域名结构体（包含归属的解析记录），每个域名即一个权威区域
 type Domain struct {
-	Name    string   `mapstructure:"name" yaml:"name"`
-	Records []Record `mapstructure:"records" yaml:"records"`
+	Name        string     `mapstructure:"name" yaml:"name" json:"name"`
+	NS          []string   `mapstructure:"ns" yaml:"ns,omitempty" json:"ns,omitempty"`                               // 区域顶点的NS记录，默认 ns1.<域名>
+	SOA         SOA        `mapstructure:"soa" yaml:"soa,omitempty" json:"soa,omitempty"`                            // 区域SOA参数
+	AnswerOrder string     `mapstructure:"answer_order" yaml:"answer_order,omitempty" json:"answer_order,omitempty"` // 多值记录集的应答顺序：fixed/round_robin/random/weighted
+	AnswerLimit int        `mapstructure:"answer_limit" yaml:"answer_limit,omitempty" json:"answer_limit,omitempty"` // weighted 策略每次返回的记录数，默认1
+	AutoPTR     bool       `mapstructure:"auto_ptr" yaml:"auto_ptr,omitempty" json:"auto_ptr,omitempty"`             // 为A/AAAA记录自动生成反向解析PTR
+	View        string     `mapstructure:"view" yaml:"view,omitempty" json:"view,omitempty"`                         // 所属视图，设置后整个区域只对该视图的客户端可见
+	Secondary   *Secondary `mapstructure:"secondary" yaml:"secondary,omitempty" json:"secondary,omitempty"`          // 从区域配置，设置后区域数据从主服务器同步
+	Records     []Record   `mapstructure:"records" yaml:"records" json:"records"`
+}
+
+// secondaryData 从区域最近一次同步得到的数据
+type secondaryData struct {
+	soa     SOA      // 主服务器的SOA参数（含序列号）
+	records []Record // 区域中SOA以外的记录
+}
+
+// DomainSettings 域名级设置（不含解析记录），字段为空表示保持不变
+type DomainSettings struct {
+	NS          []string `json:"ns,omitempty"`           // 区域顶点的NS记录
+	SOA         *SOA     `json:"soa,omitempty"`          // 区域SOA参数
+	AnswerOrder *string  `json:"answer_order,omitempty"` // 多值记录集的应答顺序
+	AnswerLimit *int     `json:"answer_limit,omitempty"` // weighted 策略每次返回的记录数
+	AutoPTR     *bool    `json:"auto_ptr,omitempty"`     // 为A/AAAA记录自动生成反向解析PTR
+}
+
+// RecordSelector 解析记录选择条件（Type/Value为空、View为nil表示不限制）
+type RecordSelector struct {
+	Name  string
+	Type  string
+	Value string
+	View  *string // 所属视图，空字符串表示默认视图
 }
 
 // DomainInfo 域名信息结构体（用于列表展示，包含记录数量）
@@ -39,6 +115,10 @@ type DomainListResult struct {
 	Domains []DomainInfo `json:"domains"` // 当前页域名列表
 }
 
+// ChangeListener 域名数据变更回调，参数为变更后的全量域名快照
+// 回调在管理器写锁释放后按变更顺序依次执行，回调中可以读取DNSManager，但不得修改其数据
+type ChangeListener func(domains []Domain)
+
 // -------------------------- 核心接口定义 --------------------------
 // DNSManager DNS管理器核心接口（抽象所有操作）
 type DNSManager interface {
@@ -46,68 +126,124 @@ type DNSManager interface {
 	Load() error
 
 	// 域名级操作
-	AddOrUpdateDomain(domain Domain) error       // 新增/更新域名
-	DeleteDomain(domainName string) error        // 删除域名
-	GetDomain(domainName string) (Domain, error) // 查询单个域名完整信息
+	AddOrUpdateDomain(domain Domain) error                                 // 新增/更新域名
+	DeleteDomain(domainName string) error                                  // 删除域名
+	GetDomain(domainName string) (Domain, error)                           // 查询单个域名完整信息
+	UpdateDomainSettings(domainName string, settings DomainSettings) error // 更新域名级设置
 
 	// 解析记录级操作
-	AddRecord(domainName string, record Record) error                // 新增解析记录
-	UpdateRecord(domainName, recordName string, record Record) error // 更新解析记录
-	DeleteRecord(domainName, recordName string) error                // 删除解析记录
-	GetRecords(domainName string) ([]Record, error)                  // 查询域名下所有记录
+	AddRecord(domainName string, record Record) error                                    // 新增解析记录
+	UpdateRecord(domainName string, selector RecordSelector, record Record) error        // 更新解析记录
+	DeleteRecord(domainName string, selector RecordSelector) error                       // 删除解析记录
+	GetRecords(domainName string) ([]Record, error)                                      // 查询域名下所有记录
+	UpdateRecords(domainName string, update func(domain Domain) ([]Record, error)) error // 按当前数据计算并整体替换解析记录（动态更新）
+	ZoneJournal(domainName string, serial uint32) ([]ZoneDelta, bool)                    // 查询自序列号serial以来的区域变更（IXFR），日志不完整时返回false
+
+	// 从区域操作
+	SecondaryZones() []SecondaryZone                                        // 列出所有从区域
+	UpdateSecondaryZone(domainName string, soa SOA, records []Record) error // 发布从区域同步得到的数据（不写回配置文件）
+	ExpireSecondaryZone(domainName string)                                  // 丢弃从区域已过期的数据
 
 	// 辅助操作
 	ListDomains() []string                                                  // 列出所有已加载的域名
 	ListDomainsWithPagination(page, pageSize int) (DomainListResult, error) // 分页查询域名列表，包含记录数量
+	OnChange(listener ChangeListener)                                       // 注册数据变更回调
+
+	// 条件转发规则操作
+	ListForwardZones() []ForwardZone                       // 列出所有条件转发规则
+	GetForwardZone(name string) (ForwardZone, error)       // 查询单条条件转发规则
+	AddForwardZone(zone ForwardZone) error                 // 新增条件转发规则
+	UpdateForwardZone(name string, zone ForwardZone) error // 更新条件转发规则
+	DeleteForwardZone(name string) error                   // 删除条件转发规则
+	OnForwardZonesChange(listener ForwardZoneListener)     // 注册条件转发规则变更回调
 }
 
 // -------------------------- 接口实现：ViperYAMLManager --------------------------
 // ViperYAMLManager DNS管理器的Viper+YAML实现（无损修改配置）
 type ViperYAMLManager struct {
-	mu           sync.RWMutex      // 并发安全锁
-	domainMap    map[string]Domain // 内存映射：域名->解析记录
-	viper        *viper.Viper      // Viper配置实例
-	configPath   string            // 配置文件路径
-	fullYAMLNode *yaml.Node        // 完整YAML节点树（保留所有配置）
+	mu           sync.RWMutex             // 并发安全锁
+	domainMap    map[string]Domain        // 内存映射：域名->解析记录
+	viper        *viper.Viper             // Viper配置实例
+	configPath   string                   // 配置文件路径
+	fullYAMLNode *yaml.Node               // 完整YAML节点树（保留所有配置）
+	rawYAML      []byte                   // 最近一次加载/写入的配置文件内容
+	listeners    []ChangeListener         // 数据变更回调
+	publishMu    sync.Mutex               // 发布锁：回调在写锁外执行，由此保证按变更顺序送达
+	changed      bool                     // 持有写锁期间域名数据有变更，释放写锁后发布
+	journals     map[string]*zoneJournal  // 域名 -> 区域变更日志（仅保存在内存中，域名删除后保留最近的序列号）
+	secondaries  map[string]secondaryData // 域名 -> 从区域同步得到的数据（仅保存在内存中）
+
+	forwardZones     []ForwardZone         // 条件转发规则（按配置顺序）
+	forwardListeners []ForwardZoneListener // 条件转发规则变更回调
+	forwardChanged   bool                  // 持有写锁期间条件转发规则有变更，释放写锁后发布
 }
 
 // NewViperYAMLManager 创建ViperYAMLManager实例（接口工厂方法）
 func NewViperYAMLManager(v *viper.Viper, configPath string) DNSManager {
 	return &ViperYAMLManager{
-		domainMap:  make(map[string]Domain),
-		viper:      v,
-		configPath: configPath,
+		domainMap:   make(map[string]Domain),
+		journals:    make(map[string]*zoneJournal),
+		secondaries: make(map[string]secondaryData),
+		viper:       v,
+		configPath:  configPath,
 	}
 }
 
 // -------------------------- 实现DNSManager接口 --------------------------
-// Load 加载配置（实现接口）
+// Load 加载配置（实现接口），配置文件被外部修改后也通过此方法重新加载
 func (m *ViperYAMLManager) Load() error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 
 	// 1. 读取完整YAML文件，保留所有节点
 	yamlData, err := os.ReadFile(m.configPath)
 	if err != nil {
 		return fmt.Errorf("读取配置文件失败: %w", err)
 	}
+	// 文件内容未变化（例如本管理器写回配置触发的文件监听）时无需重新加载
+	if m.fullYAMLNode != nil && bytes.Equal(yamlData, m.rawYAML) {
+		return nil
+	}
 	var rootNode yaml.Node
 	if err := yaml.Unmarshal(yamlData, &rootNode); err != nil {
 		return fmt.Errorf("解析YAML节点失败: %w", err)
 	}
-	m.fullYAMLNode = &rootNode
 
-	// 2. 从Viper解析domains到内存映射
+	// 2. 从YAML节点解析domains与forward_zones（以文件内容为准，viper.Set写入的值会掩盖文件的外部修改）
 	var domains []Domain
-	if err := m.viper.UnmarshalKey("domains", &domains); err != nil {
+	if err := decodeNode(&rootNode, "domains", &domains); err != nil {
 		return fmt.Errorf("解析domains节点失败: %w", err)
 	}
+	var forwardZones []ForwardZone
+	if err := decodeNode(&rootNode, "forward_zones", &forwardZones); err != nil {
+		return fmt.Errorf("解析forward_zones节点失败: %w", err)
+	}
+	for _, zone := range forwardZones {
+		if err := zone.Validate(); err != nil {
+			return fmt.Errorf("forward_zones 配置错误: %w", err)
+		}
+	}
+	m.fullYAMLNode = &rootNode
+	m.rawYAML = yamlData
 
-	// 3. 构建内存映射
+	// 3. 构建内存映射（与上次加载的数据比较，变化的区域递增序列号并记录变更日志）
+	previous := m.domainMap
 	m.domainMap = make(map[string]Domain, len(domains))
 	for _, domain := range domains {
-		m.domainMap[domain.Name] = domain
+		if old, exists := previous[domain.Name]; exists {
+			m.domainMap[domain.Name] = old
+		}
+		m.commitDomain(domain)
+	}
+	for name, journal := range m.journals {
+		if _, exists := m.domainMap[name]; !exists {
+			journal.reset()
+			delete(m.secondaries, name)
+		}
 	}
+	m.forwardZones = forwardZones
+	m.notifyChange()
+	m.notifyForwardZonesChange()
 	return nil
 }
 
@@ -118,29 +254,43 @@ func (m *ViperYAMLManager) AddOrUpdateDomain(domain Domain) error {
 	}
 
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 
-	// 更新内存映射
-	m.domainMap[domain.Name] = domain
+	// 从区域的数据由主服务器同步，不能被整体替换
+	if existing, exists := m.domainMap[domain.Name]; exists {
+		if err := checkWritable(existing); err != nil {
+			return err
+		}
+	}
 
-	// 无损更新YAML配置
-	return m.updateDomainsNode()
+	// 更新内存映射并写回配置文件
+	return m.saveDomain(domain)
 }
 
 // DeleteDomain 删除域名（实现接口）
 func (m *ViperYAMLManager) DeleteDomain(domainName string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 
 	if _, exists := m.domainMap[domainName]; !exists {
 		return fmt.Errorf("域名 %s 不存在", domainName)
 	}
 
-	// 删除内存映射
+	// 删除内存映射，写回配置文件成功后再发布
+	undo := m.checkpoint(domainName)
 	delete(m.domainMap, domainName)
+	if journal, ok := m.journals[domainName]; ok {
+		journal.reset()
+	}
+	delete(m.secondaries, domainName)
 
 	// 无损更新YAML配置
-	return m.updateDomainsNode()
+	if err := m.updateDomainsNode(); err != nil {
+		undo()
+		return err
+	}
+	m.notifyChange()
+	return nil
 }
 
 // GetDomain 查询单个域名完整信息（实现接口）
@@ -152,6 +302,7 @@ func (m *ViperYAMLManager) GetDomain(domainName string) (Domain, error) {
 	if !exists {
 		return Domain{}, fmt.Errorf("域名 %s 不存在", domainName)
 	}
+	domain, _ = m.served(domain)
 
 	// 返回副本，避免外部修改内部数据
 	records := make([]Record, len(domain.Records))
@@ -160,94 +311,166 @@ func (m *ViperYAMLManager) GetDomain(domainName string) (Domain, error) {
 	return domain, nil
 }
 
-// AddRecord 新增解析记录（实现接口）
+// AddRecord 新增解析记录（实现接口），同名同类型可添加多个不同值组成记录集
 func (m *ViperYAMLManager) AddRecord(domainName string, record Record) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 
 	// 检查域名是否存在
 	domain, exists := m.domainMap[domainName]
 	if !exists {
 		return fmt.Errorf("域名 %s 不存在", domainName)
 	}
+	if err := checkWritable(domain); err != nil {
+		return err
+	}
+
+	if err := domain.checkRecordView(record); err != nil {
+		return err
+	}
 
-	// 检查记录是否重复（同名同类型）
+	// 检查记录是否重复（同一视图下同名同类型同值）
 	for _, r := range domain.Records {
-		if r.Name == record.Name && r.Type == record.Type {
-			return fmt.Errorf("域名 %s 下已存在记录 %s(%s)", domainName, record.Name, record.Type)
+		if r.sameData(record) {
+			return fmt.Errorf("域名 %s 下已存在记录 %s(%s) %s", domainName, record.Name, record.Type, record.Value)
 		}
 	}
+	if err := checkCNAMEConflict(domain.Records, record, -1); err != nil {
+		return err
+	}
 
 	// 新增记录
 	domain.Records = append(domain.Records, record)
-	m.domainMap[domainName] = domain
-
-	// 无损更新YAML配置
-	return m.updateDomainsNode()
+	return m.saveDomain(domain)
 }
 
-// UpdateRecord 更新解析记录（实现接口）
-func (m *ViperYAMLManager) UpdateRecord(domainName, recordName string, newRecord Record) error {
+// UpdateRecord 更新解析记录（实现接口），选择条件必须唯一匹配一条记录
+func (m *ViperYAMLManager) UpdateRecord(domainName string, selector RecordSelector, newRecord Record) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 
 	// 检查域名是否存在
 	domain, exists := m.domainMap[domainName]
 	if !exists {
 		return fmt.Errorf("域名 %s 不存在", domainName)
 	}
+	if err := checkWritable(domain); err != nil {
+		return err
+	}
 
-	// 查找并更新记录
-	found := false
+	// 查找要更新的记录
+	index := -1
 	for i, r := range domain.Records {
-		if r.Name == recordName {
-			domain.Records[i] = newRecord
-			found = true
-			break
+		if !selector.match(r) {
+			continue
 		}
+		if index >= 0 {
+			return fmt.Errorf("域名 %s 下匹配到多条记录 %s，请通过 type 和 value 指定要更新的记录", domainName, selector.Name)
+		}
+		index = i
 	}
-	if !found {
-		return fmt.Errorf("域名 %s 下不存在记录 %s", domainName, recordName)
+	if index < 0 {
+		return fmt.Errorf("域名 %s 下不存在记录 %s", domainName, selector)
+	}
+	if err := domain.checkRecordView(newRecord); err != nil {
+		return err
+	}
+	for i, r := range domain.Records {
+		if i != index && r.sameData(newRecord) {
+			return fmt.Errorf("域名 %s 下已存在记录 %s(%s) %s", domainName, newRecord.Name, newRecord.Type, newRecord.Value)
+		}
+	}
+	if err := checkCNAMEConflict(domain.Records, newRecord, index); err != nil {
+		return err
 	}
 
-	// 更新内存映射
-	m.domainMap[domainName] = domain
-
-	// 无损更新YAML配置
-	return m.updateDomainsNode()
+	// 更新内存映射（复制记录切片，避免影响已发布的快照）
+	records := append([]Record(nil), domain.Records...)
+	records[index] = newRecord
+	domain.Records = records
+	return m.saveDomain(domain)
 }
 
-// DeleteRecord 删除解析记录（实现接口）
-func (m *ViperYAMLManager) DeleteRecord(domainName, recordName string) error {
+// DeleteRecord 删除解析记录（实现接口），删除所有满足选择条件的记录
+func (m *ViperYAMLManager) DeleteRecord(domainName string, selector RecordSelector) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlock()
 
 	// 检查域名是否存在
 	domain, exists := m.domainMap[domainName]
 	if !exists {
 		return fmt.Errorf("域名 %s 不存在", domainName)
 	}
+	if err := checkWritable(domain); err != nil {
+		return err
+	}
 
 	// 过滤要删除的记录
 	newRecords := make([]Record, 0, len(domain.Records))
 	found := false
 	for _, r := range domain.Records {
-		if r.Name != recordName {
+		if !selector.match(r) {
 			newRecords = append(newRecords, r)
 		} else {
 			found = true
 		}
 	}
 	if !found {
-		return fmt.Errorf("域名 %s 下不存在记录 %s", domainName, recordName)
+		return fmt.Errorf("域名 %s 下不存在记录 %s", domainName, selector)
 	}
 
 	// 更新内存映射
 	domain.Records = newRecords
-	m.domainMap[domainName] = domain
+	return m.saveDomain(domain)
+}
 
-	// 无损更新YAML配置
-	return m.updateDomainsNode()
+// UpdateRecords 以域名当前数据的副本调用update计算新的记录列表并整体替换（实现接口），
+// 计算与替换在同一写锁内完成，update返回错误时不做任何修改；update中不得再调用DNSManager的方法
+func (m *ViperYAMLManager) UpdateRecords(domainName string, update func(domain Domain) ([]Record, error)) error {
+	m.mu.Lock()
+	defer m.unlock()
+
+	domain, exists := m.domainMap[domainName]
+	if !exists {
+		return fmt.Errorf("域名 %s 不存在", domainName)
+	}
+	if err := checkWritable(domain); err != nil {
+		return err
+	}
+
+	current := domain
+	current.NS = append([]string(nil), domain.NS...)
+	current.Records = append([]Record(nil), domain.Records...)
+	records, err := update(current)
+	if err != nil {
+		return err
+	}
+	if slices.Equal(records, domain.Records) {
+		return nil
+	}
+
+	domain.Records = records
+	return m.saveDomain(domain)
+}
+
+// UpdateDomainSettings 更新域名级设置（实现接口），不影响解析记录
+func (m *ViperYAMLManager) UpdateDomainSettings(domainName string, settings DomainSettings) error {
+	m.mu.Lock()
+	defer m.unlock()
+
+	domain, exists := m.domainMap[domainName]
+	if !exists {
+		return fmt.Errorf("域名 %s 不存在", domainName)
+	}
+	if err := checkWritable(domain); err != nil {
+		return err
+	}
+
+	settings.apply(&domain)
+	if err := domain.validateSettings(); err != nil {
+		return err
+	}
+	return m.saveDomain(domain)
 }
 
 // GetRecords 查询域名下所有记录（实现接口）
@@ -259,6 +482,7 @@ func (m *ViperYAMLManager) GetRecords(domainName string) ([]Record, error) {
 	if !exists {
 		return nil, fmt.Errorf("域名 %s 不存在", domainName)
 	}
+	domain, _ = m.served(domain)
 
 	// 返回副本，避免外部修改
 	records := make([]Record, len(domain.Records))
@@ -297,6 +521,7 @@ func (m *ViperYAMLManager) ListDomainsWithPagination(page, pageSize int) (Domain
 	// 创建域名信息列表
 	domainInfos := make([]DomainInfo, 0, len(m.domainMap))
 	for name, domain := range m.domainMap {
+		domain, _ = m.served(domain)
 		domainInfos = append(domainInfos, DomainInfo{
 			Name:        name,
 			RecordCount: len(domain.Records),
@@ -329,17 +554,275 @@ func (m *ViperYAMLManager) ListDomainsWithPagination(page, pageSize int) (Domain
 	}, nil
 }
 
+// ZoneJournal 返回区域自序列号serial以来的变更（实现接口），serial早于日志中保留的变更、域名不存在或从区域尚未同步时返回false
+func (m *ViperYAMLManager) ZoneJournal(domainName string, serial uint32) ([]ZoneDelta, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	domain, exists := m.domainMap[domainName]
+	if !exists {
+		return nil, false
+	}
+	domain, loaded := m.served(domain)
+	if !loaded {
+		return nil, false
+	}
+	return m.journals[domainName].since(serial, domain.SOA.Serial)
+}
+
+// SecondaryZones 列出所有从区域及其当前数据的序列号（实现接口）
+func (m *ViperYAMLManager) SecondaryZones() []SecondaryZone {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var zones []SecondaryZone
+	for name, domain := range m.domainMap {
+		if domain.Secondary == nil {
+			continue
+		}
+		zone := SecondaryZone{Domain: name, Secondary: *domain.Secondary}
+		zone.Secondary.Primaries = append([]string(nil), domain.Secondary.Primaries...)
+		if data, ok := m.secondaries[name]; ok {
+			zone.Serial, zone.Loaded = data.soa.Serial, true
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// UpdateSecondaryZone 发布从区域同步得到的SOA与解析记录（实现接口），数据只保存在内存中；
+// 序列号增大时记录变更日志，本服务作为下游的主服务器时据此提供IXFR
+func (m *ViperYAMLManager) UpdateSecondaryZone(domainName string, soa SOA, records []Record) error {
+	m.mu.Lock()
+	defer m.unlock()
+
+	domain, exists := m.domainMap[domainName]
+	if !exists || domain.Secondary == nil {
+		return fmt.Errorf("域名 %s 不是从区域", domainName)
+	}
+
+	previous, loaded := m.served(domain)
+	m.secondaries[domainName] = secondaryData{soa: soa, records: records}
+	next, _ := m.served(domain)
+
+	journal := m.journal(domainName)
+	if delta, _ := diffZone(previous, next); loaded && serialGreater(soa.Serial, previous.SOA.Serial) {
+		journal.append(delta)
+	} else {
+		journal.reset()
+	}
+	journal.serial = soa.Serial
+
+	m.notifyChange()
+	return nil
+}
+
+// ExpireSecondaryZone 丢弃从区域的数据（实现接口），区域在重新同步前不再对外提供解析
+func (m *ViperYAMLManager) ExpireSecondaryZone(domainName string) {
+	m.mu.Lock()
+	defer m.unlock()
+
+	if _, ok := m.secondaries[domainName]; !ok {
+		return
+	}
+	delete(m.secondaries, domainName)
+	m.journal(domainName).reset()
+	m.notifyChange()
+}
+
+// OnChange 注册数据变更回调（实现接口），注册时立即以当前快照回调一次
+func (m *ViperYAMLManager) OnChange(listener ChangeListener) {
+	m.mu.Lock()
+	m.listeners = append(m.listeners, listener)
+	domains := m.snapshot()
+	m.publishMu.Lock()
+	defer m.publishMu.Unlock()
+	m.mu.Unlock()
+	listener(domains)
+}
+
 // -------------------------- 私有辅助方法 --------------------------
-// updateDomainsNode 更新YAML中的domains节点（使用viper直接更新配置）
-func (m *ViperYAMLManager) updateDomainsNode() error {
+// notifyChange 标记域名数据已变更，释放写锁时通知回调（调用方需持有写锁）
+func (m *ViperYAMLManager) notifyChange() {
+	m.changed = true
+}
+
+// unlock 释放写锁，并把持锁期间的变更发布给回调：先取得发布锁再释放写锁，
+// 回调不阻塞查询与其他读写，且各次变更按发生的顺序送达
+func (m *ViperYAMLManager) unlock() {
+	var listeners []ChangeListener
+	var forwardListeners []ForwardZoneListener
+	var domains []Domain
+	var zones []ForwardZone
+	if m.changed {
+		listeners, domains = m.listeners, m.snapshot()
+	}
+	if m.forwardChanged {
+		forwardListeners, zones = m.forwardListeners, m.forwardZonesSnapshot()
+	}
+	m.changed, m.forwardChanged = false, false
+	if len(listeners) == 0 && len(forwardListeners) == 0 {
+		m.mu.Unlock()
+		return
+	}
+
+	m.publishMu.Lock()
+	defer m.publishMu.Unlock()
+	m.mu.Unlock()
+	for _, listener := range listeners {
+		listener(domains)
+	}
+	for _, listener := range forwardListeners {
+		listener(zones)
+	}
+}
+
+// commitDomain 保存域名数据（调用方需持有写锁）：区域数据或SOA参数变化时递增序列号并记录变更日志；
+// 新域名未配置序列号时以当前时间作为初始序列号，曾被删除的域名的序列号大于删除前发布的序列号；显式配置的更大序列号保持不变
+func (m *ViperYAMLManager) commitDomain(domain Domain) {
+	// 从区域的序列号与变更日志由同步得到的数据决定
+	if domain.Secondary != nil {
+		m.domainMap[domain.Name] = domain
+		return
+	}
+	delete(m.secondaries, domain.Name)
+
+	journal := m.journal(domain.Name)
+	previous, exists := m.domainMap[domain.Name]
+	switch {
+	case !exists:
+		if domain.SOA.Serial == 0 {
+			domain.SOA.Serial = initialSerial()
+		}
+		if journal.serial != 0 && !serialGreater(domain.SOA.Serial, journal.serial) {
+			domain.SOA.Serial = nextSerial(journal.serial)
+		}
+	default:
+		if domain.SOA.Serial == 0 {
+			domain.SOA.Serial = previous.SOA.Serial
+		}
+		delta, changed := diffZone(previous, domain)
+		if changed || domain.SOA.Serial != previous.SOA.Serial {
+			if !serialGreater(domain.SOA.Serial, previous.SOA.Serial) {
+				domain.SOA.Serial = nextSerial(previous.SOA.Serial)
+			}
+			delta.To.Serial = domain.SOA.Serial
+			journal.append(delta)
+		}
+	}
+	journal.serial = domain.SOA.Serial
+	m.domainMap[domain.Name] = domain
+}
+
+// saveDomain 保存域名的修改（调用方需持有写锁）：先无损写回配置文件，成功后再发布到引擎；
+// 写入失败时恢复修改前的数据，修改不会生效
+func (m *ViperYAMLManager) saveDomain(domain Domain) error {
+	undo := m.checkpoint(domain.Name)
+	m.commitDomain(domain)
+	if err := m.updateDomainsNode(); err != nil {
+		undo()
+		return err
+	}
+	m.notifyChange()
+	return nil
+}
+
+// checkpoint 记录域名当前的数据、从区域数据与变更日志，返回恢复到该状态的函数（调用方需持有写锁）
+func (m *ViperYAMLManager) checkpoint(domainName string) func() {
+	domain, exists := m.domainMap[domainName]
+	data, loaded := m.secondaries[domainName]
+	journal, journaled := m.journals[domainName]
+	var saved zoneJournal
+	if journaled {
+		saved = zoneJournal{serial: journal.serial, deltas: slices.Clone(journal.deltas)}
+	}
+	return func() {
+		if exists {
+			m.domainMap[domainName] = domain
+		} else {
+			delete(m.domainMap, domainName)
+		}
+		if loaded {
+			m.secondaries[domainName] = data
+		} else {
+			delete(m.secondaries, domainName)
+		}
+		if journaled {
+			*journal = saved
+		} else {
+			delete(m.journals, domainName)
+		}
+	}
+}
+
+// journal 返回域名的变更日志，不存在时创建（调用方需持有写锁）
+func (m *ViperYAMLManager) journal(domainName string) *zoneJournal {
+	journal, ok := m.journals[domainName]
+	if !ok {
+		journal = &zoneJournal{}
+		m.journals[domainName] = journal
+	}
+	return journal
+}
+
+// served 返回对外提供解析的域名数据（调用方需持有锁）：从区域使用同步得到的SOA与解析记录，
+// 尚未同步或已过期时记录为空并返回false
+func (m *ViperYAMLManager) served(domain Domain) (Domain, bool) {
+	if domain.Secondary == nil {
+		return domain, true
+	}
+	data, ok := m.secondaries[domain.Name]
+	if !ok {
+		domain.Records = nil
+		return domain, false
+	}
+	domain.SOA = data.soa
+	domain.Records = data.records
+	return domain, true
+}
+
+// snapshot 生成当前对外提供解析的域名数据的深拷贝，不包含尚未同步的从区域（调用方需持有锁）
+func (m *ViperYAMLManager) snapshot() []Domain {
+	domains := make([]Domain, 0, len(m.domainMap))
+	for _, domain := range m.domainMap {
+		domain, ok := m.served(domain)
+		if !ok {
+			continue
+		}
+		domain.NS = append([]string(nil), domain.NS...)
+		domain.Records = append([]Record(nil), domain.Records...)
+		domains = append(domains, domain)
+	}
+	return domains
+}
+
+// updateDomainsNode 更新YAML中的domains与forward_zones节点（使用viper直接更新配置）
+// 两个节点总是一起以内存数据为准写入，避免文件被外部修改后viper中残留的旧值被写回；
+// 失败时恢复viper中原有的值，与调用方恢复的内存数据保持一致
+func (m *ViperYAMLManager) updateDomainsNode() (err error) {
 	// 1. 将内存映射转换为[]Domain
 	domains := make([]Domain, 0, len(m.domainMap))
 	for _, domain := range m.domainMap {
 		domains = append(domains, domain)
 	}
 
-	// 2. 使用viper直接设置domains配置
+	// 2. 使用viper直接设置domains与forward_zones配置
+	previousDomains := m.viper.Get("domains")
 	m.viper.Set("domains", domains)
+	if len(m.forwardZones) > 0 || m.viper.IsSet("forward_zones") {
+		previousForwardZones := m.viper.Get("forward_zones")
+		m.viper.Set("forward_zones", m.forwardZones)
+		defer func() {
+			if err != nil {
+				m.viper.Set("forward_zones", previousForwardZones)
+			}
+		}()
+	}
+	defer func() {
+		if err != nil {
+			m.viper.Set("domains", previousDomains)
+		}
+	}()
 
 	// 3. 写回配置文件
 	if err := m.viper.WriteConfig(); err != nil {
@@ -374,6 +857,94 @@ func (m *ViperYAMLManager) updateDomainsNode() error {
 		}
 	}
 
-	// 4. 重新加载Viper保证数据最新
+	// 4. 记录写入后的文件内容，文件监听回调据此跳过自身的写入
+	if data, err := os.ReadFile(m.configPath); err == nil {
+		m.rawYAML = data
+	}
+
+	// 5. 重新加载Viper保证数据最新
 	return m.viper.ReadInConfig()
 }
+
+// apply 将设置写入域名
+func (s DomainSettings) apply(domain *Domain) {
+	if s.NS != nil {
+		domain.NS = s.NS
+	}
+	if s.SOA != nil {
+		domain.SOA = *s.SOA
+	}
+	if s.AnswerOrder != nil {
+		domain.AnswerOrder = *s.AnswerOrder
+	}
+	if s.AnswerLimit != nil {
+		domain.AnswerLimit = *s.AnswerLimit
+	}
+	if s.AutoPTR != nil {
+		domain.AutoPTR = *s.AutoPTR
+	}
+}
+
+// match 判断记录是否满足选择条件
+func (s RecordSelector) match(r Record) bool {
+	return r.Name == s.Name &&
+		(s.Type == "" || strings.EqualFold(r.Type, s.Type)) &&
+		(s.Value == "" || r.Value == s.Value) &&
+		(s.View == nil || r.View == *s.View)
+}
+
+// String 返回选择条件的描述
+func (s RecordSelector) String() string {
+	desc := s.Name
+	if s.Type != "" {
+		desc += "(" + strings.ToUpper(s.Type) + ")"
+	}
+	if s.Value != "" {
+		desc += " " + s.Value
+	}
+	if s.View != nil && *s.View != "" {
+		desc += " @" + *s.View
+	}
+	return desc
+}
+
+// checkWritable 检查域名是否允许修改：从区域的数据由主服务器同步
+func checkWritable(domain Domain) error {
+	if domain.Secondary != nil {
+		return fmt.Errorf("域名 %s 为从区域（主服务器 %s）: %w", domain.Name, strings.Join(domain.Secondary.Primaries, ", "), ErrSecondaryZone)
+	}
+	return nil
+}
+
+// checkCNAMEConflict 检查CNAME与同名的其他记录是否冲突（拥有CNAME的名称不能再有其他记录，RFC 1034），
+// 只比较同一视图内的记录（视图记录会覆盖默认视图中的同名记录），skip为更新时被替换记录的下标（新增时为-1）
+func checkCNAMEConflict(records []Record, record Record, skip int) error {
+	name := canonicalName(record.Name)
+	isCNAME := strings.EqualFold(record.Type, "CNAME")
+	for i, r := range records {
+		if i == skip || r.View != record.View || canonicalName(r.Name) != name {
+			continue
+		}
+		if isCNAME || strings.EqualFold(r.Type, "CNAME") {
+			return fmt.Errorf("记录 %s 已存在 %s 记录，CNAME 不能与同名的其他记录共存", record.Name, r.Type)
+		}
+	}
+	return nil
+}
+
+// decodeNode 从完整YAML节点树中解析顶层key对应的节点到out，节点不存在时保持out不变
+func decodeNode(root *yaml.Node, key string, out any) error {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil
+	}
+	mapping := root.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1].Decode(out)
+		}
+	}
+	return nil
+}
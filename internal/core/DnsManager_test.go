@@ -0,0 +1,140 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// newTestManager 以临时目录中的配置文件创建并加载域名管理器
+func newTestManager(t *testing.T, config string) (*ViperYAMLManager, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	m := NewViperYAMLManager(v, path).(*ViperYAMLManager)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return m, path
+}
+
+const secondaryTestConfig = `domains:
+    - name: primary.test
+      records:
+        - name: www.primary.test
+          type: A
+          value: 192.0.2.1
+          ttl: 300
+    - name: secondary.test
+      secondary:
+        primaries:
+            - 192.0.2.53
+      records: []
+`
+
+// TestAddOrUpdateDomainRejectsSecondary 整体替换从区域时返回 ErrSecondaryZone，区域保持为从区域
+func TestAddOrUpdateDomainRejectsSecondary(t *testing.T) {
+	m, path := newTestManager(t, secondaryTestConfig)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.AddOrUpdateDomain(Domain{
+		Name:    "secondary.test",
+		Records: []Record{{Name: "www.secondary.test", Type: "A", Value: "192.0.2.2", TTL: 300}},
+	})
+	if !errors.Is(err, ErrSecondaryZone) {
+		t.Fatalf("AddOrUpdateDomain() error = %v, want %v", err, ErrSecondaryZone)
+	}
+	domain, err := m.GetDomain("secondary.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain.Secondary == nil || len(domain.Records) != 0 {
+		t.Errorf("secondary zone was modified: %+v", domain)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("config file was rewritten:\n%s", after)
+	}
+
+	// 主区域仍可整体替换
+	if err := m.AddOrUpdateDomain(Domain{Name: "primary.test"}); err != nil {
+		t.Fatalf("AddOrUpdateDomain(primary.test) error = %v", err)
+	}
+}
+
+// TestFailedWriteRestoresState 写回配置文件失败时恢复内存数据与viper中的值，回调不被通知
+func TestFailedWriteRestoresState(t *testing.T) {
+	m, path := newTestManager(t, secondaryTestConfig)
+	notified := 0
+	m.OnChange(func([]Domain) { notified++ })
+	notified = 0
+	before := m.viper.Get("domains")
+
+	// 以同名目录替换配置文件，使写回失败
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := m.AddOrUpdateDomain(Domain{
+		Name:    "new.test",
+		Records: []Record{{Name: "www.new.test", Type: "A", Value: "192.0.2.3", TTL: 300}},
+	})
+	if err == nil {
+		t.Fatal("AddOrUpdateDomain() succeeded although the config file could not be written")
+	}
+	if _, err := m.GetDomain("new.test"); err == nil {
+		t.Error("domain was kept in memory after the failed write")
+	}
+	if after := m.viper.Get("domains"); !reflect.DeepEqual(after, before) {
+		t.Errorf("viper domains after the failed write = %v, want %v", after, before)
+	}
+	if notified != 0 {
+		t.Errorf("listeners were notified %d times for a failed write", notified)
+	}
+}
+
+// TestChangeListenerOutsideLock 回调在写锁释放后执行，回调中可以读取管理器
+func TestChangeListenerOutsideLock(t *testing.T) {
+	m, _ := newTestManager(t, secondaryTestConfig)
+	records := make(chan int, 2)
+	m.OnChange(func([]Domain) {
+		domain, err := m.GetDomain("primary.test")
+		if err != nil {
+			t.Error(err)
+		}
+		records <- len(domain.Records)
+	})
+	<-records
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.AddRecord("primary.test", Record{Name: "mail.primary.test", Type: "A", Value: "192.0.2.4", TTL: 300})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AddRecord() did not return: listener blocked on the manager lock")
+	}
+	if n := <-records; n != 2 {
+		t.Errorf("listener read %d records, want 2", n)
+	}
+}
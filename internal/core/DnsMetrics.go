@@ -0,0 +1,141 @@
+package core
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// rcodeDropped 未作应答的查询在指标中的 rcode 标签值
+const rcodeDropped = "DROPPED"
+
+// engineMetrics DNS查询指标；上游、缓存与dnstap的计数在抓取时从运行状态读取
+type engineMetrics struct {
+	queries      *prometheus.CounterVec
+	localLatency prometheus.Histogram
+
+	upstreamLatency *prometheus.Desc
+	upstreamQueries *prometheus.Desc
+	upstreamErrors  *prometheus.Desc
+	cacheHits       *prometheus.Desc
+	cacheMisses     *prometheus.Desc
+	cacheHitRatio   *prometheus.Desc
+	cacheEntries    *prometheus.Desc
+	dnstapSent      *prometheus.Desc
+	dnstapDropped   *prometheus.Desc
+}
+
+func newEngineMetrics() *engineMetrics {
+	upstreamLabels := []string{"upstream", "zone"}
+	return &engineMetrics{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dnsm_dns_queries_total",
+			Help: "DNS queries by query type, response code and answer source.",
+		}, []string{"qtype", "rcode", "source"}),
+		localLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "dnsm_dns_local_answer_duration_seconds",
+			Help:    "Time spent answering queries from local zones.",
+			Buckets: latencyBuckets,
+		}),
+		upstreamLatency: prometheus.NewDesc("dnsm_upstream_request_duration_seconds", "Time spent on forwarded queries per upstream.", upstreamLabels, nil),
+		upstreamQueries: prometheus.NewDesc("dnsm_upstream_queries_total", "Queries forwarded to each upstream.", upstreamLabels, nil),
+		upstreamErrors:  prometheus.NewDesc("dnsm_upstream_errors_total", "Failed exchanges with each upstream.", upstreamLabels, nil),
+		cacheHits:       prometheus.NewDesc("dnsm_cache_hits_total", "Forwarded queries answered from the cache.", nil, nil),
+		cacheMisses:     prometheus.NewDesc("dnsm_cache_misses_total", "Forwarded queries not found in the cache.", nil, nil),
+		cacheHitRatio:   prometheus.NewDesc("dnsm_cache_hit_ratio", "Cache hit ratio since start.", nil, nil),
+		cacheEntries:    prometheus.NewDesc("dnsm_cache_entries", "Entries currently in the cache.", nil, nil),
+		dnstapSent:      prometheus.NewDesc("dnsm_dnstap_sent_total", "dnstap messages written to the output.", nil, nil),
+		dnstapDropped:   prometheus.NewDesc("dnsm_dnstap_dropped_total", "dnstap messages dropped because the queue was full.", nil, nil),
+	}
+}
+
+// latencyBuckets 耗时直方图分桶（秒），覆盖本地应答的亚毫秒级到上游转发的秒级
+var latencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// newLatencyHistogram 创建单个上游的响应时间直方图，抓取时以所属上游与后缀为标签输出
+func newLatencyHistogram() prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "dnsm_upstream_request_duration_seconds",
+		Buckets: latencyBuckets,
+	})
+}
+
+// finishQuery 查询处理结束：更新指标并记录查询日志，m 为nil表示未作应答
+func (e *DNSEngine) finishQuery(req, m *dns.Msg, client netip.Addr, start time.Time, info queryInfo) {
+	if len(req.Question) == 0 {
+		return
+	}
+	qtype, ok := dns.TypeToString[req.Question[0].Qtype]
+	if !ok {
+		qtype = "OTHER"
+	}
+	rcode := rcodeDropped
+	if m != nil {
+		rcode = dns.RcodeToString[m.Rcode]
+	}
+	e.metrics.queries.WithLabelValues(qtype, rcode, info.source).Inc()
+	if info.source == QuerySourceLocal {
+		e.metrics.localLatency.Observe(time.Since(start).Seconds())
+	}
+
+	e.logQuery(req, m, client, start, info)
+}
+
+// Describe 实现 prometheus.Collector
+func (e *DNSEngine) Describe(ch chan<- *prometheus.Desc) {
+	m := e.metrics
+	m.queries.Describe(ch)
+	m.localLatency.Describe(ch)
+	for _, desc := range []*prometheus.Desc{m.upstreamLatency, m.upstreamQueries, m.upstreamErrors,
+		m.cacheHits, m.cacheMisses, m.cacheHitRatio, m.cacheEntries, m.dnstapSent, m.dnstapDropped} {
+		ch <- desc
+	}
+}
+
+// Collect 实现 prometheus.Collector：输出DNS查询、本地应答耗时、上游、缓存与dnstap指标
+func (e *DNSEngine) Collect(ch chan<- prometheus.Metric) {
+	m := e.metrics
+	m.queries.Collect(ch)
+	m.localLatency.Collect(ch)
+
+	// 上游指标：默认上游的 zone 标签为空，条件转发规则的上游标注所属后缀
+	type group struct {
+		zone  string
+		group *UpstreamGroup
+	}
+	groups := []group{{"", e.forwarder.Load()}}
+	table := e.forwardZones.Load()
+	for _, rule := range table.rules {
+		zone := canonicalName(rule.Name)
+		groups = append(groups, group{zone, table.groups[zone]})
+	}
+	for _, g := range groups {
+		for _, u := range g.group.upstreams {
+			var h dto.Metric
+			if err := u.state.latency.Write(&h); err != nil {
+				continue
+			}
+			buckets := make(map[float64]uint64, len(h.Histogram.GetBucket()))
+			for _, b := range h.Histogram.GetBucket() {
+				buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+			}
+			ch <- prometheus.MustNewConstHistogram(m.upstreamLatency, h.Histogram.GetSampleCount(), h.Histogram.GetSampleSum(), buckets, u.addr, g.zone)
+		}
+	}
+	for _, s := range e.UpstreamStats() {
+		ch <- prometheus.MustNewConstMetric(m.upstreamQueries, prometheus.CounterValue, float64(s.Queries), s.Address, s.Zone)
+		ch <- prometheus.MustNewConstMetric(m.upstreamErrors, prometheus.CounterValue, float64(s.Failures), s.Address, s.Zone)
+	}
+
+	cache := e.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(m.cacheHits, prometheus.CounterValue, float64(cache.Hits))
+	ch <- prometheus.MustNewConstMetric(m.cacheMisses, prometheus.CounterValue, float64(cache.Misses))
+	ch <- prometheus.MustNewConstMetric(m.cacheHitRatio, prometheus.GaugeValue, cache.HitRatio)
+	ch <- prometheus.MustNewConstMetric(m.cacheEntries, prometheus.GaugeValue, float64(cache.Size))
+
+	ch <- prometheus.MustNewConstMetric(m.dnstapSent, prometheus.CounterValue, float64(e.dnstap.sent.Load()))
+	ch <- prometheus.MustNewConstMetric(m.dnstapDropped, prometheus.CounterValue, float64(e.dnstap.lost.Load()))
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// PTRConflict 自动生成PTR时的冲突：同一IP被多个名称使用
+type PTRConflict struct {
+	IP    string   `json:"ip"`    // IP地址
+	PTR   string   `json:"ptr"`   // 反向解析名称（in-addr.arpa/ip6.arpa）
+	Names []string `json:"names"` // 指向该IP的全部名称
+}
+
+// generatedPTR 自动生成的反向解析
+type generatedPTR struct {
+	ip      string
+	domain  Domain
+	records []Record
+}
+
+// addGeneratedPTRs 为开启 auto_ptr 的域名中的A/AAAA记录生成PTR记录：
+// 显式配置的PTR优先；同一IP对应多个名称时全部返回并记录为冲突
+func (idx *zoneIndex) addGeneratedPTRs(domains []Domain) {
+	generated := make(map[string]*generatedPTR)
+	var order []string // 保持生成顺序稳定
+	for _, domain := range domains {
+		if !domain.AutoPTR {
+			continue
+		}
+		for _, record := range domain.Records {
+			rrtype := strings.ToUpper(record.Type)
+			if rrtype != "A" && rrtype != "AAAA" {
+				continue
+			}
+			owner := canonicalName(record.Name)
+			if strings.HasPrefix(owner, "*.") {
+				continue // 泛解析无法生成反向解析
+			}
+			ip := net.ParseIP(strings.TrimSpace(record.Value))
+			if ip == nil {
+				continue
+			}
+			reverse, err := dns.ReverseAddr(ip.String())
+			if err != nil {
+				continue
+			}
+
+			g, exists := generated[reverse]
+			if !exists {
+				g = &generatedPTR{ip: ip.String(), domain: domain}
+				generated[reverse] = g
+				order = append(order, reverse)
+			}
+			if !slices.ContainsFunc(g.records, func(r Record) bool { return canonicalName(r.Value) == owner }) {
+				g.records = append(g.records, Record{Name: reverse, Type: "PTR", Value: owner, TTL: record.TTL})
+			}
+		}
+	}
+
+	for _, reverse := range order {
+		g := generated[reverse]
+		// 显式配置的PTR记录覆盖自动生成的记录
+		if node := idx.names[reverse]; node != nil && len(node.rrsets[dns.TypePTR]) > 0 {
+			continue
+		}
+		if len(g.records) > 1 {
+			conflict := PTRConflict{IP: g.ip, PTR: reverse}
+			for _, r := range g.records {
+				conflict.Names = append(conflict.Names, r.Value)
+			}
+			idx.conflicts = append(idx.conflicts, conflict)
+		}
+		for _, record := range g.records {
+			rr, err := record.RR(reverse)
+			if err != nil {
+				continue
+			}
+			idx.add(g.domain, localRecord{Record: record, rr: rr})
+		}
+	}
+
+	slices.SortFunc(idx.conflicts, func(a, b PTRConflict) int { return strings.Compare(a.PTR, b.PTR) })
+}
+
+// PTRConflicts 返回自动生成PTR时发现的冲突（同一IP对应多个名称）
+func (e *DNSEngine) PTRConflicts() []PTRConflict {
+	conflicts := e.index.Load().conflicts
+	if conflicts == nil {
+		return []PTRConflict{}
+	}
+	return slices.Clone(conflicts)
+}
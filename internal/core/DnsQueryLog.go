@@ -0,0 +1,554 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"dnsm/internal/conf"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// 查询应答来源
+const (
+	QuerySourceLocal    = "local"    // 本地区域
+	QuerySourceCache    = "cache"    // 转发缓存
+	QuerySourceUpstream = "upstream" // 上游
+	QuerySourceBlocked  = "blocked"  // 拦截列表
+	QuerySourceRPZ      = "rpz"      // 响应策略区域改写
+	QuerySourceRefused  = "refused"  // 访问控制拒绝
+	QuerySourceLimited  = "limited"  // 限速：超出查询速率被丢弃或拒绝，或应答被RRL丢弃
+	QuerySourceUpdate   = "update"   // 动态更新
+	QuerySourceTransfer = "transfer" // 区域传送
+	QuerySourceNotify   = "notify"   // 区域变更通知（NOTIFY）
+)
+
+const (
+	queryLogFile          = "querylog.jsonl" // 当前写入的日志文件，轮转后重命名为 querylog-时间.jsonl
+	queryLogRotatedPrefix = "querylog-"
+	queryLogRotatedSuffix = ".jsonl"
+	queryLogQueueSize     = 10000 // 待写入队列长度，写入跟不上时丢弃
+	queryLogFlushInterval = time.Second
+	queryLogCleanInterval = time.Hour
+	maxQueryLogAnswers    = 10      // 应答摘要最多保留的记录数
+	maxQueryLogLine       = 1 << 20 // 单条日志的最大长度
+	queryLogReadBatch     = 256     // 查询时每次从文件读取的日志条数
+)
+
+// -------------------------- 基础数据结构 --------------------------
+// QueryLogEntry 单条查询日志
+type QueryLogEntry struct {
+	Time      time.Time `json:"time"`               // 收到查询的时间
+	Client    string    `json:"client"`             // 客户端地址
+	Name      string    `json:"name"`               // 查询名称
+	Type      string    `json:"type"`               // 查询类型
+	Rcode     string    `json:"rcode"`              // 应答码，未作应答时为空
+	Answer    []string  `json:"answer,omitempty"`   // 应答摘要，如 "A 192.168.1.1"
+	Source    string    `json:"source"`             // 应答来源：local/cache/upstream/blocked/rpz/refused/update
+	Upstream  string    `json:"upstream,omitempty"` // 实际使用的上游
+	LatencyMs float64   `json:"latency_ms"`         // 处理耗时（毫秒）
+	Dropped   bool      `json:"dropped,omitempty"`  // 按策略丢弃，未作应答
+}
+
+// QueryLogFilter 查询日志过滤条件，零值字段表示不过滤
+type QueryLogFilter struct {
+	Client netip.Prefix // 客户端地址或网段
+	Name   string       // 名称模式：包含 * 时按通配匹配，否则按子串匹配（不区分大小写）
+	Type   string       // 查询类型
+	Rcode  string       // 应答码
+	Source string       // 应答来源
+	From   time.Time    // 起始时间（包含）
+	To     time.Time    // 截止时间（包含）
+}
+
+// QueryLogResult 查询日志分页结果（按时间倒序）
+type QueryLogResult struct {
+	Total int64           `json:"total"` // 符合条件的总条数；带过滤条件时读满当前页即停止，只统计到当前页为止
+	More  bool            `json:"more"`  // 当前页之后是否还有符合条件的日志
+	Items []QueryLogEntry `json:"items"` // 当前页日志
+}
+
+// queryLogIndex 日志文件的行索引：各条日志的起始偏移（只包含以换行结尾的完整行）
+type queryLogIndex struct {
+	file    os.FileInfo // 建立索引时的文件，用于识别轮转后新建的同名文件
+	offsets []int64     // 各条日志的起始偏移
+	end     int64       // 已建立索引的字节数
+}
+
+// queryInfo 处理查询过程中记录的应答来源
+type queryInfo struct {
+	source   string
+	upstream string
+}
+
+// QueryLog 查询日志：异步写入按大小轮转的JSON Lines文件，按保留策略清理旧文件
+type QueryLog struct {
+	entries chan QueryLogEntry
+	enabled atomic.Bool
+	dropped atomic.Uint64 // 队列已满被丢弃的条数（定时汇总到日志）
+
+	mu   sync.Mutex // 保护 cfg 与当前文件
+	cfg  conf.QueryLogConfig
+	file *os.File
+	w    *bufio.Writer
+	size int64
+
+	idxMu   sync.Mutex                // 保护 indexes
+	indexes map[string]*queryLogIndex // 文件路径 -> 行索引（查询时按需建立；轮转文件不再变化，当前文件只会追加）
+}
+
+// NewQueryLog 创建查询日志，写入在 Run 启动后进行
+func NewQueryLog(cfg conf.QueryLogConfig) *QueryLog {
+	q := &QueryLog{
+		entries: make(chan QueryLogEntry, queryLogQueueSize),
+		cfg:     cfg,
+		indexes: make(map[string]*queryLogIndex),
+	}
+	q.enabled.Store(cfg.Enabled)
+	return q
+}
+
+// -------------------------- 写入 --------------------------
+// Run 持续写入日志并定时落盘与清理，直到ctx结束
+func (q *QueryLog) Run(ctx context.Context) {
+	flush := time.NewTicker(queryLogFlushInterval)
+	defer flush.Stop()
+	clean := time.NewTicker(queryLogCleanInterval)
+	defer clean.Stop()
+
+	q.cleanup()
+	for {
+		select {
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.closeFile()
+			q.mu.Unlock()
+			return
+		case entry := <-q.entries:
+			q.write(entry)
+		case <-flush.C:
+			if n := q.dropped.Swap(0); n > 0 {
+				log.Printf("Query log queue full, dropped %d entries", n)
+			}
+			q.mu.Lock()
+			q.flush()
+			q.mu.Unlock()
+		case <-clean.C:
+			q.cleanup()
+		}
+	}
+}
+
+// Configure 应用新配置，日志目录变化时关闭当前文件，下次写入时在新目录打开
+func (q *QueryLog) Configure(cfg conf.QueryLogConfig) {
+	q.enabled.Store(cfg.Enabled)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if cfg.Dir != q.cfg.Dir || !cfg.Enabled {
+		q.closeFile()
+	}
+	q.cfg = cfg
+}
+
+// record 提交一条日志，未启用或队列已满时直接返回
+func (q *QueryLog) record(entry QueryLogEntry) {
+	if !q.enabled.Load() {
+		return
+	}
+	select {
+	case q.entries <- entry:
+	default:
+		q.dropped.Add(1)
+	}
+}
+
+// write 写入一条日志，超出单文件大小时先轮转
+func (q *QueryLog) write(entry QueryLogEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.cfg.Enabled {
+		return
+	}
+	if q.file == nil {
+		if err := q.openFile(); err != nil {
+			log.Printf("Failed to open query log: %v", err)
+			return
+		}
+	}
+	if limit := int64(q.cfg.MaxSize) << 20; limit > 0 && q.size > 0 && q.size+int64(len(line)) > limit {
+		if err := q.rotate(); err != nil {
+			log.Printf("Failed to rotate query log: %v", err)
+			return
+		}
+	}
+	n, err := q.w.Write(line)
+	q.size += int64(n)
+	if err != nil {
+		log.Printf("Failed to write query log: %v", err)
+	}
+}
+
+// openFile 打开（或创建）当前日志文件（调用方需持有锁）
+func (q *QueryLog) openFile() error {
+	if err := os.MkdirAll(q.cfg.Dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(q.cfg.Dir, queryLogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	q.file, q.w, q.size = f, bufio.NewWriter(f), info.Size()
+	return nil
+}
+
+// flush 将缓冲数据写入文件（调用方需持有锁）
+func (q *QueryLog) flush() {
+	if q.w != nil {
+		if err := q.w.Flush(); err != nil {
+			log.Printf("Failed to flush query log: %v", err)
+		}
+	}
+}
+
+// closeFile 落盘并关闭当前文件（调用方需持有锁）
+func (q *QueryLog) closeFile() {
+	if q.file == nil {
+		return
+	}
+	q.flush()
+	q.file.Close()
+	q.file, q.w, q.size = nil, nil, 0
+}
+
+// rotate 将当前文件按轮转时间重命名并打开新文件（调用方需持有锁）
+func (q *QueryLog) rotate() error {
+	q.closeFile()
+	rotated := queryLogRotatedPrefix + time.Now().Format("20060102-150405.000") + queryLogRotatedSuffix
+	if err := os.Rename(filepath.Join(q.cfg.Dir, queryLogFile), filepath.Join(q.cfg.Dir, rotated)); err != nil {
+		return err
+	}
+	go q.cleanup()
+	return q.openFile()
+}
+
+// cleanup 删除超过保留时长或超出保留数量的轮转文件
+func (q *QueryLog) cleanup() {
+	q.mu.Lock()
+	cfg := q.cfg
+	q.mu.Unlock()
+	if cfg.Dir == "" || (cfg.MaxAge <= 0 && cfg.MaxFiles <= 0) {
+		return
+	}
+
+	files := rotatedQueryLogs(cfg.Dir)
+	for i, name := range files {
+		remove := cfg.MaxFiles > 0 && i >= cfg.MaxFiles
+		if !remove && cfg.MaxAge > 0 {
+			if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > cfg.MaxAge {
+				remove = true
+			}
+		}
+		if remove {
+			if err := os.Remove(name); err != nil {
+				log.Printf("Failed to remove expired query log %s: %v", name, err)
+			}
+		}
+	}
+}
+
+// rotatedQueryLogs 返回目录下的轮转文件（新文件在前）
+func rotatedQueryLogs(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, queryLogRotatedPrefix) && strings.HasSuffix(name, queryLogRotatedSuffix) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	// 文件名中的时间保证字典序即时间顺序
+	slices.Sort(files)
+	slices.Reverse(files)
+	return files
+}
+
+// -------------------------- 查询 --------------------------
+// Query 按条件分页查询日志（按时间倒序），分页参数的处理与域名分页查询一致
+// 文件按从新到旧的顺序倒序读取：不带过滤条件时总条数取自各文件的行索引，只读取当前页；
+// 带过滤条件时读满当前页并确认是否还有下一条后即停止
+func (q *QueryLog) Query(filter QueryLogFilter, page, pageSize int) (QueryLogResult, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20 // 默认每页20条
+	}
+
+	q.mu.Lock()
+	q.flush()
+	dir := q.cfg.Dir
+	q.mu.Unlock()
+
+	files := append([]string{filepath.Join(dir, queryLogFile)}, rotatedQueryLogs(dir)...)
+	q.pruneIndexes(files)
+
+	skip := (page - 1) * pageSize
+	unfiltered := filter.isZero()
+	result := QueryLogResult{Items: []QueryLogEntry{}}
+	for _, name := range files {
+		if result.More && !unfiltered {
+			break
+		}
+		// 文件的修改时间不早于其中最新的日志，早于起始时间的文件可直接跳过
+		info, err := os.Stat(name)
+		if err != nil || (!filter.From.IsZero() && info.ModTime().Before(filter.From)) {
+			continue
+		}
+		if err := q.queryFile(name, filter, unfiltered, pageSize, &skip, &result); err != nil {
+			return QueryLogResult{}, fmt.Errorf("读取查询日志失败: %w", err)
+		}
+	}
+	if unfiltered {
+		result.More = int64((page-1)*pageSize+len(result.Items)) < result.Total
+	}
+	return result, nil
+}
+
+// queryFile 从新到旧读取单个文件中的日志，填充当前页；skip 为当前页之前尚需跳过的条数
+func (q *QueryLog) queryFile(name string, filter QueryLogFilter, unfiltered bool, pageSize int, skip *int, result *QueryLogResult) error {
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 文件在列出后被轮转或清理
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	idx, err := q.fileIndex(f, name)
+	if err != nil {
+		return err
+	}
+
+	n := len(idx.offsets)
+	if unfiltered {
+		// 不带过滤条件时每条日志都符合，直接按索引跳过当前页之前的日志
+		result.Total += int64(n)
+		if len(result.Items) == pageSize || *skip >= n {
+			*skip -= min(*skip, n)
+			return nil
+		}
+		n -= *skip
+		*skip = 0
+	}
+	return idx.readReverse(f, n, func(line []byte) bool {
+		var entry QueryLogEntry
+		if json.Unmarshal(line, &entry) != nil || !filter.match(entry) {
+			return true
+		}
+		if len(result.Items) == pageSize {
+			result.More = true
+			return false
+		}
+		if !unfiltered {
+			result.Total++
+			if *skip > 0 {
+				*skip--
+				return true
+			}
+		}
+		result.Items = append(result.Items, entry)
+		return true
+	})
+}
+
+// fileIndex 返回文件的行索引：已有索引时只扫描其后追加的内容，文件被替换或截断时重新建立
+func (q *QueryLog) fileIndex(f *os.File, name string) (queryLogIndex, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return queryLogIndex{}, err
+	}
+
+	q.idxMu.Lock()
+	defer q.idxMu.Unlock()
+	idx, ok := q.indexes[name]
+	if !ok || !os.SameFile(idx.file, info) || info.Size() < idx.end {
+		idx = &queryLogIndex{}
+		q.indexes[name] = idx
+	}
+	idx.file = info
+	if info.Size() > idx.end {
+		if _, err := f.Seek(idx.end, io.SeekStart); err != nil {
+			return queryLogIndex{}, err
+		}
+		scanner := bufio.NewScanner(io.LimitReader(f, info.Size()-idx.end))
+		scanner.Buffer(make([]byte, 0, 64<<10), maxQueryLogLine)
+		scanner.Split(scanFullLines)
+		pos := idx.end
+		for scanner.Scan() {
+			if len(scanner.Bytes()) > 0 {
+				idx.offsets = append(idx.offsets, pos)
+			}
+			pos += int64(len(scanner.Bytes())) + 1
+		}
+		idx.end = pos
+		if err := scanner.Err(); err != nil {
+			return queryLogIndex{}, err
+		}
+	}
+	// 返回副本：之后追加的偏移不影响调用方持有的切片
+	return *idx, nil
+}
+
+// pruneIndexes 丢弃已被清理的文件的行索引
+func (q *QueryLog) pruneIndexes(files []string) {
+	q.idxMu.Lock()
+	defer q.idxMu.Unlock()
+	for name := range q.indexes {
+		if !slices.Contains(files, name) {
+			delete(q.indexes, name)
+		}
+	}
+}
+
+// scanFullLines bufio.Scanner 的分割函数：只返回以换行结尾的行，文件末尾尚未写完的行留待下次扫描
+func scanFullLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	return 0, nil, nil
+}
+
+// readReverse 从第 n-1 条到第 0 条倒序读取日志，每次读取一批，fn 返回false时停止
+func (idx queryLogIndex) readReverse(f *os.File, n int, fn func(line []byte) bool) error {
+	var buf []byte
+	for hi := n; hi > 0; {
+		lo := max(hi-queryLogReadBatch, 0)
+		base, end := idx.offsets[lo], idx.lineEnd(hi-1)
+		buf = slices.Grow(buf[:0], int(end-base))[:end-base]
+		if _, err := f.ReadAt(buf, base); err != nil {
+			return err
+		}
+		for i := hi - 1; i >= lo; i-- {
+			line := bytes.TrimRight(buf[idx.offsets[i]-base:idx.lineEnd(i)-base], "\n")
+			if !fn(line) {
+				return nil
+			}
+		}
+		hi = lo
+	}
+	return nil
+}
+
+// lineEnd 返回第 i 条日志（含换行）的结束偏移
+func (idx queryLogIndex) lineEnd(i int) int64 {
+	if i+1 < len(idx.offsets) {
+		return idx.offsets[i+1]
+	}
+	return idx.end
+}
+
+// isZero 判断是否未设置任何过滤条件
+func (f QueryLogFilter) isZero() bool {
+	return !f.Client.IsValid() && f.Name == "" && f.Type == "" && f.Rcode == "" && f.Source == "" && f.From.IsZero() && f.To.IsZero()
+}
+
+// match 判断日志是否符合过滤条件
+func (f QueryLogFilter) match(entry QueryLogEntry) bool {
+	if !f.From.IsZero() && entry.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && entry.Time.After(f.To) {
+		return false
+	}
+	if f.Type != "" && !strings.EqualFold(entry.Type, f.Type) {
+		return false
+	}
+	if f.Rcode != "" && !strings.EqualFold(entry.Rcode, f.Rcode) {
+		return false
+	}
+	if f.Source != "" && entry.Source != f.Source {
+		return false
+	}
+	if f.Client.IsValid() {
+		addr, err := netip.ParseAddr(entry.Client)
+		if err != nil || !f.Client.Contains(addr) {
+			return false
+		}
+	}
+	if f.Name != "" {
+		pattern := strings.ToLower(strings.TrimSuffix(f.Name, "."))
+		name := strings.ToLower(strings.TrimSuffix(entry.Name, "."))
+		if strings.Contains(pattern, "*") {
+			if ok, _ := path.Match(pattern, name); !ok {
+				return false
+			}
+		} else if !strings.Contains(name, pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// -------------------------- 引擎接入 --------------------------
+// logQuery 记录一条查询日志，m 为nil表示未作应答
+func (e *DNSEngine) logQuery(req, m *dns.Msg, client netip.Addr, start time.Time, info queryInfo) {
+	if len(req.Question) == 0 || !e.queryLog.enabled.Load() {
+		return
+	}
+	q := req.Question[0]
+	entry := QueryLogEntry{
+		Time:      start,
+		Client:    client.String(),
+		Name:      q.Name,
+		Type:      dns.TypeToString[q.Qtype],
+		Source:    info.source,
+		Upstream:  info.upstream,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Dropped:   m == nil,
+	}
+	if entry.Type == "" {
+		entry.Type = fmt.Sprintf("TYPE%d", q.Qtype)
+	}
+	if m != nil {
+		entry.Rcode = dns.RcodeToString[m.Rcode]
+		for _, rr := range m.Answer[:min(len(m.Answer), maxQueryLogAnswers)] {
+			entry.Answer = append(entry.Answer, dns.TypeToString[rr.Header().Rrtype]+" "+
+				strings.TrimPrefix(rr.String(), rr.Header().String()))
+		}
+	}
+	e.queryLog.record(entry)
+}
+
+// QueryLog 按条件分页查询查询日志
+func (e *DNSEngine) QueryLog(filter QueryLogFilter, page, pageSize int) (QueryLogResult, error) {
+	return e.queryLog.Query(filter, page, pageSize)
+}
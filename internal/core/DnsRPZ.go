@@ -0,0 +1,653 @@
+package core
+
+import (
+	"context"
+	"dnsm/internal/conf"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RPZ 策略动作
+const (
+	RPZActionNXDomain  = "nxdomain"   // CNAME .
+	RPZActionNoData    = "nodata"     // CNAME *.
+	RPZActionPassthru  = "passthru"   // CNAME rpz-passthru.，不改写应答（同时跳过拦截列表）
+	RPZActionDrop      = "drop"       // CNAME rpz-drop.，不作应答
+	RPZActionLocalData = "local-data" // 其他记录：以规则中的记录作为应答
+)
+
+// RPZ 触发类型
+const (
+	RPZTriggerQName   = "qname"       // 查询名称（及上游应答CNAME链中的名称）
+	RPZTriggerIP      = "response-ip" // 上游应答中的A/AAAA地址（rpz-ip）
+	RPZTriggerNSDName = "nsdname"     // 查询名称所在区域的权威服务器名称（rpz-nsdname）
+)
+
+const (
+	rpzTransferTimeout = 30 * time.Second
+	maxRPZNSLookups    = 2 // 确定NSDNAME时最多额外查询NS的次数
+)
+
+// -------------------------- 基础数据结构 --------------------------
+// rpzRule 单条策略规则
+type rpzRule struct {
+	zone   *rpzZone
+	owner  string   // 规则在区域中的所有者名称（用于日志）
+	action string   // 策略动作
+	data   []dns.RR // local-data 动作的应答记录
+}
+
+// rpzIPRule 应答地址触发规则
+type rpzIPRule struct {
+	prefix netip.Prefix
+	rule   *rpzRule
+}
+
+// rpzZone 编译后的策略区域
+type rpzZone struct {
+	name       string   // 规范化的区域名称
+	soa        *dns.SOA // 改写为NXDOMAIN/NODATA时放入授权部分，区域未包含SOA时为nil
+	qname      map[string]*rpzRule
+	qnameWild  map[string]*rpzRule // *.example.com 以 example.com. 为键，只匹配子域名
+	nsdname    map[string]*rpzRule
+	nsdWild    map[string]*rpzRule
+	ips        []rpzIPRule
+	rules      int    // 有效规则数
+	skipped    int    // 因触发类型或动作不支持（rpz-client-ip、rpz-nsip、rpz-tcp-only等）被跳过的规则数
+	loadedFrom string // 区域文件路径或 axfr://主服务器
+}
+
+// rpzTable 全部策略区域（每次刷新整体重建并通过原子指针发布）
+type rpzTable struct {
+	zones      []*rpzZone
+	hasIP      bool
+	hasNSDName bool
+}
+
+// rpzHit 策略命中结果
+type rpzHit struct {
+	trigger string // 触发类型
+	name    string // 命中的名称或地址
+	rule    *rpzRule
+}
+
+// RPZ 响应策略区域：从区域文件或主服务器（AXFR）加载，定时刷新
+type RPZ struct {
+	table  atomic.Pointer[rpzTable] // 未启用或尚未加载时为nil
+	reload chan struct{}            // 配置变更后通知刷新循环立即刷新
+
+	mu        sync.Mutex // 保护 cfg 与 zones
+	cfg       conf.RPZConfig
+	zones     map[conf.RPZZone]*rpzZone // 最近一次成功加载的区域，加载失败时沿用
+	refreshMu sync.Mutex                // 串行化刷新
+}
+
+// NewRPZ 创建响应策略区域，区域在 Run 启动后加载
+func NewRPZ(cfg conf.RPZConfig) *RPZ {
+	return &RPZ{
+		reload: make(chan struct{}, 1),
+		cfg:    cfg,
+		zones:  make(map[conf.RPZZone]*rpzZone),
+	}
+}
+
+// -------------------------- 生命周期 --------------------------
+// Run 加载策略区域并按 refresh_interval 定时刷新，直到ctx结束；配置变更时立即刷新
+func (r *RPZ) Run(ctx context.Context) {
+	runRefreshLoop(ctx, r.reload, func() time.Duration {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.cfg.RefreshInterval
+	}, func() {
+		_ = r.Refresh()
+	})
+}
+
+// Configure 应用新配置，区域或刷新间隔变化时通知刷新循环重新加载
+func (r *RPZ) Configure(cfg conf.RPZConfig) {
+	r.mu.Lock()
+	changed := !reflect.DeepEqual(r.cfg, cfg)
+	r.cfg = cfg
+	r.mu.Unlock()
+
+	if !cfg.Enabled {
+		r.table.Store(nil)
+	}
+	if changed {
+		select {
+		case r.reload <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Refresh 重新加载全部策略区域并发布；单个区域加载失败时沿用其上次成功加载的结果
+func (r *RPZ) Refresh() error {
+	r.refreshMu.Lock()
+	defer r.refreshMu.Unlock()
+
+	r.mu.Lock()
+	cfg := r.cfg
+	previous := r.zones
+	r.mu.Unlock()
+	if !cfg.Enabled {
+		r.table.Store(nil)
+		return fmt.Errorf("RPZ未启用")
+	}
+
+	table := &rpzTable{}
+	zones := make(map[conf.RPZZone]*rpzZone, len(cfg.Zones))
+	for _, zc := range cfg.Zones {
+		z, err := loadRPZZone(zc, previous[zc])
+		if err != nil {
+			log.Printf("Failed to load RPZ zone %s: %v", zc.Name, err)
+			if z = previous[zc]; z == nil {
+				continue
+			}
+		}
+		zones[zc] = z
+		table.zones = append(table.zones, z)
+		table.hasIP = table.hasIP || len(z.ips) > 0
+		table.hasNSDName = table.hasNSDName || len(z.nsdname)+len(z.nsdWild) > 0
+	}
+
+	r.mu.Lock()
+	r.zones = zones
+	// 刷新期间配置被关闭时不再发布
+	if r.cfg.Enabled {
+		r.table.Store(table)
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// policy 返回当前生效的策略区域，未启用时返回nil
+func (r *RPZ) policy() *rpzTable {
+	return r.table.Load()
+}
+
+// -------------------------- 区域加载与解析 --------------------------
+// loadRPZZone 从区域文件或主服务器加载策略区域；主服务器的SOA序列号未变化时沿用previous
+func loadRPZZone(zc conf.RPZZone, previous *rpzZone) (*rpzZone, error) {
+	if zc.Name == "" {
+		return nil, fmt.Errorf("区域名称不能为空")
+	}
+	if (zc.Path == "") == (zc.Primary == "") {
+		return nil, fmt.Errorf("path 与 primary 必须且只能配置一个")
+	}
+	origin := canonicalName(zc.Name)
+
+	var rrs []dns.RR
+	if zc.Path != "" {
+		f, err := os.Open(zc.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		zp := dns.NewZoneParser(f, origin, zc.Path)
+		for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+			rrs = append(rrs, rr)
+		}
+		if err := zp.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		primary := primaryAddr(zc.Primary)
+		if previous != nil && previous.soa != nil {
+			if serial, err := querySerial(origin, primary, nil, ""); err == nil && serial == previous.soa.Serial {
+				return previous, nil
+			}
+		}
+		m := new(dns.Msg)
+		m.SetAxfr(origin)
+		var err error
+		if rrs, err = transferZone(m, primary, nil, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	z := parseRPZZone(zc, origin, rrs)
+	serial := uint32(0)
+	if z.soa != nil {
+		serial = z.soa.Serial
+	}
+	log.Printf("Loaded RPZ zone %s from %s: %d rules (serial %d, %d unsupported skipped)", origin, z.loadedFrom, z.rules, serial, z.skipped)
+	return z, nil
+}
+
+// primaryAddr 为未指定端口的主服务器地址补齐53端口
+func primaryAddr(primary string) string {
+	if _, _, err := net.SplitHostPort(primary); err != nil {
+		return net.JoinHostPort(primary, "53")
+	}
+	return primary
+}
+
+// querySerial 查询主服务器上区域的SOA序列号，key 非空时使用 keyring 中的该密钥签名
+func querySerial(origin, primary string, keyring *tsigKeyring, key string) (uint32, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(origin, dns.TypeSOA)
+	c := &dns.Client{Net: "tcp", Timeout: 5 * time.Second}
+	if key != "" {
+		if err := keyring.signRequest(m, key); err != nil {
+			return 0, err
+		}
+		c.TsigProvider = keyring
+	}
+	resp, _, err := c.Exchange(m, primary)
+	if err != nil {
+		return 0, err
+	}
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("主服务器未返回 %s 的SOA记录", origin)
+}
+
+// transferZone 按请求m（AXFR或IXFR）从主服务器拉取区域，返回传送的全部记录；key 非空时使用 keyring 中的该密钥签名
+func transferZone(m *dns.Msg, primary string, keyring *tsigKeyring, key string) ([]dns.RR, error) {
+	t := &dns.Transfer{DialTimeout: 5 * time.Second, ReadTimeout: rpzTransferTimeout}
+	if key != "" {
+		if err := keyring.signRequest(m, key); err != nil {
+			return nil, err
+		}
+		t.TsigProvider = keyring
+	}
+	ch, err := t.In(m, primary)
+	if err != nil {
+		return nil, err
+	}
+	var rrs []dns.RR
+	for env := range ch {
+		if env.Error != nil {
+			return nil, env.Error
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	if len(rrs) == 0 {
+		return nil, fmt.Errorf("区域传送未返回任何记录")
+	}
+	return rrs, nil
+}
+
+// parseRPZZone 将区域记录编译为策略规则，同一所有者名称的记录合并为一条规则
+func parseRPZZone(zc conf.RPZZone, origin string, rrs []dns.RR) *rpzZone {
+	z := &rpzZone{
+		name:       origin,
+		qname:      make(map[string]*rpzRule),
+		qnameWild:  make(map[string]*rpzRule),
+		nsdname:    make(map[string]*rpzRule),
+		nsdWild:    make(map[string]*rpzRule),
+		loadedFrom: zc.Path,
+	}
+	if zc.Primary != "" {
+		z.loadedFrom = "axfr://" + zc.Primary
+	}
+
+	owners := make([]string, 0, len(rrs))
+	sets := make(map[string][]dns.RR, len(rrs))
+	for _, rr := range rrs {
+		owner := canonicalName(rr.Header().Name)
+		if owner == origin {
+			if soa, ok := rr.(*dns.SOA); ok && z.soa == nil {
+				z.soa = soa
+			}
+			continue
+		}
+		if !strings.HasSuffix(owner, "."+origin) {
+			continue
+		}
+		if _, exists := sets[owner]; !exists {
+			owners = append(owners, owner)
+		}
+		sets[owner] = append(sets[owner], rr)
+	}
+
+	for _, owner := range owners {
+		action, data, ok := rpzAction(sets[owner])
+		if !ok {
+			z.skipped++
+			continue
+		}
+		rule := &rpzRule{zone: z, owner: owner, action: action, data: data}
+		trigger := strings.TrimSuffix(owner, origin)
+		switch {
+		case strings.HasSuffix(trigger, ".rpz-ip."):
+			prefix, err := parseRPZIP(strings.TrimSuffix(trigger, ".rpz-ip."))
+			if err != nil {
+				log.Printf("Skipping invalid RPZ response-ip trigger %s: %v", owner, err)
+				z.skipped++
+				continue
+			}
+			z.ips = append(z.ips, rpzIPRule{prefix: prefix, rule: rule})
+		case strings.HasSuffix(trigger, ".rpz-nsdname."):
+			addRPZName(z.nsdname, z.nsdWild, strings.TrimSuffix(trigger, "rpz-nsdname."), rule)
+		case strings.HasSuffix(trigger, ".rpz-client-ip."), strings.HasSuffix(trigger, ".rpz-nsip."):
+			z.skipped++
+			continue
+		default:
+			addRPZName(z.qname, z.qnameWild, trigger, rule)
+		}
+		z.rules++
+	}
+	return z
+}
+
+// addRPZName 添加名称触发规则，*. 开头的规则只匹配子域名
+func addRPZName(exact, wildcard map[string]*rpzRule, name string, rule *rpzRule) {
+	if rest, ok := strings.CutPrefix(name, "*."); ok {
+		wildcard[rest] = rule
+		return
+	}
+	exact[name] = rule
+}
+
+// rpzAction 根据规则的记录确定策略动作，不支持的动作返回false
+func rpzAction(rrs []dns.RR) (string, []dns.RR, bool) {
+	for _, rr := range rrs {
+		cname, ok := rr.(*dns.CNAME)
+		if !ok {
+			continue
+		}
+		switch target := strings.ToLower(cname.Target); {
+		case target == ".":
+			return RPZActionNXDomain, nil, true
+		case target == "*.":
+			return RPZActionNoData, nil, true
+		case target == "rpz-passthru.":
+			return RPZActionPassthru, nil, true
+		case target == "rpz-drop.":
+			return RPZActionDrop, nil, true
+		case strings.HasPrefix(target, "rpz-"), strings.HasPrefix(target, "*."):
+			// rpz-tcp-only. 与按查询名称改写的通配CNAME暂不支持
+			return "", nil, false
+		}
+	}
+	return RPZActionLocalData, rrs, true
+}
+
+// parseRPZIP 解析 rpz-ip 触发名称（前缀长度在前、地址倒序，IPv6中 zz 表示 ::），
+// 如 24.0.2.0.192 表示 192.0.2.0/24，128.1.zz.db8.2001 表示 2001:db8::1/128
+func parseRPZIP(s string) (netip.Prefix, error) {
+	labels := dns.SplitDomainName(s)
+	if len(labels) < 2 {
+		return netip.Prefix{}, fmt.Errorf("格式错误")
+	}
+	bits, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	parts := slices.Clone(labels[1:])
+	slices.Reverse(parts)
+
+	var addr string
+	if len(parts) == 4 && !slices.Contains(parts, "zz") {
+		addr = strings.Join(parts, ".")
+	} else {
+		for i, part := range parts {
+			if part == "zz" {
+				parts[i] = ""
+			}
+		}
+		addr = strings.Join(parts, ":")
+		if strings.HasPrefix(addr, ":") {
+			addr = ":" + addr
+		}
+		if strings.HasSuffix(addr, ":") {
+			addr += ":"
+		}
+	}
+	prefix, err := netip.ParsePrefix(addr + "/" + strconv.Itoa(bits))
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+// -------------------------- 匹配 --------------------------
+// matchQName 按配置顺序查找第一个命中名称的区域，区域内精确规则优先，其次为最具体的通配规则
+func (t *rpzTable) matchQName(name string) *rpzHit {
+	if t == nil {
+		return nil
+	}
+	name = canonicalName(name)
+	for _, z := range t.zones {
+		if rule := matchRPZName(z.qname, z.qnameWild, name); rule != nil {
+			return &rpzHit{trigger: RPZTriggerQName, name: name, rule: rule}
+		}
+	}
+	return nil
+}
+
+// matchIP 按配置顺序查找第一个命中任一应答地址的区域，区域内最长前缀优先
+func (t *rpzTable) matchIP(addrs []netip.Addr) *rpzHit {
+	if t == nil || !t.hasIP || len(addrs) == 0 {
+		return nil
+	}
+	for _, z := range t.zones {
+		var best *rpzIPRule
+		var bestAddr netip.Addr
+		for i := range z.ips {
+			ip := &z.ips[i]
+			for _, addr := range addrs {
+				if (best == nil || ip.prefix.Bits() > best.prefix.Bits()) && ip.prefix.Contains(addr) {
+					best, bestAddr = ip, addr
+				}
+			}
+		}
+		if best != nil {
+			return &rpzHit{trigger: RPZTriggerIP, name: bestAddr.String(), rule: best.rule}
+		}
+	}
+	return nil
+}
+
+// matchNSDName 按配置顺序查找第一个命中任一权威服务器名称的区域
+func (t *rpzTable) matchNSDName(names []string) *rpzHit {
+	if t == nil || !t.hasNSDName {
+		return nil
+	}
+	for _, z := range t.zones {
+		for _, name := range names {
+			if rule := matchRPZName(z.nsdname, z.nsdWild, name); rule != nil {
+				return &rpzHit{trigger: RPZTriggerNSDName, name: name, rule: rule}
+			}
+		}
+	}
+	return nil
+}
+
+// matchRPZName 精确规则优先，其次从父域名开始向上查找最具体的通配规则
+func matchRPZName(exact, wildcard map[string]*rpzRule, name string) *rpzRule {
+	if rule, ok := exact[name]; ok {
+		return rule
+	}
+	if len(wildcard) == 0 {
+		return nil
+	}
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		if rule, ok := wildcard[name[off:]]; ok {
+			return rule
+		}
+	}
+	return nil
+}
+
+// -------------------------- 策略应用 --------------------------
+// rpzResponse 对上游应答依次检查CNAME链中的名称、应答地址与权威服务器名称，返回命中结果与需要保留的CNAME链
+func (e *DNSEngine) rpzResponse(policy *rpzTable, qname string, resp *dns.Msg) (*rpzHit, []dns.RR) {
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, nil
+	}
+	var addrs []netip.Addr
+	for i, rr := range resp.Answer {
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			if hit := policy.matchQName(rr.Target); hit != nil {
+				return hit, resp.Answer[:i+1]
+			}
+		case *dns.A:
+			if addr, ok := netip.AddrFromSlice(rr.A.To4()); ok {
+				addrs = append(addrs, addr)
+			}
+		case *dns.AAAA:
+			if addr, ok := netip.AddrFromSlice(rr.AAAA); ok {
+				addrs = append(addrs, addr.Unmap())
+			}
+		}
+	}
+	if hit := policy.matchIP(addrs); hit != nil {
+		return hit, nil
+	}
+	if policy != nil && policy.hasNSDName {
+		if hit := policy.matchNSDName(e.rpzNSNames(qname, resp)); hit != nil {
+			return hit, nil
+		}
+	}
+	return nil, nil
+}
+
+// rpzNSNames 返回查询名称所在区域的权威服务器名称：优先使用应答授权部分中的NS记录，
+// 否则通过上游（经过缓存）查询最近的区域顶点的NS记录
+func (e *DNSEngine) rpzNSNames(qname string, resp *dns.Msg) []string {
+	if names := nsTargets(resp.Ns); len(names) > 0 {
+		return names
+	}
+	zone := soaOwner(resp.Ns, qname)
+	for range maxRPZNSLookups {
+		query := new(dns.Msg)
+		query.SetQuestion(zone, dns.TypeNS)
+		query.RecursionDesired = true
+		r, err := e.ForwardRequest(query)
+		if err != nil || r == nil {
+			return nil
+		}
+		if names := nsTargets(r.Answer); len(names) > 0 {
+			return names
+		}
+		next := soaOwner(r.Ns, zone)
+		if next == zone {
+			return nil
+		}
+		zone = next
+	}
+	return nil
+}
+
+// nsTargets 提取NS记录的目标名称
+func nsTargets(rrs []dns.RR) []string {
+	var names []string
+	for _, rr := range rrs {
+		if ns, ok := rr.(*dns.NS); ok {
+			names = append(names, canonicalName(ns.Ns))
+		}
+	}
+	return names
+}
+
+// soaOwner 返回授权部分中SOA记录的所有者名称（即区域顶点），没有时返回fallback
+func soaOwner(rrs []dns.RR, fallback string) string {
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Hdr.Name
+		}
+	}
+	return fallback
+}
+
+// applyRPZ 按命中规则改写应答，chain 为需要保留的上游CNAME链（命中链中的名称时）；返回false表示丢弃查询不作应答
+func (e *DNSEngine) applyRPZ(idx *zoneIndex, m, req *dns.Msg, hit *rpzHit, chain []dns.RR) bool {
+	q := req.Question[0]
+	owner := q.Name
+	if len(chain) > 0 {
+		owner = chain[len(chain)-1].(*dns.CNAME).Target
+	}
+
+	m.Answer = append([]dns.RR(nil), chain...)
+	m.Ns, m.Extra = nil, nil
+	m.Rcode = dns.RcodeSuccess
+	m.Authoritative = false
+
+	rule := hit.rule
+	switch rule.action {
+	case RPZActionDrop:
+		return false
+	case RPZActionNXDomain:
+		m.Rcode = dns.RcodeNameError
+		m.Ns = rule.zone.negativeSOA()
+	case RPZActionNoData:
+		m.Ns = rule.zone.negativeSOA()
+	case RPZActionLocalData:
+		var cname *dns.CNAME
+		var answers []dns.RR
+		for _, rr := range rule.data {
+			rr = dns.Copy(rr)
+			rr.Header().Name = owner
+			if c, ok := rr.(*dns.CNAME); ok {
+				cname = c
+			} else if q.Qtype == dns.TypeANY || rr.Header().Rrtype == q.Qtype {
+				answers = append(answers, rr)
+			}
+		}
+		switch {
+		case cname != nil && q.Qtype != dns.TypeCNAME:
+			// 改写为CNAME时继续解析目标：本地区域优先，否则转发上游
+			m.Answer = append(m.Answer, cname)
+			e.chaseRPZTarget(idx, m, req, cname.Target, q.Qtype)
+		case cname != nil:
+			m.Answer = append(m.Answer, cname)
+		case len(answers) == 0:
+			m.Ns = rule.zone.negativeSOA()
+		default:
+			m.Answer = append(m.Answer, answers...)
+		}
+	}
+	return true
+}
+
+// chaseRPZTarget 解析 local-data CNAME 的目标
+func (e *DNSEngine) chaseRPZTarget(idx *zoneIndex, m, req *dns.Msg, target string, qtype uint16) {
+	query := new(dns.Msg)
+	query.SetQuestion(target, qtype)
+	local := new(dns.Msg)
+	local.SetReply(query)
+	if e.answerLocal(idx, local, query, true) {
+		m.Answer = append(m.Answer, local.Answer...)
+		if local.Rcode != dns.RcodeSuccess || len(local.Answer) == 0 {
+			m.Ns = append(m.Ns, local.Ns...)
+		}
+		m.Rcode = local.Rcode
+		return
+	}
+	e.chaseUpstream(m, req, target, qtype)
+}
+
+// negativeSOA 改写为NXDOMAIN/NODATA时放入授权部分的SOA（TTL取SOA TTL与minimum的较小值）
+func (z *rpzZone) negativeSOA() []dns.RR {
+	if z.soa == nil {
+		return nil
+	}
+	soa := dns.Copy(z.soa).(*dns.SOA)
+	soa.Hdr.Ttl = min(soa.Hdr.Ttl, soa.Minttl)
+	return []dns.RR{soa}
+}
+
+// logRPZHit 记录策略命中
+func logRPZHit(hit *rpzHit, qname string, client netip.Addr) {
+	log.Printf("RPZ %s hit for %s from %s: %s matched rule %s in zone %s, action %s",
+		hit.trigger, qname, client, hit.name, hit.rule.owner, hit.rule.zone.name, hit.rule.action)
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// mustRRs 解析区域文件格式的记录
+func mustRRs(t *testing.T, lines ...string) []dns.RR {
+	t.Helper()
+	rrs := make([]dns.RR, 0, len(lines))
+	for _, line := range lines {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			t.Fatalf("dns.NewRR(%q): %v", line, err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+func TestParseRPZIP(t *testing.T) {
+	tests := []struct {
+		trigger string
+		want    string // 为空表示解析失败
+	}{
+		{trigger: "32.1.2.0.192", want: "192.0.2.1/32"},
+		{trigger: "24.0.2.0.192", want: "192.0.2.0/24"},
+		{trigger: "24.99.2.0.192", want: "192.0.2.0/24"}, // 主机位被清零
+		{trigger: "128.1.zz.db8.2001", want: "2001:db8::1/128"},
+		{trigger: "48.zz.db8.2001", want: "2001:db8::/48"},
+		{trigger: "128.1.zz", want: "::1/128"},
+		{trigger: "64.0.0.0.0.0.0.0.1", want: "1::/64"},
+		{trigger: "33.1.2.0.192"},
+		{trigger: "x.1.2.0.192"},
+		{trigger: "24.2.0.192"},
+		{trigger: "24"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.trigger, func(t *testing.T) {
+			got, err := parseRPZIP(tt.trigger)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("parseRPZIP(%s) = %s, want an error", tt.trigger, got)
+				}
+				return
+			}
+			if err != nil || got != netip.MustParsePrefix(tt.want) {
+				t.Errorf("parseRPZIP(%s) = %s, %v, want %s", tt.trigger, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRPZAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		rrs      []string
+		want     string // 为空表示不支持
+		wantData int
+	}{
+		{name: "nxdomain", rrs: []string{"a.rpz.test. 300 IN CNAME ."}, want: RPZActionNXDomain},
+		{name: "nodata", rrs: []string{"a.rpz.test. 300 IN CNAME *."}, want: RPZActionNoData},
+		{name: "passthru", rrs: []string{"a.rpz.test. 300 IN CNAME rpz-passthru."}, want: RPZActionPassthru},
+		{name: "drop", rrs: []string{"a.rpz.test. 300 IN CNAME RPZ-DROP."}, want: RPZActionDrop},
+		{name: "local data", rrs: []string{"a.rpz.test. 300 IN A 192.0.2.1", "a.rpz.test. 300 IN AAAA 2001:db8::1"}, want: RPZActionLocalData, wantData: 2},
+		{name: "local cname", rrs: []string{"a.rpz.test. 300 IN CNAME walled.example.test."}, want: RPZActionLocalData, wantData: 1},
+		{name: "tcp only", rrs: []string{"a.rpz.test. 300 IN CNAME rpz-tcp-only."}},
+		{name: "wildcard rewrite", rrs: []string{"a.rpz.test. 300 IN CNAME *.walled.example.test."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, data, ok := rpzAction(mustRRs(t, tt.rrs...))
+			if ok != (tt.want != "") || action != tt.want || len(data) != tt.wantData {
+				t.Errorf("rpzAction() = %q, %d records, %v, want %q with %d records", action, len(data), ok, tt.want, tt.wantData)
+			}
+		})
+	}
+}
+
+// TestRPZZoneMatching 精确规则优先于通配规则，通配规则只匹配子域名，应答地址按最长前缀匹配，不支持的触发类型被跳过
+func TestRPZZoneMatching(t *testing.T) {
+	rrs := mustRRs(t,
+		"rpz.test. 300 IN SOA ns.rpz.test. hostmaster.rpz.test. 1 3600 600 86400 60",
+		"bad.example.test.rpz.test. 300 IN CNAME .",
+		"*.bad.example.test.rpz.test. 300 IN CNAME *.",
+		"ok.bad.example.test.rpz.test. 300 IN CNAME rpz-passthru.",
+		"24.0.2.0.192.rpz-ip.rpz.test. 300 IN CNAME .",
+		"32.7.2.0.192.rpz-ip.rpz.test. 300 IN CNAME rpz-passthru.",
+		"ns.evil.test.rpz-nsdname.rpz.test. 300 IN CNAME .",
+		"32.1.0.0.10.rpz-client-ip.rpz.test. 300 IN CNAME .",
+	)
+	z := parseRPZZone(conf.RPZZone{Name: "rpz.test", Path: "rpz.zone"}, "rpz.test.", rrs)
+	if z.soa == nil || z.rules != 6 || z.skipped != 1 {
+		t.Fatalf("zone has SOA %v, %d rules and %d skipped, want SOA, 6 rules and 1 skipped", z.soa != nil, z.rules, z.skipped)
+	}
+	table := &rpzTable{zones: []*rpzZone{z}, hasIP: true, hasNSDName: true}
+
+	qnames := []struct {
+		qname string
+		want  string // 为空表示不命中
+	}{
+		{qname: "bad.example.test.", want: RPZActionNXDomain},
+		{qname: "Www.Bad.Example.Test.", want: RPZActionNoData},
+		{qname: "ok.bad.example.test.", want: RPZActionPassthru},
+		{qname: "example.test."},
+	}
+	for _, tt := range qnames {
+		hit := table.matchQName(tt.qname)
+		if got := ""; hit != nil {
+			got = hit.rule.action
+			if got != tt.want {
+				t.Errorf("matchQName(%s) = %s, want %q", tt.qname, got, tt.want)
+			}
+		} else if tt.want != "" {
+			t.Errorf("matchQName(%s) = no hit, want %s", tt.qname, tt.want)
+		}
+	}
+
+	if hit := table.matchIP([]netip.Addr{netip.MustParseAddr("198.51.100.1"), netip.MustParseAddr("192.0.2.7")}); hit == nil ||
+		hit.rule.action != RPZActionPassthru || hit.name != "192.0.2.7" {
+		t.Errorf("matchIP() = %+v, want the /32 passthru rule for 192.0.2.7", hit)
+	}
+	if hit := table.matchIP([]netip.Addr{netip.MustParseAddr("192.0.2.9")}); hit == nil || hit.rule.action != RPZActionNXDomain {
+		t.Errorf("matchIP(192.0.2.9) = %+v, want the /24 nxdomain rule", hit)
+	}
+	if hit := table.matchNSDName([]string{"ns.evil.test."}); hit == nil || !strings.HasPrefix(hit.rule.owner, "ns.evil.test.") {
+		t.Errorf("matchNSDName() = %+v, want the ns.evil.test rule", hit)
+	}
+}
@@ -0,0 +1,340 @@
+package core
+
+import (
+	"cmp"
+	"dnsm/internal/conf"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	maxRateLimitEntries = 100000           // 限速状态最多保留的条目数，超出时淘汰最久未使用的条目
+	rateLimitSweepEvery = 30 * time.Second // 清理空闲限速状态的间隔
+	maxLimitedClients   = 10000            // 限速统计最多保留的客户端网段数量
+	defaultRRLWindow    = 15 * time.Second
+)
+
+// RRL 判定结果
+const (
+	rrlPass = iota // 正常应答
+	rrlDrop        // 丢弃应答
+	rrlSlip        // 返回截断应答，让真实客户端改用TCP重试
+)
+
+// RRL 应答分类（不同类别分别计数）
+const (
+	rrlResponse = iota // 正常应答与NODATA：按查询名与类型计数
+	rrlNXDomain        // NXDOMAIN：按区域计数
+	rrlError           // 错误应答：按应答码计数
+)
+
+// -------------------------- 基础数据结构 --------------------------
+// RateLimitStats 单个客户端网段的限速统计
+type RateLimitStats struct {
+	Client      string    `json:"client"`       // 客户端网段
+	Throttled   uint64    `json:"throttled"`    // 超出查询限速被丢弃/拒绝的查询数
+	RRLDropped  uint64    `json:"rrl_dropped"`  // 被RRL丢弃的应答数
+	RRLSlipped  uint64    `json:"rrl_slipped"`  // 被RRL替换为截断应答的应答数
+	LastLimited time.Time `json:"last_limited"` // 最近一次被限速的时间
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// queryLimiter 按客户端网段的查询限速（配置重载时整体替换，令牌桶状态随之重置）
+type queryLimiter struct {
+	enabled    bool
+	rate       float64        // 每秒补充的令牌数
+	burst      float64        // 令牌桶容量
+	v4, v6     int            // 合并计数的前缀长度
+	exempt     []netip.Prefix // 豁免的客户端网段
+	rrlEnabled bool
+	rrl        *responseLimiter
+
+	mu        sync.Mutex
+	buckets   *lruTable[netip.Prefix, *tokenBucket]
+	lastSweep time.Time
+}
+
+// rrlKey RRL计数键：客户端网段 + 应答分类 + 分类下的名称/类型
+type rrlKey struct {
+	client netip.Prefix
+	kind   int
+	name   string
+	qtype  uint16
+}
+
+// rrlEntry RRL计数状态：balance 为可用额度，超限后最低降到 -window*rate，因此持续超限时限速最长持续一个窗口
+type rrlEntry struct {
+	balance float64
+	last    time.Time
+	slips   int
+}
+
+// responseLimiter BIND风格的应答限速
+type responseLimiter struct {
+	responses float64 // 各分类每秒允许的应答数
+	nxdomains float64
+	errors    float64
+	window    time.Duration
+	slip      int
+	v4, v6    int
+
+	mu        sync.Mutex
+	entries   *lruTable[rrlKey, *rrlEntry]
+	lastSweep time.Time
+}
+
+// limitCounter 按客户端网段统计被限速的查询与应答
+type limitCounter struct {
+	mu      sync.Mutex
+	clients *lruTable[netip.Prefix, *RateLimitStats]
+}
+
+// -------------------------- 构建 --------------------------
+// newQueryLimiter 根据配置创建限速器
+func newQueryLimiter(cfg conf.RateLimitConfig) *queryLimiter {
+	l := &queryLimiter{
+		enabled:    cfg.Enabled && cfg.QPS > 0,
+		rate:       cfg.QPS,
+		burst:      float64(max(cfg.Burst, 1)),
+		v4:         prefixLen(cfg.IPv4Prefix, 32),
+		v6:         prefixLen(cfg.IPv6Prefix, 128),
+		exempt:     parseACLPrefixes("rate_limit.exempt", cfg.Exempt),
+		buckets:    newLRUTable[netip.Prefix, *tokenBucket](maxRateLimitEntries),
+		rrlEnabled: cfg.RRL.Enabled && cfg.RRL.ResponsesPerSecond > 0,
+	}
+	if l.rrlEnabled {
+		rrl := cfg.RRL
+		l.rrl = &responseLimiter{
+			responses: float64(rrl.ResponsesPerSecond),
+			nxdomains: float64(cmp.Or(rrl.NXDomainsPerSecond, rrl.ResponsesPerSecond)),
+			errors:    float64(cmp.Or(rrl.ErrorsPerSecond, rrl.ResponsesPerSecond)),
+			window:    cmp.Or(rrl.Window, defaultRRLWindow),
+			slip:      max(rrl.Slip, 0),
+			v4:        prefixLen(rrl.IPv4Prefix, 32),
+			v6:        prefixLen(rrl.IPv6Prefix, 128),
+			entries:   newLRUTable[rrlKey, *rrlEntry](maxRateLimitEntries),
+		}
+	}
+	return l
+}
+
+// prefixLen 校正前缀长度，超出范围时使用地址全长
+func prefixLen(bits, full int) int {
+	if bits <= 0 || bits > full {
+		return full
+	}
+	return bits
+}
+
+// clientPrefix 按前缀长度将客户端地址合并为网段
+func clientPrefix(addr netip.Addr, v4, v6 int) netip.Prefix {
+	bits := v6
+	if addr.Is4() {
+		bits = v4
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return netip.PrefixFrom(addr, addr.BitLen())
+	}
+	return prefix
+}
+
+// -------------------------- 查询限速 --------------------------
+// allow 判断客户端的查询是否在限速范围内，返回客户端所属网段
+func (l *queryLimiter) allow(addr netip.Addr) (netip.Prefix, bool) {
+	if !l.enabled || !addr.IsValid() || containsAddr(l.exempt, addr) {
+		return netip.Prefix{}, true
+	}
+	prefix := clientPrefix(addr, l.v4, l.v6)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > rateLimitSweepEvery {
+		l.sweep(now)
+	}
+	b, exists := l.buckets.get(prefix)
+	if !exists {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets.add(prefix, b)
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return prefix, false
+	}
+	b.tokens--
+	return prefix, true
+}
+
+// sweep 删除已经回满的令牌桶（调用方需持有锁）
+func (l *queryLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	l.buckets.deleteFunc(func(_ netip.Prefix, b *tokenBucket) bool {
+		return b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst
+	})
+}
+
+// -------------------------- 应答限速（RRL） --------------------------
+// checkResponse 判断UDP应答是否超出RRL限速，返回判定结果与客户端所属网段
+func (l *queryLimiter) checkResponse(addr netip.Addr, m *dns.Msg) (int, netip.Prefix) {
+	if !l.rrlEnabled || !addr.IsValid() || containsAddr(l.exempt, addr) {
+		return rrlPass, netip.Prefix{}
+	}
+	return l.rrl.check(addr, m)
+}
+
+// check 按客户端网段与应答分类计数，超出额度时按slip决定丢弃或返回截断应答
+func (r *responseLimiter) check(addr netip.Addr, m *dns.Msg) (int, netip.Prefix) {
+	key, rate := r.classify(m)
+	key.client = clientPrefix(addr, r.v4, r.v6)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.lastSweep) > r.window {
+		r.sweep(now)
+	}
+	e, exists := r.entries.get(key)
+	if !exists {
+		e = &rrlEntry{balance: rate, last: now}
+		r.entries.add(key, e)
+	}
+	e.balance = min(rate, e.balance+now.Sub(e.last).Seconds()*rate) - 1
+	e.balance = max(e.balance, -r.window.Seconds()*rate)
+	e.last = now
+	if e.balance >= 0 {
+		return rrlPass, key.client
+	}
+	if r.slip > 0 {
+		e.slips++
+		if e.slips%r.slip == 0 {
+			return rrlSlip, key.client
+		}
+	}
+	return rrlDrop, key.client
+}
+
+// classify 对应答分类，返回计数键（不含客户端）与对应的限速
+func (r *responseLimiter) classify(m *dns.Msg) (rrlKey, float64) {
+	var q dns.Question
+	if len(m.Question) > 0 {
+		q = m.Question[0]
+	}
+	switch m.Rcode {
+	case dns.RcodeSuccess:
+		return rrlKey{kind: rrlResponse, name: strings.ToLower(q.Name), qtype: q.Qtype}, r.responses
+	case dns.RcodeNameError:
+		// 同一区域下随机名称的NXDOMAIN合并计数
+		name := strings.ToLower(q.Name)
+		for _, rr := range m.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				name = strings.ToLower(soa.Hdr.Name)
+				break
+			}
+		}
+		return rrlKey{kind: rrlNXDomain, name: name}, r.nxdomains
+	default:
+		return rrlKey{kind: rrlError, qtype: uint16(m.Rcode)}, r.errors
+	}
+}
+
+// sweep 删除窗口内没有应答的计数状态（调用方需持有锁）
+func (r *responseLimiter) sweep(now time.Time) {
+	r.lastSweep = now
+	r.entries.deleteFunc(func(_ rrlKey, e *rrlEntry) bool {
+		return now.Sub(e.last) > r.window
+	})
+}
+
+// slipMsg 将应答替换为截断的空应答，真实客户端会改用TCP重试，伪造源地址的攻击流量则无法被放大
+func slipMsg(m *dns.Msg) {
+	m.Truncated = true
+	m.Answer, m.Ns, m.Extra = nil, nil, nil
+}
+
+// writeRateLimited 写回应答，UDP应答先经过RRL：超限时丢弃或替换为截断应答；应答被丢弃时返回false
+func (e *DNSEngine) writeRateLimited(w dns.ResponseWriter, req, m *dns.Msg, client netip.Addr) bool {
+	if isUDP(w) {
+		switch verdict, prefix := e.limiter.Load().checkResponse(client, m); verdict {
+		case rrlDrop:
+			e.limited.add(prefix, func(s *RateLimitStats) { s.RRLDropped++ })
+			return false
+		case rrlSlip:
+			e.limited.add(prefix, func(s *RateLimitStats) { s.RRLSlipped++ })
+			slipMsg(m)
+		}
+	}
+	e.writeMsg(w, req, m)
+	return true
+}
+
+// -------------------------- 限速统计 --------------------------
+// ReloadRateLimit 配置重载后重建限速器（令牌桶与RRL状态重置，统计保留）
+func (e *DNSEngine) ReloadRateLimit() {
+	e.limiter.Store(newQueryLimiter(e.conf.GetServer().RateLimit))
+}
+
+// RateLimitStats 返回各客户端网段的限速统计（按被限速次数降序）
+func (e *DNSEngine) RateLimitStats() []RateLimitStats {
+	return e.limited.stats()
+}
+
+// ResetRateLimitStats 清空限速统计
+func (e *DNSEngine) ResetRateLimitStats() {
+	e.limited.reset()
+}
+
+func newLimitCounter() *limitCounter {
+	return &limitCounter{clients: newLRUTable[netip.Prefix, *RateLimitStats](maxLimitedClients)}
+}
+
+// add 记录一次限速，update 更新对应的计数
+func (c *limitCounter) add(client netip.Prefix, update func(s *RateLimitStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, exists := c.clients.get(client)
+	if !exists {
+		s = &RateLimitStats{Client: client.String()}
+		c.clients.add(client, s)
+	}
+	update(s)
+	s.LastLimited = time.Now()
+}
+
+// stats 返回统计快照（按被限速次数降序）
+func (c *limitCounter) stats() []RateLimitStats {
+	c.mu.Lock()
+	stats := make([]RateLimitStats, 0, c.clients.len())
+	for _, s := range c.clients.values() {
+		stats = append(stats, *s)
+	}
+	c.mu.Unlock()
+
+	total := func(s RateLimitStats) uint64 { return s.Throttled + s.RRLDropped + s.RRLSlipped }
+	slices.SortFunc(stats, func(a, b RateLimitStats) int {
+		if n := cmp.Compare(total(b), total(a)); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Client, b.Client)
+	})
+	return stats
+}
+
+// reset 清空统计
+func (c *limitCounter) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clients = newLRUTable[netip.Prefix, *RateLimitStats](maxLimitedClients)
+}
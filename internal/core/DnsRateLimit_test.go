@@ -0,0 +1,175 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// floodAddr 返回第 i 个互不相同的IPv4地址
+func floodAddr(i int) netip.Addr {
+	return netip.AddrFrom4([4]byte{10, byte(i >> 16), byte(i >> 8), byte(i)})
+}
+
+func TestQueryLimiterTokenBucket(t *testing.T) {
+	l := newQueryLimiter(conf.RateLimitConfig{Enabled: true, QPS: 2, Burst: 3, IPv4Prefix: 24, Exempt: []string{"192.0.2.0/24"}})
+	client := netip.MustParseAddr("198.51.100.7")
+
+	for i := range 3 {
+		if _, ok := l.allow(client); !ok {
+			t.Fatalf("query %d within the burst was limited", i+1)
+		}
+	}
+	prefix, ok := l.allow(client)
+	if ok {
+		t.Fatal("query beyond the burst was allowed")
+	}
+	if want := netip.MustParsePrefix("198.51.100.0/24"); prefix != want {
+		t.Errorf("client prefix = %s, want %s", prefix, want)
+	}
+	// 同一网段内的其他地址共用令牌桶
+	if _, ok := l.allow(netip.MustParseAddr("198.51.100.8")); ok {
+		t.Error("address in the same prefix should share the bucket")
+	}
+
+	// 一秒后补充 QPS 个令牌
+	b, _ := l.buckets.get(prefix)
+	b.last = b.last.Add(-time.Second)
+	for i := range 2 {
+		if _, ok := l.allow(client); !ok {
+			t.Fatalf("query %d after refill was limited", i+1)
+		}
+	}
+	if _, ok := l.allow(client); ok {
+		t.Error("query beyond the refilled tokens was allowed")
+	}
+
+	for range 10 {
+		if _, ok := l.allow(netip.MustParseAddr("192.0.2.1")); !ok {
+			t.Fatal("exempt client was limited")
+		}
+	}
+}
+
+// TestQueryLimiterFullTable 令牌桶表写满后仍对新客户端限速，而不是放行
+func TestQueryLimiterFullTable(t *testing.T) {
+	l := newQueryLimiter(conf.RateLimitConfig{Enabled: true, QPS: 1, Burst: 2})
+	for i := range maxRateLimitEntries {
+		l.allow(floodAddr(i))
+	}
+	if n := l.buckets.len(); n != maxRateLimitEntries {
+		t.Fatalf("tracked %d buckets, want %d", n, maxRateLimitEntries)
+	}
+
+	client := netip.MustParseAddr("198.51.100.7")
+	for i := range 2 {
+		if _, ok := l.allow(client); !ok {
+			t.Fatalf("query %d within the burst was limited", i+1)
+		}
+	}
+	if _, ok := l.allow(client); ok {
+		t.Error("new client went unlimited once the bucket table was full")
+	}
+	if n := l.buckets.len(); n != maxRateLimitEntries {
+		t.Errorf("tracked %d buckets, want %d", n, maxRateLimitEntries)
+	}
+}
+
+// rrlReply 构造对 name 的A记录应答
+func rrlReply(name string, rcode int) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+	m := new(dns.Msg)
+	m.SetRcode(req, rcode)
+	if rcode == dns.RcodeSuccess {
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP("192.0.2.1"),
+		})
+	}
+	return m
+}
+
+func TestResponseLimiterSlip(t *testing.T) {
+	tests := []struct {
+		name string
+		slip int
+		want []int // 超出额度后各应答的判定
+	}{
+		{name: "drop all", slip: 0, want: []int{rrlDrop, rrlDrop, rrlDrop, rrlDrop}},
+		{name: "slip every response", slip: 1, want: []int{rrlSlip, rrlSlip, rrlSlip, rrlSlip}},
+		{name: "slip every second response", slip: 2, want: []int{rrlDrop, rrlSlip, rrlDrop, rrlSlip}},
+	}
+	client := netip.MustParseAddr("198.51.100.7")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newQueryLimiter(conf.RateLimitConfig{RRL: conf.RRLConfig{Enabled: true, ResponsesPerSecond: 2, Slip: tt.slip}})
+			for i := range 2 {
+				if verdict, _ := l.checkResponse(client, rrlReply("www.example.test.", dns.RcodeSuccess)); verdict != rrlPass {
+					t.Fatalf("response %d within the rate = %d, want pass", i+1, verdict)
+				}
+			}
+			for i, want := range tt.want {
+				if verdict, _ := l.checkResponse(client, rrlReply("www.example.test.", dns.RcodeSuccess)); verdict != want {
+					t.Errorf("limited response %d = %d, want %d", i+1, verdict, want)
+				}
+			}
+			// 不同的查询名分别计数
+			if verdict, _ := l.checkResponse(client, rrlReply("other.example.test.", dns.RcodeSuccess)); verdict != rrlPass {
+				t.Errorf("response for another name = %d, want pass", verdict)
+			}
+		})
+	}
+}
+
+// TestResponseLimiterNXDomainByZone 同一区域下不同名称的NXDOMAIN合并计数
+func TestResponseLimiterNXDomainByZone(t *testing.T) {
+	l := newQueryLimiter(conf.RateLimitConfig{RRL: conf.RRLConfig{Enabled: true, ResponsesPerSecond: 10, NXDomainsPerSecond: 2}})
+	client := netip.MustParseAddr("198.51.100.7")
+	nxdomain := func(name string) *dns.Msg {
+		m := rrlReply(name, dns.RcodeNameError)
+		m.Ns = append(m.Ns, &dns.SOA{Hdr: dns.RR_Header{Name: "example.test.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300}})
+		return m
+	}
+	for i, name := range []string{"a.example.test.", "b.example.test."} {
+		if verdict, _ := l.checkResponse(client, nxdomain(name)); verdict != rrlPass {
+			t.Fatalf("NXDOMAIN %d = %d, want pass", i+1, verdict)
+		}
+	}
+	if verdict, _ := l.checkResponse(client, nxdomain("c.example.test.")); verdict != rrlDrop {
+		t.Errorf("NXDOMAIN beyond the zone's rate = %d, want drop", verdict)
+	}
+}
+
+// TestResponseLimiterFullTable RRL状态表写满后仍对新的应答计数限速
+func TestResponseLimiterFullTable(t *testing.T) {
+	l := newQueryLimiter(conf.RateLimitConfig{RRL: conf.RRLConfig{Enabled: true, ResponsesPerSecond: 1}})
+	reply := rrlReply("www.example.test.", dns.RcodeSuccess)
+	for i := range maxRateLimitEntries {
+		l.checkResponse(floodAddr(i), reply)
+	}
+
+	client := netip.MustParseAddr("198.51.100.7")
+	if verdict, _ := l.checkResponse(client, reply); verdict != rrlPass {
+		t.Fatalf("first response = %d, want pass", verdict)
+	}
+	if verdict, _ := l.checkResponse(client, reply); verdict != rrlDrop {
+		t.Errorf("response beyond the rate with a full table = %d, want drop", verdict)
+	}
+}
+
+func TestSlipMsgTruncates(t *testing.T) {
+	m := rrlReply("www.example.test.", dns.RcodeSuccess)
+	m.Ns = append(m.Ns, &dns.NS{Hdr: dns.RR_Header{Name: "example.test.", Rrtype: dns.TypeNS, Class: dns.ClassINET}, Ns: "ns1.example.test."})
+	slipMsg(m)
+	if !m.Truncated || len(m.Answer) != 0 || len(m.Ns) != 0 || len(m.Extra) != 0 {
+		t.Errorf("slipped response = %v, want an empty truncated response", m)
+	}
+	if len(m.Question) != 1 || m.Rcode != dns.RcodeSuccess {
+		t.Error("slipped response should keep the question and rcode")
+	}
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxTXTStringLen TXT记录单个字符串的最大长度
+const maxTXTStringLen = 255
+
+// -------------------------- 记录转换 --------------------------
+// RData 返回记录的RDATA文本（区域文件格式）
+// 未单独处理的类型直接使用Value作为RDATA（Value须为单个字段，见 checkValue）
+func (r Record) RData() string {
+	value := strings.TrimSpace(r.Value)
+	switch strings.ToUpper(r.Type) {
+	case "CNAME", "NS", "PTR", "DNAME":
+		return dns.Fqdn(value)
+	case "MX":
+		return fmt.Sprintf("%d %s", r.Priority, dns.Fqdn(value))
+	case "SRV":
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, dns.Fqdn(value))
+	case "CAA":
+		return fmt.Sprintf("%d %s %s", r.Flags, r.Tag, quoteTXT(r.Value))
+	case "HTTPS", "SVCB":
+		rdata := fmt.Sprintf("%d %s", r.Priority, dns.Fqdn(value))
+		if params := strings.TrimSpace(r.Params); params != "" {
+			rdata += " " + params
+		}
+		return rdata
+	case "TXT", "SPF":
+		// 超过255字节的文本拆分为多个字符串
+		text := r.Value
+		parts := make([]string, 0, len(text)/maxTXTStringLen+1)
+		for len(text) > maxTXTStringLen {
+			parts = append(parts, quoteTXT(text[:maxTXTStringLen]))
+			text = text[maxTXTStringLen:]
+		}
+		parts = append(parts, quoteTXT(text))
+		return strings.Join(parts, " ")
+	default:
+		return value
+	}
+}
+
+// RR 将记录转换为以owner为所有者名的DNS资源记录（通过 dns.NewRR 解析区域文件格式文本）
+func (r Record) RR(owner string) (dns.RR, error) {
+	rrtype := strings.ToUpper(strings.TrimSpace(r.Type))
+	if _, ok := dns.StringToType[rrtype]; !ok {
+		return nil, fmt.Errorf("不支持的记录类型: %s", r.Type)
+	}
+	if r.TTL < 0 {
+		return nil, fmt.Errorf("TTL不能为负数")
+	}
+
+	if err := r.checkValue(rrtype); err != nil {
+		return nil, fmt.Errorf("记录 %s(%s) %w", r.Name, rrtype, err)
+	}
+
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(owner), r.TTL, rrtype, r.RData()))
+	if err != nil {
+		return nil, fmt.Errorf("记录 %s(%s) 格式错误: %w", r.Name, rrtype, err)
+	}
+	if rr == nil {
+		return nil, fmt.Errorf("记录 %s(%s) 缺少记录值", r.Name, rrtype)
+	}
+	return rr, nil
+}
+
+// checkValue 校验记录值能否原样写入RDATA文本：目标域名须为合法域名，未单独编码的类型只能包含一个字段，
+// 避免值中的空白、注释或括号把额外的字段带入区域文件文本
+func (r Record) checkValue(rrtype string) error {
+	value := strings.TrimSpace(r.Value)
+	switch rrtype {
+	case "TXT", "SPF":
+		// 记录值作为带引号的字符串写入
+		return nil
+	case "CAA":
+		// 标签原样写入，值作为带引号的字符串写入
+		if !isCAATag(r.Tag) {
+			return fmt.Errorf("CAA标签 %q 须为1至15个字母或数字", r.Tag)
+		}
+		return nil
+	case "CNAME", "NS", "PTR", "DNAME", "MX", "SRV", "HTTPS", "SVCB":
+		if _, ok := dns.IsDomainName(value); !ok || !isSingleToken(value) {
+			return fmt.Errorf("目标 %q 不是合法的域名", r.Value)
+		}
+		if strings.ContainsAny(r.Params, ";()\r\n") {
+			return fmt.Errorf("服务参数 %q 包含非法字符", r.Params)
+		}
+	default:
+		if !isSingleToken(value) {
+			return fmt.Errorf("记录值 %q 只能包含一个字段", r.Value)
+		}
+	}
+	return nil
+}
+
+// isSingleToken 判断文本是否为区域文件中的单个非空字段
+func isSingleToken(s string) bool {
+	return s != "" && !strings.ContainsAny(s, " \t\r\n;()\"")
+}
+
+// isCAATag 判断CAA标签是否为1至15个ASCII字母或数字（RFC 8659 §4.1）
+func isCAATag(tag string) bool {
+	if tag == "" || len(tag) > 15 {
+		return false
+	}
+	for _, c := range tag {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate 校验记录是否能生成合法的DNS资源记录
+func (r Record) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("记录名称不能为空")
+	}
+	if _, ok := dns.IsDomainName(r.Name); !ok {
+		return fmt.Errorf("记录名称 %s 不是合法的域名", r.Name)
+	}
+	_, err := r.RR(r.Name)
+	return err
+}
+
+// sameData 判断两条记录是否为同一条记录（同一视图、同名、同类型、RDATA相同）
+func (r Record) sameData(other Record) bool {
+	return r.View == other.View &&
+		canonicalName(r.Name) == canonicalName(other.Name) &&
+		strings.EqualFold(r.Type, other.Type) &&
+		r.RData() == other.RData()
+}
+
+// Validate 校验域名设置及其下所有记录
+func (d Domain) Validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return fmt.Errorf("域名名称不能为空")
+	}
+	if _, ok := dns.IsDomainName(d.Name); !ok {
+		return fmt.Errorf("域名 %s 不合法", d.Name)
+	}
+	if err := d.validateSettings(); err != nil {
+		return err
+	}
+	if d.Secondary != nil && len(d.Records) > 0 {
+		return fmt.Errorf("从区域 %s 的记录由主服务器同步，不能配置解析记录", d.Name)
+	}
+	for i, r := range d.Records {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		if err := d.checkRecordView(r); err != nil {
+			return err
+		}
+		for _, prev := range d.Records[:i] {
+			if prev.sameData(r) {
+				return fmt.Errorf("记录 %s(%s) %s 重复", r.Name, r.Type, r.Value)
+			}
+		}
+		if err := checkCNAMEConflict(d.Records[:i], r, -1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRecordView 检查记录所属视图：归属视图的域名下只能包含默认视图或同一视图的记录
+func (d Domain) checkRecordView(r Record) error {
+	if d.View != "" && r.View != "" && r.View != d.View {
+		return fmt.Errorf("记录 %s(%s) 的视图 %s 与域名 %s 所属视图 %s 不一致", r.Name, r.Type, r.View, d.Name, d.View)
+	}
+	return nil
+}
+
+// validateSettings 校验域名级设置
+func (d Domain) validateSettings() error {
+	switch d.AnswerOrder {
+	case "", AnswerOrderFixed, AnswerOrderRoundRobin, AnswerOrderRandom, AnswerOrderWeighted:
+	default:
+		return fmt.Errorf("不支持的应答顺序策略: %s", d.AnswerOrder)
+	}
+	if d.AnswerLimit < 0 {
+		return fmt.Errorf("answer_limit 不能为负数")
+	}
+	for _, ns := range d.NS {
+		if _, ok := dns.IsDomainName(ns); !ok || ns == "" {
+			return fmt.Errorf("NS %s 不是合法的域名", ns)
+		}
+	}
+	if d.Secondary != nil {
+		if len(d.Secondary.Primaries) == 0 {
+			return fmt.Errorf("从区域 %s 未配置主服务器", d.Name)
+		}
+		for _, primary := range d.Secondary.Primaries {
+			if strings.TrimSpace(primary) == "" {
+				return fmt.Errorf("从区域 %s 的主服务器地址不能为空", d.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// quoteTXT 将文本转义为带引号的字符串
+func quoteTXT(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, `"`, `\"`)
+	return `"` + text + `"`
+}
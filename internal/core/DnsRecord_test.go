@@ -0,0 +1,44 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRecordValidateCAA(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		value   string
+		wantErr bool
+	}{
+		{name: "issue", tag: "issue", value: "letsencrypt.org"},
+		{name: "iodef", tag: "iodef", value: "mailto:security@example.test"},
+		{name: "value with spaces", tag: "issue", value: "ca.example.test; account=1 2"},
+		{name: "empty tag", tag: "", value: "letsencrypt.org", wantErr: true},
+		{name: "tag with field separator", tag: "issue 0 issue", value: "letsencrypt.org", wantErr: true},
+		{name: "tag with comment", tag: "issue;", value: "letsencrypt.org", wantErr: true},
+		{name: "tag with hyphen", tag: "issue-wild", value: "letsencrypt.org", wantErr: true},
+		{name: "tag too long", tag: "issuewildissuewild", value: "letsencrypt.org", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Record{Name: "example.test", Type: "CAA", Tag: tt.tag, Value: tt.value, TTL: 300}
+			err := r.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			rr, err := r.RR(r.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if caa := rr.(*dns.CAA); caa.Tag != tt.tag || caa.Value != tt.value {
+				t.Errorf("RR() = %s, want tag %q value %q", rr, tt.tag, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,536 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	secondaryMinInterval  = 10 * time.Second // 两次检查之间的最短间隔（SOA的refresh/retry过小时使用）
+	secondaryInitialRetry = 30 * time.Second // 区域尚未同步成功时的最长重试间隔
+	secondaryResolveWait  = 5 * time.Second  // 解析主服务器主机名的超时时间
+)
+
+// secondarySkipTypes 从区域不保存的记录类型：DNSSEC签名数据（本服务不提供签名应答）
+var secondarySkipTypes = map[uint16]bool{
+	dns.TypeRRSIG:      true,
+	dns.TypeNSEC:       true,
+	dns.TypeNSEC3:      true,
+	dns.TypeNSEC3PARAM: true,
+	dns.TypeDNSKEY:     true,
+	dns.TypeCDS:        true,
+	dns.TypeCDNSKEY:    true,
+	dns.TypeZONEMD:     true,
+}
+
+// -------------------------- 基础数据结构 --------------------------
+// SecondaryStatus 从区域的同步状态
+type SecondaryStatus struct {
+	Zone         string    `json:"zone"`                   // 域名
+	Primaries    []string  `json:"primaries"`              // 主服务器地址
+	Loaded       bool      `json:"loaded"`                 // 是否持有可用的区域数据
+	Serial       uint32    `json:"serial"`                 // 当前数据的SOA序列号
+	Records      int       `json:"records"`                // 当前数据的记录数（不含SOA）
+	Skipped      int       `json:"skipped"`                // 最近一次同步中被跳过的记录数（DNSSEC记录、区域外的名称或无法以单个记录值表示的记录）
+	LastPrimary  string    `json:"last_primary,omitempty"` // 最近一次成功检查的主服务器
+	LastTransfer time.Time `json:"last_transfer"`          // 最近一次成功传送的时间
+	LastType     string    `json:"last_type,omitempty"`    // 最近一次传送的方式：AXFR/IXFR
+	LastCheck    time.Time `json:"last_check"`             // 最近一次成功检查SOA的时间
+	NextCheck    time.Time `json:"next_check"`             // 下一次检查的时间
+	Expires      time.Time `json:"expires"`                // 数据过期时间（超过此时间仍未能成功检查时停止提供解析）
+	LastError    string    `json:"last_error,omitempty"`   // 最近一次检查失败的原因
+	Notifies     uint64    `json:"notifies"`               // 收到的NOTIFY次数
+}
+
+// secondaryState 单个从区域的同步状态与当前数据
+type secondaryState struct {
+	status SecondaryStatus
+	key    string       // 传送使用的TSIG密钥
+	addrs  []netip.Addr // 主服务器的地址（主机名在检查区域前解析，用于校验NOTIFY的来源）
+	soa    *dns.SOA     // 当前数据的SOA，尚未同步或已过期时为nil（只由刷新循环读写）
+	rrs    []dns.RR     // 当前数据中SOA以外的记录（用于应用IXFR增量，只由刷新循环读写）
+}
+
+// Secondaries 从区域同步：按SOA的refresh/retry定时检查主服务器的序列号，序列号增大时通过IXFR（本地已有数据时）或AXFR拉取区域，
+// 收到NOTIFY时立即检查；超过expire仍未能成功检查时丢弃区域数据
+type Secondaries struct {
+	manager DNSManager
+	tsig    *tsigKeyring
+	wake    chan struct{} // 域名变更或收到NOTIFY时通知刷新循环
+
+	mu    sync.Mutex                 // 保护 zones 与其中的 status
+	zones map[string]*secondaryState // 域名 -> 状态
+}
+
+// NewSecondaries 创建从区域同步，区域在 Run 启动后拉取
+func NewSecondaries(manager DNSManager, tsig *tsigKeyring) *Secondaries {
+	return &Secondaries{
+		manager: manager,
+		tsig:    tsig,
+		wake:    make(chan struct{}, 1),
+		zones:   make(map[string]*secondaryState),
+	}
+}
+
+// -------------------------- 生命周期 --------------------------
+// Run 检查到期的从区域，直到ctx结束；域名变更或收到NOTIFY时立即检查
+func (s *Secondaries) Run(ctx context.Context) {
+	runRefreshLoop(ctx, s.wake, s.untilNextCheck, s.refreshDue)
+}
+
+// Wake 通知刷新循环重新比对从区域配置并检查到期的区域
+func (s *Secondaries) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Notify 收到主服务器的NOTIFY：区域立即到期检查
+func (s *Secondaries) Notify(domainName string) {
+	s.mu.Lock()
+	if st, ok := s.zones[domainName]; ok {
+		st.status.Notifies++
+		st.status.NextCheck = time.Time{}
+	}
+	s.mu.Unlock()
+	s.Wake()
+}
+
+// Status 返回各从区域的同步状态（按域名排序）
+func (s *Secondaries) Status() []SecondaryStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := make([]SecondaryStatus, 0, len(s.zones))
+	for _, st := range s.zones {
+		item := st.status
+		item.Primaries = slices.Clone(item.Primaries)
+		status = append(status, item)
+	}
+	slices.SortFunc(status, func(a, b SecondaryStatus) int { return strings.Compare(a.Zone, b.Zone) })
+	return status
+}
+
+// untilNextCheck 返回距最近一次到期检查或数据过期的时间，没有从区域时返回0（只等待通知）
+func (s *Secondaries) untilNextCheck() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, st := range s.zones {
+		for _, t := range []time.Time{st.status.NextCheck, st.status.Expires} {
+			if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	if next.IsZero() {
+		return 0
+	}
+	return max(time.Until(next), time.Second)
+}
+
+// refreshDue 比对从区域配置，依次检查到期的区域
+func (s *Secondaries) refreshDue() {
+	for _, st := range s.reconcile() {
+		s.refreshZone(st)
+	}
+}
+
+// reconcile 按域名管理器中的从区域配置增删状态，返回到期需要检查的区域；
+// 到期区域的主服务器地址在此重新解析，主服务器的地址变化随区域的检查生效
+func (s *Secondaries) reconcile() []*secondaryState {
+	due := s.reconcileZones()
+	for _, st := range due {
+		s.mu.Lock()
+		primaries := slices.Clone(st.status.Primaries)
+		s.mu.Unlock()
+
+		addrs := resolvePrimaries(primaries)
+		s.mu.Lock()
+		st.addrs = addrs
+		s.mu.Unlock()
+	}
+	return due
+}
+
+// reconcileZones 比对从区域配置并增删状态，返回到期需要检查的区域
+func (s *Secondaries) reconcileZones() []*secondaryState {
+	zones := s.manager.SecondaryZones()
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool, len(zones))
+	var due []*secondaryState
+	for _, z := range zones {
+		seen[z.Domain] = true
+		st, ok := s.zones[z.Domain]
+		if !ok {
+			st = &secondaryState{}
+			s.zones[z.Domain] = st
+		}
+		if !slices.Equal(st.status.Primaries, z.Secondary.Primaries) || st.key != z.Secondary.Key {
+			// 主服务器或密钥变化时立即检查，检查成功前继续提供原有数据
+			st.status.Zone = z.Domain
+			st.status.Primaries = z.Secondary.Primaries
+			st.key = z.Secondary.Key
+			st.status.NextCheck = time.Time{}
+		}
+		if !z.Loaded && st.soa != nil {
+			// 域名被删除后重新添加，管理器中已没有区域数据
+			st.reset()
+		}
+		if !now.Before(st.status.NextCheck) || (st.soa != nil && !now.Before(st.status.Expires)) {
+			due = append(due, st)
+		}
+	}
+	for name := range s.zones {
+		if !seen[name] {
+			delete(s.zones, name)
+		}
+	}
+	return due
+}
+
+// reset 丢弃状态中的区域数据
+func (st *secondaryState) reset() {
+	st.soa, st.rrs = nil, nil
+	st.status.Loaded = false
+	st.status.Serial, st.status.Records = 0, 0
+	st.status.Expires = time.Time{}
+	st.status.NextCheck = time.Time{}
+}
+
+// -------------------------- 同步 --------------------------
+// refreshZone 依次向各主服务器检查区域，第一个成功的主服务器为准；数据超过expire仍未能检查成功时丢弃
+func (s *Secondaries) refreshZone(st *secondaryState) {
+	s.mu.Lock()
+	domainName, primaries, key, expires := st.status.Zone, slices.Clone(st.status.Primaries), st.key, st.status.Expires
+	s.mu.Unlock()
+	origin := canonicalName(domainName)
+
+	var errs []string
+	for _, primary := range primaries {
+		kind, skipped, err := s.pull(st, domainName, origin, primaryAddr(primary), key)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", primary, err))
+			continue
+		}
+		now := time.Now()
+		s.mu.Lock()
+		st.status.LastPrimary = primary
+		st.status.LastCheck = now
+		st.status.LastError = ""
+		if kind != "" {
+			st.status.LastTransfer = now
+			st.status.LastType = kind
+			st.status.Skipped = skipped
+		}
+		st.status.Loaded = true
+		st.status.Serial = st.soa.Serial
+		st.status.Records = len(st.rrs)
+		st.status.Expires = now.Add(time.Duration(st.soa.Expire) * time.Second)
+		st.status.NextCheck = now.Add(max(time.Duration(st.soa.Refresh)*time.Second, secondaryMinInterval))
+		s.mu.Unlock()
+		return
+	}
+
+	err := strings.Join(errs, "; ")
+	if len(primaries) == 0 {
+		err = "未配置主服务器"
+	}
+	log.Printf("Failed to refresh secondary zone %s: %s", domainName, err)
+
+	now := time.Now()
+	expired := st.soa != nil && !now.Before(expires)
+	if expired {
+		log.Printf("Secondary zone %s expired: no successful refresh from its primaries since %s", domainName, expires.Format(time.RFC3339))
+		s.manager.ExpireSecondaryZone(domainName)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expired {
+		st.reset()
+	}
+	st.status.LastError = err
+	retry := time.Duration(defaultSOARetry) * time.Second
+	if st.soa != nil {
+		retry = time.Duration(st.soa.Retry) * time.Second
+	} else {
+		retry = min(retry, secondaryInitialRetry)
+	}
+	st.status.NextCheck = now.Add(max(retry, secondaryMinInterval))
+}
+
+// pull 检查主服务器上区域的序列号，比本地新时拉取并发布到域名管理器，返回传送方式（未传送时为空）与被跳过的记录数；
+// IXFR增量无法应用到本地数据时改用AXFR
+func (s *Secondaries) pull(st *secondaryState, domainName, origin, primary, key string) (string, int, error) {
+	serial, err := querySerial(origin, primary, s.tsig, key)
+	if err != nil {
+		return "", 0, err
+	}
+	if st.soa != nil && !serialGreater(serial, st.soa.Serial) {
+		return "", 0, nil
+	}
+
+	m := new(dns.Msg)
+	if st.soa != nil {
+		m.SetIxfr(origin, st.soa.Serial, st.soa.Ns, st.soa.Mbox)
+	} else {
+		m.SetAxfr(origin)
+	}
+	rrs, err := transferZone(m, primary, s.tsig, key)
+	if err != nil {
+		return "", 0, err
+	}
+	soa, body, kind, err := applyTransfer(st.soa, st.rrs, rrs)
+	if err != nil && st.soa != nil {
+		log.Printf("Falling back to AXFR for secondary zone %s from %s: %v", domainName, primary, err)
+		m = new(dns.Msg)
+		m.SetAxfr(origin)
+		if rrs, err = transferZone(m, primary, s.tsig, key); err != nil {
+			return "", 0, err
+		}
+		soa, body, kind, err = applyTransfer(nil, nil, rrs)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if kind == "" {
+		// 主服务器的IXFR应答表示没有更新的版本
+		return "", 0, nil
+	}
+
+	records, skipped := secondaryRecords(origin, body)
+	if err := s.manager.UpdateSecondaryZone(domainName, soaSettings(soa), records); err != nil {
+		return "", 0, err
+	}
+	st.soa, st.rrs = soa, body
+	log.Printf("Transferred secondary zone %s from %s: %s, serial %d, %d records (%d skipped)", domainName, primary, kind, soa.Serial, len(records), skipped)
+	return kind, skipped, nil
+}
+
+// applyTransfer 将传送内容应用到当前数据（current为nil表示本地没有数据），返回新的SOA、SOA以外的记录与传送方式；
+// 传送内容只有一条SOA（IXFR应答本地已是最新版本）时传送方式为空
+func applyTransfer(current *dns.SOA, body, rrs []dns.RR) (*dns.SOA, []dns.RR, string, error) {
+	first, ok := rrs[0].(*dns.SOA)
+	if !ok {
+		return nil, nil, "", fmt.Errorf("传送内容的第一条记录不是SOA")
+	}
+	if len(rrs) == 1 {
+		if current == nil {
+			return nil, nil, "", fmt.Errorf("区域传送不完整")
+		}
+		return current, body, "", nil
+	}
+	if last, ok := rrs[len(rrs)-1].(*dns.SOA); !ok || last.Serial != first.Serial {
+		return nil, nil, "", fmt.Errorf("区域传送不完整")
+	}
+	rrs = rrs[1 : len(rrs)-1]
+
+	// 第二条记录为SOA时为增量格式（RFC 1995 4），否则为完整区域
+	incremental := len(rrs) > 0
+	if incremental {
+		_, incremental = rrs[0].(*dns.SOA)
+	}
+	if !incremental {
+		if current != nil {
+			// 主服务器以完整区域应答IXFR
+			return first, withoutSOA(rrs), "IXFR (full zone)", nil
+		}
+		return first, withoutSOA(rrs), "AXFR", nil
+	}
+	if current == nil {
+		return nil, nil, "", fmt.Errorf("本地没有区域数据，无法应用增量传送")
+	}
+
+	set := make(map[string]dns.RR, len(body))
+	for _, rr := range body {
+		set[rrKey(rr)] = rr
+	}
+	serial := current.Serial
+	deleting := false
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			// 每次变更依次为旧SOA、删除的记录、新SOA、新增的记录
+			deleting = !deleting
+			if deleting && soa.Serial != serial {
+				return nil, nil, "", fmt.Errorf("增量传送从序列号 %d 开始，本地为 %d", soa.Serial, serial)
+			}
+			serial = soa.Serial
+			continue
+		}
+		key := rrKey(rr)
+		if deleting {
+			if _, ok := set[key]; !ok {
+				return nil, nil, "", fmt.Errorf("增量传送删除的记录 %s 不在本地数据中", rr.String())
+			}
+			delete(set, key)
+		} else {
+			set[key] = rr
+		}
+	}
+	if deleting || serial != first.Serial {
+		return nil, nil, "", fmt.Errorf("增量传送不完整")
+	}
+
+	next := make([]dns.RR, 0, len(set))
+	for _, rr := range set {
+		next = append(next, rr)
+	}
+	sortRRs(next)
+	return first, next, "IXFR", nil
+}
+
+// withoutSOA 返回SOA以外的记录
+func withoutSOA(rrs []dns.RR) []dns.RR {
+	body := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		if rr.Header().Rrtype != dns.TypeSOA {
+			body = append(body, rr)
+		}
+	}
+	return body
+}
+
+// rrKey 比较记录时使用的键：所有者名称规范化且忽略TTL
+func rrKey(rr dns.RR) string {
+	rr = dns.Copy(rr)
+	hdr := rr.Header()
+	hdr.Name = canonicalName(hdr.Name)
+	hdr.Ttl = 0
+	return rr.String()
+}
+
+// secondaryRecords 将区域记录转换为解析记录，跳过DNSSEC记录、区域外的名称与无法转换的记录
+func secondaryRecords(origin string, rrs []dns.RR) ([]Record, int) {
+	records := make([]Record, 0, len(rrs))
+	skipped := 0
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if secondarySkipTypes[hdr.Rrtype] || hdr.Class != dns.ClassINET || !dns.IsSubDomain(origin, canonicalName(hdr.Name)) {
+			skipped++
+			continue
+		}
+		r, err := recordFromRR(rr)
+		if err != nil {
+			skipped++
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, skipped
+}
+
+// soaSettings 将主服务器的SOA记录转换为域名的SOA参数
+func soaSettings(soa *dns.SOA) SOA {
+	return SOA{
+		MName:   relativeName(soa.Ns),
+		RName:   relativeName(soa.Mbox),
+		Serial:  soa.Serial,
+		Refresh: soa.Refresh,
+		Retry:   soa.Retry,
+		Expire:  soa.Expire,
+		Minimum: soa.Minttl,
+	}
+}
+
+// -------------------------- NOTIFY --------------------------
+// handleNotify 处理主服务器发送的NOTIFY（RFC 1996），返回应答报文（用于指标与查询日志）
+func (e *DNSEngine) handleNotify(w dns.ResponseWriter, req *dns.Msg, client netip.Addr) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+	m.Rcode = e.processNotify(w, req, client)
+	e.signReply(w, req, m)
+	e.writeMsg(w, req, m)
+	return m
+}
+
+// processNotify 校验NOTIFY并通知从区域立即检查，返回应答码
+//   - 签名校验失败或区域不是本地的从区域：NOTAUTH
+//   - 既不是来自主服务器地址、也未使用区域的密钥签名：REFUSED
+func (e *DNSEngine) processNotify(w dns.ResponseWriter, req *dns.Msg, client netip.Addr) int {
+	if len(req.Question) != 1 || req.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	zoneName := canonicalName(req.Question[0].Name)
+	t := req.IsTsig()
+	if t != nil {
+		if err := w.TsigStatus(); err != nil {
+			log.Printf("Rejected NOTIFY for zone %s from %s: TSIG key %s: %v", zoneName, client, t.Hdr.Name, err)
+			return dns.RcodeNotAuth
+		}
+	}
+
+	zones := e.manager.SecondaryZones()
+	idx := slices.IndexFunc(zones, func(z SecondaryZone) bool { return canonicalName(z.Domain) == zoneName })
+	if idx < 0 {
+		log.Printf("Rejected NOTIFY from %s: zone %s is not a secondary zone", client, zoneName)
+		return dns.RcodeNotAuth
+	}
+	zone := zones[idx]
+	signed := t != nil && zone.Secondary.Key != "" && canonicalName(t.Hdr.Name) == canonicalName(zone.Secondary.Key)
+	if !signed && !e.secondary.IsPrimary(zone.Domain, client) {
+		log.Printf("Refused NOTIFY for zone %s from %s: not a primary of the zone", zoneName, client)
+		return dns.RcodeRefused
+	}
+
+	log.Printf("Received NOTIFY for secondary zone %s from %s", zoneName, client)
+	e.secondary.Notify(zone.Domain)
+	return dns.RcodeSuccess
+}
+
+// IsPrimary 判断客户端地址是否为从区域的主服务器之一（使用最近一次检查区域时解析的地址）
+func (s *Secondaries) IsPrimary(domainName string, client netip.Addr) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.zones[domainName]
+	return ok && slices.Contains(st.addrs, client.Unmap())
+}
+
+// resolvePrimaries 返回主服务器的地址，主服务器为主机名时解析其地址（解析失败的主机名被忽略）
+func resolvePrimaries(primaries []string) []netip.Addr {
+	var addrs []netip.Addr
+	for _, primary := range primaries {
+		host := primary
+		if h, _, err := net.SplitHostPort(primary); err == nil {
+			host = h
+		}
+		if addr, err := netip.ParseAddr(host); err == nil {
+			addrs = append(addrs, addr.Unmap())
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), secondaryResolveWait)
+		resolved, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to resolve primary %s: %v", primary, err)
+			continue
+		}
+		for _, addr := range resolved {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	return addrs
+}
+
+// -------------------------- 对外接口 --------------------------
+// SecondaryStatus 返回各从区域的同步状态
+func (e *DNSEngine) SecondaryStatus() []SecondaryStatus {
+	return e.secondary.Status()
+}
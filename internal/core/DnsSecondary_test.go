@@ -0,0 +1,73 @@
+package core
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestApplyTransfer(t *testing.T) {
+	www1 := "www.example.test. 300 IN A 192.0.2.1"
+	www2 := "www.example.test. 300 IN A 192.0.2.2"
+	mail := "mail.example.test. 300 IN A 192.0.2.3"
+	body := mustRRs(t, www1, mail)
+	soa := func(serial uint32) dns.RR { return transferSOA(serial) }
+	rrs := func(items ...any) []dns.RR {
+		var out []dns.RR
+		for _, item := range items {
+			switch v := item.(type) {
+			case dns.RR:
+				out = append(out, v)
+			case string:
+				out = append(out, mustRRs(t, v)...)
+			}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		current  *dns.SOA // 为nil表示本地没有数据
+		transfer []dns.RR
+		serial   uint32
+		want     []string // 传送后的记录（rrSummary格式），为nil表示应返回错误
+		kind     string
+	}{
+		{name: "axfr", transfer: rrs(soa(5), www2, soa(5)), serial: 5, want: []string{"A 192.0.2.2"}, kind: "AXFR"},
+		{name: "full zone answering ixfr", current: transferSOA(3), transfer: rrs(soa(5), www2, soa(5)), serial: 5, want: []string{"A 192.0.2.2"}, kind: "IXFR (full zone)"},
+		{name: "already up to date", current: transferSOA(3), transfer: rrs(soa(3)), serial: 3, want: []string{"A 192.0.2.1", "A 192.0.2.3"}},
+		{
+			name:     "incremental",
+			current:  transferSOA(3),
+			transfer: rrs(soa(5), soa(3), www1, soa(4), www2, soa(4), mail, soa(5), soa(5)),
+			serial:   5, want: []string{"A 192.0.2.2"}, kind: "IXFR",
+		},
+		{name: "incremental ttl change", current: transferSOA(3), transfer: rrs(soa(4), soa(3), www1, soa(4), "www.example.test. 60 IN A 192.0.2.1", soa(4)), serial: 4, want: []string{"A 192.0.2.3", "A 192.0.2.1"}, kind: "IXFR"},
+		{name: "first record not SOA", transfer: rrs(www1, soa(5))},
+		{name: "truncated transfer", transfer: rrs(soa(5), www1)},
+		{name: "mismatched closing serial", transfer: rrs(soa(5), www1, soa(4))},
+		{name: "single SOA without data", transfer: rrs(soa(5))},
+		{name: "incremental without data", transfer: rrs(soa(4), soa(3), soa(4), soa(4))},
+		{name: "incremental from other serial", current: transferSOA(2), transfer: rrs(soa(4), soa(3), soa(4), soa(4))},
+		{name: "deleting unknown record", current: transferSOA(3), transfer: rrs(soa(4), soa(3), www2, soa(4), soa(4))},
+		{name: "incomplete incremental", current: transferSOA(3), transfer: rrs(soa(4), soa(3), www1, soa(4))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, records, kind, err := applyTransfer(tt.current, slices.Clone(body), tt.transfer)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("applyTransfer() = serial %d, %v, want an error", next.Serial, rrSummary(records))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyTransfer() error = %v", err)
+			}
+			if got := rrSummary(records); next.Serial != tt.serial || kind != tt.kind || !slices.Equal(got, tt.want) {
+				t.Errorf("applyTransfer() = serial %d, %v, %q, want serial %d, %v, %q", next.Serial, got, kind, tt.serial, tt.want, tt.kind)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval 检查证书文件是否变化的最小间隔
+const certCheckInterval = 10 * time.Second
+
+// certReloader 从文件加载TLS证书，文件修改后在下一次握手时自动重新加载
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // 已加载证书对应的文件修改时间（取两个文件中较新的）
+	checked time.Time // 最近一次检查文件的时间
+}
+
+// newCertReloader 加载证书并返回加载器
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("启用DoT/DoQ/DoH需要配置 server.tls.cert_file 与 server.tls.key_file")
+	}
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := r.modTimeOf()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载证书失败: %w", err)
+	}
+	r.cert, r.modTime, r.checked = &cert, modTime, time.Now()
+	return r, nil
+}
+
+// GetCertificate 供 tls.Config 使用，证书文件变化时重新加载，加载失败时继续使用旧证书
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < certCheckInterval {
+		return r.cert, nil
+	}
+	r.checked = time.Now()
+
+	modTime, err := r.modTimeOf()
+	if err != nil || !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		// 证书与私钥可能尚未全部写完，保留旧证书，下次检查时重试
+		log.Printf("Failed to reload TLS certificate %s: %v", r.certFile, err)
+		return r.cert, nil
+	}
+	r.cert, r.modTime = &cert, modTime
+	log.Printf("Reloaded TLS certificate %s", r.certFile)
+	return r.cert, nil
+}
+
+// modTimeOf 返回证书与私钥文件中较新的修改时间
+func (r *certReloader) modTimeOf() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("读取证书文件失败: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// tlsConfig 返回使用该加载器的服务端TLS配置
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"dnsm/internal/conf"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tsigFudge 签名时间允许的误差（秒）
+const tsigFudge = 300
+
+// errTSIGUnsupported DoH/DoQ 请求无法校验TSIG（签名覆盖的原始报文不经过 dns.Server）
+var errTSIGUnsupported = errors.New("tsig is not supported on this transport")
+
+// tsigKey 解析后的TSIG密钥
+type tsigKey struct {
+	algorithm string // 规范化的算法名（如 hmac-sha256.）
+	secret    []byte
+}
+
+// tsigKeyring TSIG密钥表，实现 dns.TsigProvider，配置重载时整体替换
+type tsigKeyring struct {
+	keys atomic.Pointer[map[string]tsigKey] // 规范化的密钥名 -> 密钥
+}
+
+func newTSIGKeyring(keys []conf.TSIGKey) *tsigKeyring {
+	k := &tsigKeyring{}
+	k.configure(keys)
+	return k
+}
+
+// configure 按配置重建密钥表，无效的密钥记录日志后跳过
+func (k *tsigKeyring) configure(keys []conf.TSIGKey) {
+	table := make(map[string]tsigKey, len(keys))
+	for _, key := range keys {
+		name := canonicalName(key.Name)
+		algorithm, ok := tsigAlgorithm(key.Algorithm)
+		if !ok {
+			log.Printf("Skipping TSIG key %s: unsupported algorithm %s", key.Name, key.Algorithm)
+			continue
+		}
+		secret, err := base64.StdEncoding.DecodeString(key.Secret)
+		if name == "." || err != nil || len(secret) == 0 {
+			log.Printf("Skipping TSIG key %s: invalid name or secret", key.Name)
+			continue
+		}
+		table[name] = tsigKey{algorithm: algorithm, secret: secret}
+	}
+	k.keys.Store(&table)
+}
+
+// tsigAlgorithm 将配置中的算法名转换为规范名称，为空时使用 hmac-sha256
+func tsigAlgorithm(name string) (string, bool) {
+	switch strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".") {
+	case "", "hmac-sha256":
+		return dns.HmacSHA256, true
+	case "hmac-sha1":
+		return dns.HmacSHA1, true
+	case "hmac-sha224":
+		return dns.HmacSHA224, true
+	case "hmac-sha384":
+		return dns.HmacSHA384, true
+	case "hmac-sha512":
+		return dns.HmacSHA512, true
+	}
+	return "", false
+}
+
+// lookup 按密钥名查找密钥
+func (k *tsigKeyring) lookup(name string) (tsigKey, bool) {
+	key, ok := (*k.keys.Load())[canonicalName(name)]
+	return key, ok
+}
+
+// Generate 实现 dns.TsigProvider：计算报文的HMAC
+func (k *tsigKeyring) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	key, ok := k.lookup(t.Hdr.Name)
+	if !ok {
+		return nil, dns.ErrSecret
+	}
+	if canonicalName(t.Algorithm) != key.algorithm {
+		return nil, dns.ErrKeyAlg
+	}
+	var fn func() hash.Hash
+	switch key.algorithm {
+	case dns.HmacSHA1:
+		fn = sha1.New
+	case dns.HmacSHA224:
+		fn = sha256.New224
+	case dns.HmacSHA256:
+		fn = sha256.New
+	case dns.HmacSHA384:
+		fn = sha512.New384
+	case dns.HmacSHA512:
+		fn = sha512.New
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+	h := hmac.New(fn, key.secret)
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// Verify 实现 dns.TsigProvider：校验报文的HMAC
+func (k *tsigKeyring) Verify(msg []byte, t *dns.TSIG) error {
+	mac, err := k.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	expected, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, expected) {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+// signReply 请求的TSIG签名校验通过时，以同一密钥签名应答；先补齐EDNS0，保证TSIG为附加部分的最后一条记录
+func (e *DNSEngine) signReply(w dns.ResponseWriter, req, m *dns.Msg) {
+	t := req.IsTsig()
+	if t == nil || w.TsigStatus() != nil {
+		return
+	}
+	if opt := req.IsEdns0(); opt != nil && m.IsEdns0() == nil {
+		m.SetEdns0(maxUDPPayloadSize, opt.Do())
+	}
+	e.tsig.sign(m, t.Hdr.Name)
+}
+
+// signRequest 使用密钥签名发往其他服务器的请求，密钥未配置时返回错误
+func (k *tsigKeyring) signRequest(m *dns.Msg, keyName string) error {
+	if _, ok := k.lookup(keyName); !ok {
+		return fmt.Errorf("TSIG密钥 %s 未配置", keyName)
+	}
+	k.sign(m, keyName)
+	return nil
+}
+
+// sign 为报文附加TSIG记录，由 dns.Server 或 dns.Client 写出报文时使用该密钥计算签名
+func (k *tsigKeyring) sign(m *dns.Msg, keyName string) {
+	if key, ok := k.lookup(keyName); ok {
+		m.SetTsig(dns.Fqdn(keyName), key.algorithm, tsigFudge, time.Now().Unix())
+	}
+}
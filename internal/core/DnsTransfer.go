@@ -0,0 +1,279 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"log"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	transferChunkSize = 16 * 1024       // 区域传送每条应答报文中记录的字节数上限（大致）
+	notifyTimeout     = 3 * time.Second // 单次NOTIFY的等待时间
+	notifyAttempts    = 3               // NOTIFY未得到应答时的最多发送次数
+)
+
+// -------------------------- 请求处理 --------------------------
+// handleTransfer 处理区域传送请求（AXFR/IXFR，RFC 5936/1995），返回第一条应答报文（用于指标与查询日志）
+//   - 区域未列入 zone_transfer.zones、来源不在允许网段或未使用允许的密钥签名：REFUSED
+//   - 签名校验失败或区域不由本地负责：NOTAUTH
+//   - 从区域尚未从主服务器同步：SERVFAIL
+//   - UDP上的IXFR只应答当前SOA（提示客户端改用TCP），UDP上的AXFR被拒绝
+//   - IXFR请求的序列号在变更日志范围内时应答增量，否则应答完整区域
+func (e *DNSEngine) handleTransfer(w dns.ResponseWriter, req *dns.Msg, client netip.Addr) *dns.Msg {
+	q := req.Question[0]
+	zoneName := canonicalName(q.Name)
+	kind := dns.TypeToString[q.Qtype]
+
+	domain, rcode := e.checkTransfer(w, req, client, zoneName)
+	if rcode == dns.RcodeSuccess && isUDP(w) && q.Qtype == dns.TypeAXFR {
+		log.Printf("Refused AXFR of zone %s from %s over UDP", zoneName, client)
+		rcode = dns.RcodeRefused
+	}
+	if rcode != dns.RcodeSuccess {
+		m := new(dns.Msg)
+		m.SetRcode(req, rcode)
+		e.signReply(w, req, m)
+		e.writeMsg(w, req, m)
+		return m
+	}
+
+	soa := newZone(domain).soa
+	rrs := append([]dns.RR{soa}, zoneBody(domain)...)
+	rrs = append(rrs, soa)
+	if q.Qtype == dns.TypeIXFR {
+		clientSOA := ixfrSOA(req)
+		if clientSOA == nil {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeFormatError)
+			e.signReply(w, req, m)
+			e.writeMsg(w, req, m)
+			return m
+		}
+		switch deltas, ok := e.manager.ZoneJournal(domain.Name, clientSOA.Serial); {
+		case !serialGreater(soa.Serial, clientSOA.Serial) || isUDP(w):
+			// 客户端已是最新版本，或需要改用TCP
+			rrs = []dns.RR{soa}
+			kind = "IXFR (up to date)"
+		case ok && len(deltas) > 0:
+			rrs = ixfrRRs(deltas)
+			soa = deltas[len(deltas)-1].To
+			kind = "IXFR (incremental)"
+		default:
+			kind = "IXFR (full zone)"
+		}
+	}
+
+	m, err := e.writeTransfer(w, req, rrs)
+	if err != nil {
+		log.Printf("Failed to transfer zone %s to %s: %v", zoneName, client, err)
+		return m
+	}
+	log.Printf("Transferred zone %s to %s: %s, serial %d, %d records", zoneName, client, kind, soa.Serial, len(rrs))
+	return m
+}
+
+// checkTransfer 校验区域与访问控制（来源网段与TSIG密钥），通过时返回区域的当前数据
+func (e *DNSEngine) checkTransfer(w dns.ResponseWriter, req *dns.Msg, client netip.Addr, zoneName string) (Domain, int) {
+	cfg := e.conf.GetTransfer()
+	if !cfg.Enabled {
+		log.Printf("Refused zone transfer of %s from %s: zone transfers are disabled", zoneName, client)
+		return Domain{}, dns.RcodeRefused
+	}
+	if t := req.IsTsig(); t != nil {
+		if err := w.TsigStatus(); err != nil {
+			log.Printf("Rejected zone transfer of %s from %s: TSIG key %s: %v", zoneName, client, t.Hdr.Name, err)
+			return Domain{}, dns.RcodeNotAuth
+		}
+	}
+	domainName, ok := e.managedDomain(zoneName)
+	if !ok {
+		log.Printf("Rejected zone transfer from %s: zone %s is not configured", client, zoneName)
+		return Domain{}, dns.RcodeNotAuth
+	}
+	zc, ok := transferACL(cfg.Zones, zoneName)
+	if !ok {
+		log.Printf("Refused zone transfer of %s from %s: zone is not listed in zone_transfer", zoneName, client)
+		return Domain{}, dns.RcodeRefused
+	}
+	if reason, ok := transferAllowed(zc, client, req.IsTsig()); !ok {
+		log.Printf("Refused zone transfer of %s from %s: %s", zoneName, client, reason)
+		return Domain{}, dns.RcodeRefused
+	}
+
+	domain, err := e.manager.GetDomain(domainName)
+	if err != nil {
+		log.Printf("Rejected zone transfer from %s: %v", client, err)
+		return Domain{}, dns.RcodeNotAuth
+	}
+	if domain.Secondary != nil && !slices.ContainsFunc(e.manager.SecondaryZones(), func(z SecondaryZone) bool { return z.Domain == domain.Name && z.Loaded }) {
+		log.Printf("Failed zone transfer of %s to %s: secondary zone has not been loaded from its primaries", zoneName, client)
+		return Domain{}, dns.RcodeServerFailure
+	}
+	return domain, dns.RcodeSuccess
+}
+
+// transferACL 查找区域的传送配置
+func transferACL(zones []conf.TransferZone, zoneName string) (conf.TransferZone, bool) {
+	for _, z := range zones {
+		if canonicalName(z.Name) == zoneName {
+			return z, true
+		}
+	}
+	return conf.TransferZone{}, false
+}
+
+// transferAllowed 判断客户端与请求签名（已校验，未签名时为nil）是否满足区域的传送限制，不满足时返回原因
+func transferAllowed(zc conf.TransferZone, client netip.Addr, t *dns.TSIG) (string, bool) {
+	if len(zc.Allow) == 0 && len(zc.Keys) == 0 {
+		return "neither allow nor keys is configured for the zone", false
+	}
+	if len(zc.Allow) > 0 {
+		allowed := false
+		for _, network := range zc.Allow {
+			prefix, err := parseClientPrefix(network)
+			if err != nil {
+				log.Printf("Skipping invalid client network %s in zone_transfer of %s: %v", network, zc.Name, err)
+				continue
+			}
+			if prefix.Contains(client) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "client is not in the allowed networks", false
+		}
+	}
+	if len(zc.Keys) > 0 {
+		if t == nil {
+			return "request is not signed", false
+		}
+		keyName := canonicalName(t.Hdr.Name)
+		if !slices.ContainsFunc(zc.Keys, func(key string) bool { return canonicalName(key) == keyName }) {
+			return "key " + keyName + " is not allowed", false
+		}
+	}
+	return "", true
+}
+
+// ixfrSOA 返回IXFR请求权威部分中客户端当前版本的SOA
+func ixfrSOA(req *dns.Msg) *dns.SOA {
+	for _, rr := range req.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa
+		}
+	}
+	return nil
+}
+
+// -------------------------- 传送内容 --------------------------
+// zoneBody 返回区域中SOA以外的全部记录（默认视图，按文本排序）
+func zoneBody(domain Domain) []dns.RR {
+	var rrs []dns.RR
+	for _, rr := range zoneRRs(domain) {
+		if rr.Header().Rrtype != dns.TypeSOA {
+			rrs = append(rrs, rr)
+		}
+	}
+	sortRRs(rrs)
+	return rrs
+}
+
+// ixfrRRs 按RFC 1995格式组织增量传送的记录：当前SOA，每次变更的旧SOA、删除的记录、新SOA、新增的记录，最后为当前SOA
+func ixfrRRs(deltas []ZoneDelta) []dns.RR {
+	current := deltas[len(deltas)-1].To
+	rrs := []dns.RR{current}
+	for _, d := range deltas {
+		rrs = append(rrs, d.From)
+		rrs = append(rrs, d.Deleted...)
+		rrs = append(rrs, d.To)
+		rrs = append(rrs, d.Added...)
+	}
+	return append(rrs, current)
+}
+
+// writeTransfer 将记录分为多条应答报文写回，请求经过TSIG校验时逐条签名（后续报文只覆盖时间字段，RFC 8945 5.3.1）
+func (e *DNSEngine) writeTransfer(w dns.ResponseWriter, req *dns.Msg, rrs []dns.RR) (*dns.Msg, error) {
+	var first *dns.Msg
+	for len(rrs) > 0 {
+		n, size := 0, 0
+		for n < len(rrs) && (n == 0 || size+dns.Len(rrs[n]) <= transferChunkSize) {
+			size += dns.Len(rrs[n])
+			n++
+		}
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Authoritative = true
+		m.Answer = rrs[:n]
+		rrs = rrs[n:]
+		if first == nil {
+			first = m
+		}
+
+		e.signReply(w, req, m)
+		if err := w.WriteMsg(m); err != nil {
+			return first, err
+		}
+		w.TsigTimersOnly(true)
+		e.dnstap.clientResponse(w, m)
+	}
+	return first, nil
+}
+
+// -------------------------- NOTIFY --------------------------
+// notifySecondaries 记录各区域的序列号，向序列号发生变化的区域配置的从服务器发送NOTIFY（RFC 1996）；
+// 首次加载时只记录序列号
+func (e *DNSEngine) notifySecondaries(domains []Domain) {
+	serials := make(map[string]uint32, len(domains))
+	for _, domain := range domains {
+		serials[canonicalName(domain.Name)] = domain.SOA.Serial
+	}
+	e.notifyMu.Lock()
+	previous := e.serials
+	e.serials = serials
+	e.notifyMu.Unlock()
+	if previous == nil {
+		return
+	}
+
+	cfg := e.conf.GetTransfer()
+	if !cfg.Enabled {
+		return
+	}
+	for _, zc := range cfg.Zones {
+		zoneName := canonicalName(zc.Name)
+		serial, ok := serials[zoneName]
+		if old, seen := previous[zoneName]; !ok || !seen || old == serial {
+			continue
+		}
+		for _, addr := range zc.Notify {
+			go e.sendNotify(zoneName, serial, primaryAddr(addr), zc.Keys)
+		}
+	}
+}
+
+// sendNotify 向从服务器发送NOTIFY，区域配置了密钥时使用第一个密钥签名，未得到应答时重试
+func (e *DNSEngine) sendNotify(zoneName string, serial uint32, addr string, keys []string) {
+	c := &dns.Client{Net: "udp", Timeout: notifyTimeout, TsigProvider: e.tsig}
+	var err error
+	for attempt := 1; attempt <= notifyAttempts; attempt++ {
+		m := new(dns.Msg)
+		m.SetNotify(zoneName)
+		if len(keys) > 0 {
+			e.tsig.sign(m, keys[0])
+		}
+		var resp *dns.Msg
+		resp, _, err = c.Exchange(m, addr)
+		if err == nil {
+			if resp.Rcode != dns.RcodeSuccess {
+				log.Printf("Secondary %s answered NOTIFY for zone %s (serial %d) with %s", addr, zoneName, serial, dns.RcodeToString[resp.Rcode])
+			}
+			return
+		}
+	}
+	log.Printf("Failed to send NOTIFY for zone %s (serial %d) to %s: %v", zoneName, serial, addr, err)
+}
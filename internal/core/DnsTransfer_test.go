@@ -0,0 +1,130 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// transferSOA 构造序列号为 serial 的 example.test. SOA记录
+func transferSOA(serial uint32) *dns.SOA {
+	return &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.test.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+		Ns:     "ns1.example.test.",
+		Mbox:   "hostmaster.example.test.",
+		Serial: serial,
+		Minttl: 60,
+	}
+}
+
+// transferDelta 构造从序列号 from 到 to 的变更
+func transferDelta(t *testing.T, from, to uint32, deleted, added []string) ZoneDelta {
+	return ZoneDelta{From: transferSOA(from), To: transferSOA(to), Deleted: mustRRs(t, deleted...), Added: mustRRs(t, added...)}
+}
+
+// rrSummary 将记录格式化为“类型 值”（SOA为序列号）的简短形式
+func rrSummary(rrs []dns.RR) []string {
+	out := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		switch v := rr.(type) {
+		case *dns.SOA:
+			out = append(out, fmt.Sprintf("SOA %d", v.Serial))
+		default:
+			out = append(out, dns.TypeToString[rr.Header().Rrtype]+" "+strings.TrimPrefix(rr.String(), rr.Header().String()))
+		}
+	}
+	return out
+}
+
+// TestIXFRRRs 增量传送内容依次为当前SOA、每次变更的旧SOA/删除的记录/新SOA/新增的记录，最后为当前SOA（RFC 1995 4）
+func TestIXFRRRs(t *testing.T) {
+	deltas := []ZoneDelta{
+		transferDelta(t, 1, 2, []string{"www.example.test. 300 IN A 192.0.2.1"}, []string{"www.example.test. 300 IN A 192.0.2.2"}),
+		transferDelta(t, 2, 3, nil, []string{"mail.example.test. 300 IN A 192.0.2.3"}),
+	}
+	want := []string{
+		"SOA 3",
+		"SOA 1", "A 192.0.2.1", "SOA 2", "A 192.0.2.2",
+		"SOA 2", "SOA 3", "A 192.0.2.3",
+		"SOA 3",
+	}
+	if got := rrSummary(ixfrRRs(deltas)); !slices.Equal(got, want) {
+		t.Errorf("ixfrRRs() = %v, want %v", got, want)
+	}
+}
+
+func TestJournalSince(t *testing.T) {
+	j := &zoneJournal{serial: 4}
+	j.append(transferDelta(t, 1, 2, nil, nil))
+	j.append(transferDelta(t, 2, 3, nil, nil))
+	j.append(transferDelta(t, 3, 4, nil, nil))
+
+	tests := []struct {
+		name    string
+		serial  uint32
+		current uint32
+		want    []uint32 // 各变更的起始序列号，ok为false时忽略
+		ok      bool
+	}{
+		{name: "up to date", serial: 4, current: 4, ok: true},
+		{name: "from the oldest", serial: 1, current: 4, want: []uint32{1, 2, 3}, ok: true},
+		{name: "from the middle", serial: 3, current: 4, want: []uint32{3}, ok: true},
+		{name: "unknown serial", serial: 7, current: 4},
+		{name: "journal behind the zone", serial: 2, current: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deltas, ok := j.since(tt.serial, tt.current)
+			var got []uint32
+			for _, d := range deltas {
+				got = append(got, d.From.Serial)
+			}
+			if ok != tt.ok || (ok && !slices.Equal(got, tt.want)) {
+				t.Errorf("since(%d, %d) = %v, %v, want %v, %v", tt.serial, tt.current, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	// 变更不连续时（中间的变更被丢弃）需要完整传送
+	gap := &zoneJournal{}
+	gap.append(transferDelta(t, 1, 2, nil, nil))
+	gap.append(transferDelta(t, 3, 4, nil, nil))
+	if _, ok := gap.since(1, 4); ok {
+		t.Error("since() over a gap in the journal succeeded")
+	}
+}
+
+func TestTransferAllowed(t *testing.T) {
+	key := &dns.TSIG{Hdr: dns.RR_Header{Name: "xfr-key."}}
+	other := &dns.TSIG{Hdr: dns.RR_Header{Name: "other-key."}}
+	tests := []struct {
+		name   string
+		zone   conf.TransferZone
+		client string
+		tsig   *dns.TSIG
+		want   bool
+	}{
+		{name: "no restriction configured", zone: conf.TransferZone{}, client: "192.0.2.1"},
+		{name: "allowed network", zone: conf.TransferZone{Allow: []string{"192.0.2.0/24"}}, client: "192.0.2.1", want: true},
+		{name: "single address", zone: conf.TransferZone{Allow: []string{"2001:db8::53"}}, client: "2001:db8::53", want: true},
+		{name: "other network", zone: conf.TransferZone{Allow: []string{"192.0.2.0/24"}}, client: "198.51.100.1"},
+		{name: "invalid network skipped", zone: conf.TransferZone{Allow: []string{"bogus", "192.0.2.0/24"}}, client: "192.0.2.1", want: true},
+		{name: "signed with allowed key", zone: conf.TransferZone{Keys: []string{"XFR-key"}}, client: "198.51.100.1", tsig: key, want: true},
+		{name: "unsigned", zone: conf.TransferZone{Keys: []string{"xfr-key"}}, client: "198.51.100.1"},
+		{name: "signed with other key", zone: conf.TransferZone{Keys: []string{"xfr-key"}}, client: "198.51.100.1", tsig: other},
+		{name: "key and network both required", zone: conf.TransferZone{Allow: []string{"192.0.2.0/24"}, Keys: []string{"xfr-key"}}, client: "198.51.100.1", tsig: key},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, ok := transferAllowed(tt.zone, netip.MustParseAddr(tt.client), tt.tsig)
+			if ok != tt.want {
+				t.Errorf("transferAllowed() = %v (%s), want %v", ok, reason, tt.want)
+			}
+		})
+	}
+}
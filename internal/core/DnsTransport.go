@@ -0,0 +1,511 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// 上游地址协议
+const (
+	schemeUDP   = "udp"   // 普通DNS（UDP，应答截断时改用TCP），无协议前缀的地址默认使用
+	schemeTCP   = "tcp"   // 普通DNS（TCP）
+	schemeTLS   = "tls"   // DNS-over-TLS（RFC 7858）
+	schemeHTTPS = "https" // DNS-over-HTTPS（RFC 8484）
+)
+
+const (
+	dotIdleTimeout       = 30 * time.Second // DoT连接空闲多久后关闭
+	dohIdleTimeout       = 90 * time.Second // DoH连接空闲多久后关闭
+	bootstrapMinTTL      = 60 * time.Second // 引导解析结果的最短缓存时间
+	dohContentType       = "application/dns-message"
+	maxDoHResponseLength = dns.MaxMsgSize
+)
+
+// -------------------------- 上游地址解析 --------------------------
+// upstreamAddr 解析后的上游地址
+type upstreamAddr struct {
+	scheme     string // udp/tcp/tls/https
+	host       string // 主机名或IP
+	port       string // 端口
+	serverName string // TLS证书校验使用的名称（tls://地址的 #片段，默认为host）
+	url        string // DoH请求地址
+}
+
+// parseUpstreamAddr 解析上游地址，支持 host:port、udp://、tcp://、tls://host:port#servername、https://host/path
+func parseUpstreamAddr(addr string) (upstreamAddr, error) {
+	addr = strings.TrimSpace(addr)
+	if !strings.Contains(addr, "://") {
+		addr = schemeUDP + "://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return upstreamAddr{}, fmt.Errorf("上游地址 %s 不合法: %w", addr, err)
+	}
+
+	a := upstreamAddr{scheme: strings.ToLower(u.Scheme), host: u.Hostname(), port: u.Port()}
+	if a.host == "" {
+		return upstreamAddr{}, fmt.Errorf("上游地址 %s 缺少主机", addr)
+	}
+	defaultPort := "53"
+	switch a.scheme {
+	case schemeUDP, schemeTCP:
+	case schemeTLS:
+		defaultPort = "853"
+		a.serverName = u.Fragment
+	case schemeHTTPS:
+		defaultPort = "443"
+		a.serverName = a.host
+		u.Fragment = ""
+		if u.Path == "" {
+			u.Path = "/dns-query"
+		}
+		a.url = u.String()
+	default:
+		return upstreamAddr{}, fmt.Errorf("上游地址 %s 使用了不支持的协议 %s", addr, u.Scheme)
+	}
+	if a.port == "" {
+		a.port = defaultPort
+	}
+	if _, err := strconv.ParseUint(a.port, 10, 16); err != nil {
+		return upstreamAddr{}, fmt.Errorf("上游地址 %s 端口不合法", addr)
+	}
+	if a.serverName == "" {
+		a.serverName = a.host
+	}
+	return a, nil
+}
+
+// hostPort 返回 host:port 形式的地址
+func (a upstreamAddr) hostPort() string {
+	return net.JoinHostPort(a.host, a.port)
+}
+
+// -------------------------- 传输层 --------------------------
+// transport 向单个上游发送查询的传输方式
+type transport interface {
+	exchange(req *dns.Msg, timeout time.Duration) (*dns.Msg, error)
+}
+
+// newTransport 根据上游地址创建对应的传输方式
+func newTransport(a upstreamAddr, tlsConfig *tls.Config, bootstrap *bootstrapResolver) transport {
+	switch a.scheme {
+	case schemeTCP:
+		return &plainTransport{addr: a, net: "tcp", bootstrap: bootstrap}
+	case schemeTLS:
+		cfg := tlsConfig.Clone()
+		cfg.ServerName = a.serverName
+		return &dotTransport{addr: a, tlsConfig: cfg, bootstrap: bootstrap}
+	case schemeHTTPS:
+		return newDoHTransport(a, tlsConfig, bootstrap)
+	default:
+		return &plainTransport{addr: a, net: "udp", bootstrap: bootstrap}
+	}
+}
+
+// plainTransport 普通DNS（UDP/TCP），UDP应答被截断时改用TCP重试
+type plainTransport struct {
+	addr      upstreamAddr
+	net       string
+	bootstrap *bootstrapResolver
+}
+
+func (t *plainTransport) exchange(req *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+	target, err := t.bootstrap.dialAddr(t.addr)
+	if err != nil {
+		return nil, err
+	}
+	client := &dns.Client{Net: t.net, Timeout: timeout}
+	resp, _, err := client.Exchange(req.Copy(), target)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Truncated && t.net == "udp" {
+		// 上游UDP响应被截断时改用TCP重新查询，拿到完整应答
+		client.Net = "tcp"
+		if tcpResp, _, tcpErr := client.Exchange(req.Copy(), target); tcpErr != nil {
+			log.Printf("Failed to retry truncated response over TCP with upstream %s: %v", target, tcpErr)
+		} else if tcpResp != nil {
+			resp = tcpResp
+		}
+	}
+	return resp, nil
+}
+
+// dotTransport DNS-over-TLS：复用同一条TLS连接，多个查询以不同ID流水线并发发送
+type dotTransport struct {
+	addr      upstreamAddr
+	tlsConfig *tls.Config
+	bootstrap *bootstrapResolver
+
+	mu   sync.Mutex
+	conn *dotConn
+}
+
+func (t *dotTransport) exchange(req *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+	// 复用的连接可能已被服务端关闭，此时换新连接重试一次
+	for attempt := 0; ; attempt++ {
+		c, reused, err := t.getConn(timeout)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.exchange(req, timeout)
+		if err != nil && reused && attempt == 0 && errors.Is(err, errDoTConnClosed) {
+			continue
+		}
+		return resp, err
+	}
+}
+
+// getConn 返回可用的连接，没有时新建
+func (t *dotTransport) getConn(timeout time.Duration) (*dotConn, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn != nil && !t.conn.isClosed() {
+		return t.conn, true, nil
+	}
+	target, err := t.bootstrap.dialAddr(t.addr)
+	if err != nil {
+		return nil, false, err
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", target, t.tlsConfig)
+	if err != nil {
+		return nil, false, err
+	}
+	t.conn = newDoTConn(conn)
+	return t.conn, false, nil
+}
+
+// errDoTConnClosed DoT连接已关闭
+var errDoTConnClosed = errors.New("dns-over-tls connection closed")
+
+// errDoTConnBusy DoT连接上的查询ID已全部被等待中的查询占用
+var errDoTConnBusy = errors.New("dns-over-tls connection has no free query id")
+
+// dotConn 一条DoT连接：写入串行化，独立goroutine读取应答并按ID分发给等待中的查询
+type dotConn struct {
+	conn *dns.Conn
+	wmu  sync.Mutex // 串行化写入
+
+	mu      sync.Mutex
+	pending map[uint16]chan *dns.Msg
+	nextID  uint16
+	done    chan struct{}
+	err     error
+}
+
+func newDoTConn(conn net.Conn) *dotConn {
+	c := &dotConn{
+		conn:    &dns.Conn{Conn: conn},
+		pending: make(map[uint16]chan *dns.Msg),
+		nextID:  dns.Id(),
+		done:    make(chan struct{}),
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(dotIdleTimeout))
+	go c.readLoop()
+	return c
+}
+
+// exchange 在连接上发送查询并等待对应ID的应答
+func (c *dotConn) exchange(req *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+	msg := req.Copy()
+	ch := make(chan *dns.Msg, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, errDoTConnClosed
+	}
+	// 连接上的查询ID必须唯一，发送前重新分配，收到应答后恢复；ID全部被占用时不再发送
+	if len(c.pending) > math.MaxUint16 {
+		c.mu.Unlock()
+		return nil, errDoTConnBusy
+	}
+	for {
+		c.nextID++
+		if _, used := c.pending[c.nextID]; !used {
+			break
+		}
+	}
+	msg.Id = c.nextID
+	c.pending[msg.Id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, msg.Id)
+		c.mu.Unlock()
+	}()
+
+	deadline := time.Now().Add(timeout)
+	c.wmu.Lock()
+	_ = c.conn.SetWriteDeadline(deadline)
+	err := c.conn.WriteMsg(msg)
+	// 每次发送都延长读取期限，连接空闲超过 dotIdleTimeout 后由读取goroutine关闭
+	_ = c.conn.SetReadDeadline(time.Now().Add(max(dotIdleTimeout, timeout)))
+	c.wmu.Unlock()
+	if err != nil {
+		c.close(err)
+		return nil, errDoTConnClosed
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		resp.Id = req.Id
+		return resp, nil
+	case <-c.done:
+		return nil, fmt.Errorf("%w: %v", errDoTConnClosed, c.err)
+	case <-timer.C:
+		return nil, fmt.Errorf("dns-over-tls query timed out after %s", timeout)
+	}
+}
+
+// readLoop 读取应答并分发，读取出错（含空闲超时）时关闭连接
+func (c *dotConn) readLoop() {
+	for {
+		resp, err := c.conn.ReadMsg()
+		if err != nil {
+			c.close(err)
+			return
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[resp.Id]
+		c.mu.Unlock()
+		if ok {
+			select {
+			case ch <- resp:
+			default: // 重复的应答直接丢弃
+			}
+		}
+	}
+}
+
+// close 关闭连接并唤醒所有等待中的查询
+func (c *dotConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	_ = c.conn.Close()
+}
+
+// isClosed 判断连接是否已关闭
+func (c *dotConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+// dohTransport DNS-over-HTTPS：以 POST application/dns-message 发送查询，优先使用HTTP/2
+type dohTransport struct {
+	addr   upstreamAddr
+	client *http.Client
+}
+
+func newDoHTransport(a upstreamAddr, tlsConfig *tls.Config, bootstrap *bootstrapResolver) *dohTransport {
+	dialer := &net.Dialer{}
+	return &dohTransport{
+		addr: a,
+		client: &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   tlsConfig.Clone(),
+			ForceAttemptHTTP2: true, // 自定义TLS配置时需显式启用HTTP/2
+			IdleConnTimeout:   dohIdleTimeout,
+			// URL中的主机名通过引导解析器解析，TLS仍以URL中的主机名校验证书
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				target, err := bootstrap.dialAddr(a)
+				if err != nil {
+					return nil, err
+				}
+				return dialer.DialContext(ctx, network, target)
+			},
+		}},
+	}
+}
+
+func (t *dohTransport) exchange(req *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+	// RFC 8484 建议查询ID置0，以便HTTP缓存
+	msg := req.Copy()
+	msg.Id = 0
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.addr.url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", dohContentType)
+	httpReq.Header.Set("Accept", dohContentType)
+
+	httpResp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dns-over-https upstream returned HTTP %d", httpResp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxDoHResponseLength+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxDoHResponseLength {
+		return nil, fmt.Errorf("dns-over-https response exceeds %d bytes", maxDoHResponseLength)
+	}
+
+	resp := new(dns.Msg)
+	if err := resp.Unpack(body); err != nil {
+		return nil, fmt.Errorf("failed to unpack dns-over-https response: %w", err)
+	}
+	resp.Id = req.Id
+	return resp, nil
+}
+
+// -------------------------- TLS与引导解析 --------------------------
+// newTLSConfig 创建校验上游证书的TLS配置，caFile 为空时使用系统根证书
+// CA文件无法加载时使用空证书池（所有加密上游校验失败），避免静默降级为系统根证书
+func newTLSConfig(caFile string) *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return cfg
+	}
+	cfg.RootCAs = x509.NewCertPool()
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		log.Printf("Failed to read upstream CA bundle %s: %v", caFile, err)
+		return cfg
+	}
+	if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+		log.Printf("No certificates found in upstream CA bundle %s", caFile)
+	}
+	return cfg
+}
+
+// bootstrapResolver 解析上游地址中的主机名（使用配置的引导DNS，未配置时使用系统解析器）
+type bootstrapResolver struct {
+	servers []string
+
+	mu    sync.Mutex
+	cache map[string]bootstrapEntry
+}
+
+// bootstrapEntry 引导解析缓存项
+type bootstrapEntry struct {
+	ips     []string
+	expires time.Time
+}
+
+func newBootstrapResolver(servers []string) *bootstrapResolver {
+	return &bootstrapResolver{servers: servers, cache: make(map[string]bootstrapEntry)}
+}
+
+// dialAddr 返回上游实际连接的 ip:port
+func (r *bootstrapResolver) dialAddr(a upstreamAddr) (string, error) {
+	if net.ParseIP(a.host) != nil {
+		return a.hostPort(), nil
+	}
+	ips, err := r.resolve(a.host)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0], a.port), nil
+}
+
+// resolve 解析主机名，结果按TTL缓存
+func (r *bootstrapResolver) resolve(host string) ([]string, error) {
+	r.mu.Lock()
+	entry, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.ips, nil
+	}
+
+	ips, ttl, err := r.lookup(host)
+	if err != nil {
+		if ok {
+			// 解析失败时继续使用过期的结果
+			log.Printf("Failed to refresh bootstrap address of %s, using stale result: %v", host, err)
+			return entry.ips, nil
+		}
+		return nil, fmt.Errorf("failed to resolve upstream host %s: %w", host, err)
+	}
+	r.mu.Lock()
+	r.cache[host] = bootstrapEntry{ips: ips, expires: time.Now().Add(max(ttl, bootstrapMinTTL))}
+	r.mu.Unlock()
+	return ips, nil
+}
+
+// lookup 向引导DNS查询A/AAAA记录（优先IPv4）
+func (r *bootstrapResolver) lookup(host string) ([]string, time.Duration, error) {
+	if len(r.servers) == 0 {
+		ips, err := net.DefaultResolver.LookupHost(context.Background(), host)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(ips) == 0 {
+			return nil, 0, fmt.Errorf("no addresses found")
+		}
+		return ips, bootstrapMinTTL, nil
+	}
+
+	client := &dns.Client{Timeout: defaultUpstreamTimeout}
+	var lastErr error
+	for _, server := range r.servers {
+		var ips []string
+		var ttl uint32
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			req := new(dns.Msg)
+			req.SetQuestion(dns.Fqdn(host), qtype)
+			resp, _, err := client.Exchange(req, server)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			for _, rr := range resp.Answer {
+				switch v := rr.(type) {
+				case *dns.A:
+					ips = append(ips, v.A.String())
+				case *dns.AAAA:
+					ips = append(ips, v.AAAA.String())
+				default:
+					continue
+				}
+				if ttl == 0 || rr.Header().Ttl < ttl {
+					ttl = rr.Header().Ttl
+				}
+			}
+		}
+		if len(ips) > 0 {
+			return ips, time.Duration(ttl) * time.Second, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no addresses found")
+	}
+	return nil, 0, lastErr
+}
@@ -0,0 +1,352 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const testTimeout = 2 * time.Second
+
+// answerA 构造对查询的A记录应答
+func answerA(req *dns.Msg, ip string) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Answer = append(resp.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP(ip),
+	})
+	return resp
+}
+
+// selfSignedCert 生成 dnsName 的自签名证书，返回服务端证书与信任它的客户端TLS配置
+func selfSignedCert(t *testing.T, dnsName string) (tls.Certificate, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	return cert, &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}
+}
+
+// -------------------------- DNS-over-TLS --------------------------
+// TestDoTPipelining 多个并发查询复用同一条TLS连接：服务端收齐全部查询后才按相反顺序应答，
+// 只有查询以不同ID同时在途时才能全部得到各自的应答
+func TestDoTPipelining(t *testing.T) {
+	const queries = 8
+	cert, clientTLS := selfSignedCert(t, "dot.test")
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				c := &dns.Conn{Conn: conn}
+				var reqs []*dns.Msg
+				ids := make(map[uint16]bool)
+				for len(reqs) < queries {
+					req, err := c.ReadMsg()
+					if err != nil {
+						return
+					}
+					if ids[req.Id] {
+						t.Errorf("query id %d reused while in flight", req.Id)
+					}
+					ids[req.Id] = true
+					reqs = append(reqs, req)
+				}
+				for i := len(reqs) - 1; i >= 0; i-- {
+					if err := c.WriteMsg(answerA(reqs[i], "192.0.2.1")); err != nil {
+						return
+					}
+				}
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	a, err := parseUpstreamAddr("tls://" + ln.Addr().String() + "#dot.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := newTransport(a, clientTLS, newBootstrapResolver(nil))
+
+	var wg sync.WaitGroup
+	for i := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := new(dns.Msg)
+			req.SetQuestion(fmt.Sprintf("q%d.test.", i), dns.TypeA)
+			req.Id = 7 // 相同的原始ID由连接重新分配
+			resp, err := tr.exchange(req, testTimeout)
+			if err != nil {
+				t.Errorf("query %d: %v", i, err)
+				return
+			}
+			if resp.Id != req.Id {
+				t.Errorf("query %d: response id = %d, want %d", i, resp.Id, req.Id)
+			}
+			if resp.Question[0].Name != req.Question[0].Name {
+				t.Errorf("query %d: got answer for %s", i, resp.Question[0].Name)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("accepted %d connections, want 1", n)
+	}
+}
+
+// TestDoTConnExhaustedIDs 连接上的查询ID全部被占用时返回错误而不是一直等待空闲ID
+func TestDoTConnExhaustedIDs(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	c := newDoTConn(client)
+	defer c.close(errors.New("test finished"))
+
+	c.mu.Lock()
+	for id := range 1 << 16 {
+		c.pending[uint16(id)] = make(chan *dns.Msg, 1)
+	}
+	c.mu.Unlock()
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.test.", dns.TypeA)
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.exchange(req, testTimeout)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errDoTConnBusy) {
+			t.Fatalf("exchange error = %v, want %v", err, errDoTConnBusy)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("exchange did not return with all query ids in flight")
+	}
+}
+
+// -------------------------- DNS-over-HTTPS --------------------------
+// dohHandler 按RFC 8484校验POST请求并以A记录应答
+func dohHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/dns-query" || r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Id != 0 {
+			t.Errorf("DoH query id = %d, want 0", req.Id)
+		}
+		packed, err := answerA(req, "192.0.2.2").Pack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", dohContentType)
+		_, _ = w.Write(packed)
+	})
+}
+
+func TestDoHExchange(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/dns-query", dohHandler(t))
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	srv := httptest.NewUnstartedServer(mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	clientTLS := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: x509.NewCertPool()}
+	clientTLS.RootCAs.AddCert(srv.Certificate())
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "default path", url: srv.URL},
+		{name: "explicit path", url: srv.URL + "/dns-query"},
+		{name: "http error", url: srv.URL + "/broken", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := parseUpstreamAddr(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := newTransport(a, clientTLS, newBootstrapResolver(nil))
+			req := new(dns.Msg)
+			req.SetQuestion("doh.test.", dns.TypeA)
+			resp, err := tr.exchange(req, testTimeout)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Id != req.Id {
+				t.Errorf("response id = %d, want %d", resp.Id, req.Id)
+			}
+			if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "192.0.2.2" {
+				t.Errorf("unexpected answer %v", resp.Answer)
+			}
+		})
+	}
+}
+
+// -------------------------- 引导解析 --------------------------
+// startBootstrapServer 启动只应答 names 中A记录的UDP DNS服务，返回地址与收到的查询数
+func startBootstrapServer(t *testing.T, names map[string]string) (string, *atomic.Int32) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries atomic.Int32
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		queries.Add(1)
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		if ip, ok := names[req.Question[0].Name]; ok && req.Question[0].Qtype == dns.TypeA {
+			resp = answerA(req, ip)
+		}
+		_ = w.WriteMsg(resp)
+	})}
+	started := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(started) }
+	go func() { _ = srv.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return pc.LocalAddr().String(), &queries
+}
+
+func TestBootstrapResolver(t *testing.T) {
+	server, queries := startBootstrapServer(t, map[string]string{"upstream.test.": "192.0.2.53"})
+	r := newBootstrapResolver([]string{server})
+
+	tests := []struct {
+		name    string
+		addr    upstreamAddr
+		want    string
+		wantErr bool
+	}{
+		{name: "ip address", addr: upstreamAddr{host: "198.51.100.1", port: "853"}, want: "198.51.100.1:853"},
+		{name: "hostname", addr: upstreamAddr{host: "upstream.test", port: "853"}, want: "192.0.2.53:853"},
+		{name: "cached hostname", addr: upstreamAddr{host: "upstream.test", port: "443"}, want: "192.0.2.53:443"},
+		{name: "unknown hostname", addr: upstreamAddr{host: "missing.test", port: "53"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.dialAddr(tt.addr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("dialAddr() = %s, expected an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("dialAddr() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	// upstream.test 只解析一次（A与AAAA），缓存命中不再查询；missing.test 同样查询A与AAAA
+	if n := queries.Load(); n != 4 {
+		t.Errorf("bootstrap server received %d queries, want 4", n)
+	}
+}
+
+// TestDoHBootstrap DoH上游的主机名经引导DNS解析，TLS仍以URL中的主机名校验证书
+func TestDoHBootstrap(t *testing.T) {
+	cert, clientTLS := selfSignedCert(t, "doh.test")
+	srv := httptest.NewUnstartedServer(dohHandler(t))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := startBootstrapServer(t, map[string]string{"doh.test.": "127.0.0.1"})
+	a, err := parseUpstreamAddr("https://doh.test:" + port + "/dns-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := newTransport(a, clientTLS, newBootstrapResolver([]string{server}))
+
+	req := new(dns.Msg)
+	req.SetQuestion("bootstrap.test.", dns.TypeA)
+	resp, err := tr.exchange(req, testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Answer) != 1 {
+		t.Errorf("unexpected answer %v", resp.Answer)
+	}
+}
@@ -0,0 +1,432 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// updateError 动态更新被拒绝时返回给客户端的应答码与原因
+type updateError struct {
+	rcode  int
+	reason string
+}
+
+func (e *updateError) Error() string { return e.reason }
+
+func updateFail(rcode int, format string, args ...any) error {
+	return &updateError{rcode: rcode, reason: fmt.Sprintf(format, args...)}
+}
+
+// -------------------------- 请求处理 --------------------------
+// acceptMsg 在 dns.DefaultMsgAcceptFunc 的基础上接受UPDATE请求（默认实现以NOTIMP拒绝QUERY与NOTIFY以外的操作码）
+func acceptMsg(dh dns.Header) dns.MsgAcceptAction {
+	const qr = 1 << 15
+	if dh.Bits&qr == 0 && int(dh.Bits>>11)&0xF == dns.OpcodeUpdate {
+		if dh.Qdcount != 1 {
+			return dns.MsgReject
+		}
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
+}
+
+// handleUpdate 处理动态更新请求（RFC 2136）并写回应答，请求经过签名校验时应答使用同一密钥签名
+func (e *DNSEngine) handleUpdate(w dns.ResponseWriter, req *dns.Msg, client netip.Addr) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Rcode = e.processUpdate(w, req, client)
+	e.signReply(w, req, m)
+	e.writeMsg(w, req, m)
+	return m
+}
+
+// processUpdate 校验更新的区域、TSIG签名与密钥权限，然后在DNSManager中原子地检查前提条件并应用更新，返回应答码
+func (e *DNSEngine) processUpdate(w dns.ResponseWriter, req *dns.Msg, client netip.Addr) int {
+	cfg := e.conf.GetUpdate()
+	if !cfg.Enabled {
+		log.Printf("Refused dynamic update from %s: dynamic updates are disabled", client)
+		return dns.RcodeRefused
+	}
+	if len(req.Question) != 1 || req.Question[0].Qtype != dns.TypeSOA || req.Question[0].Qclass != dns.ClassINET {
+		return dns.RcodeFormatError
+	}
+	zoneName := canonicalName(req.Question[0].Name)
+
+	t := req.IsTsig()
+	if t == nil {
+		log.Printf("Refused unsigned dynamic update for zone %s from %s", zoneName, client)
+		return dns.RcodeRefused
+	}
+	if err := w.TsigStatus(); err != nil {
+		log.Printf("Rejected dynamic update for zone %s from %s: TSIG key %s: %v", zoneName, client, t.Hdr.Name, err)
+		return dns.RcodeNotAuth
+	}
+	keyName := canonicalName(t.Hdr.Name)
+	if !updateAllowed(cfg.Zones, zoneName, keyName) {
+		log.Printf("Refused dynamic update for zone %s from %s: key %s is not allowed", zoneName, client, keyName)
+		return dns.RcodeRefused
+	}
+	domainName, ok := e.managedDomain(zoneName)
+	if !ok {
+		log.Printf("Rejected dynamic update from %s: zone %s is not configured", client, zoneName)
+		return dns.RcodeNotAuth
+	}
+
+	err := e.manager.UpdateRecords(domainName, func(domain Domain) ([]Record, error) {
+		return applyUpdate(domain, req)
+	})
+	var uerr *updateError
+	switch {
+	case err == nil:
+		log.Printf("Applied dynamic update to zone %s with key %s from %s (%d prerequisites, %d updates)",
+			zoneName, keyName, client, len(req.Answer), len(req.Ns))
+		return dns.RcodeSuccess
+	case errors.Is(err, ErrSecondaryZone):
+		log.Printf("Refused dynamic update for zone %s from %s: zone is a secondary", zoneName, client)
+		return dns.RcodeRefused
+	case errors.As(err, &uerr):
+		log.Printf("Rejected dynamic update for zone %s from %s: %s", zoneName, client, uerr.reason)
+		return uerr.rcode
+	default:
+		log.Printf("Failed to apply dynamic update for zone %s: %v", zoneName, err)
+		return dns.RcodeServerFailure
+	}
+}
+
+// updateAllowed 判断密钥是否允许更新区域
+func updateAllowed(zones []conf.UpdateZone, zoneName, keyName string) bool {
+	for _, z := range zones {
+		if canonicalName(z.Name) != zoneName {
+			continue
+		}
+		for _, key := range z.Keys {
+			if canonicalName(key) == keyName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// managedDomain 按区域名称查找DNSManager中的域名（配置中的名称可能不带结尾的点或含大写）
+func (e *DNSEngine) managedDomain(zoneName string) (string, bool) {
+	for _, name := range e.manager.ListDomains() {
+		if canonicalName(name) == zoneName {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// -------------------------- 前提条件与更新 --------------------------
+// applyUpdate 依次检查前提条件（RFC 2136 3.2）、预检更新记录（3.4.1）并应用更新（3.4.2），
+// 只作用于默认视图的记录，返回更新后的记录列表；任一步骤失败时返回 updateError，不做任何修改
+func applyUpdate(domain Domain, req *dns.Msg) ([]Record, error) {
+	zoneName := canonicalName(domain.Name)
+	if err := checkPrerequisites(zoneName, zoneRRs(domain), req.Answer); err != nil {
+		return nil, err
+	}
+	if err := prescanUpdate(zoneName, req.Ns); err != nil {
+		return nil, err
+	}
+
+	records := slices.Clone(domain.Records)
+	for _, rr := range req.Ns {
+		hdr := rr.Header()
+		name := canonicalName(hdr.Name)
+		switch hdr.Class {
+		case dns.ClassINET:
+			if hdr.Rrtype == dns.TypeSOA {
+				continue // SOA由dnsm维护
+			}
+			record, err := recordFromRR(rr)
+			if err != nil {
+				return nil, updateFail(dns.RcodeFormatError, "记录 %s 无法保存: %v", name, err)
+			}
+			records = addUpdateRecord(records, rr, record)
+		case dns.ClassANY:
+			// 删除名称下的记录集（类型为ANY时删除全部），区域顶点的SOA与NS不删除
+			records = slices.DeleteFunc(records, func(r Record) bool {
+				cur, ok := defaultViewRR(r)
+				if !ok || cur.Header().Name != name {
+					return false
+				}
+				rrtype := cur.Header().Rrtype
+				if name == zoneName && (rrtype == dns.TypeSOA || rrtype == dns.TypeNS) {
+					return false
+				}
+				return hdr.Rrtype == dns.TypeANY || rrtype == hdr.Rrtype
+			})
+		case dns.ClassNONE:
+			records = deleteUpdateRecord(records, zoneName, rr)
+		}
+	}
+	return records, nil
+}
+
+// checkPrerequisites 按当前区域数据检查前提条件
+func checkPrerequisites(zoneName string, current []dns.RR, prereqs []dns.RR) error {
+	type rrsetKey struct {
+		name   string
+		rrtype uint16
+	}
+	required := make(map[rrsetKey][]dns.RR) // 值相关的前提条件：记录集必须完全一致
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		name := canonicalName(hdr.Name)
+		if hdr.Ttl != 0 {
+			return updateFail(dns.RcodeFormatError, "前提条件 %s 的TTL必须为0", name)
+		}
+		if !dns.IsSubDomain(zoneName, name) {
+			return updateFail(dns.RcodeNotZone, "前提条件 %s 不在区域 %s 内", name, zoneName)
+		}
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Rdlength != 0 {
+				return updateFail(dns.RcodeFormatError, "前提条件 %s 格式错误", name)
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if !nameInUse(current, name) {
+					return updateFail(dns.RcodeNameError, "名称 %s 不存在", name)
+				}
+			} else if !rrsetExists(current, name, hdr.Rrtype) {
+				return updateFail(dns.RcodeNXRrset, "记录集 %s %s 不存在", name, dns.TypeToString[hdr.Rrtype])
+			}
+		case dns.ClassNONE:
+			if hdr.Rdlength != 0 {
+				return updateFail(dns.RcodeFormatError, "前提条件 %s 格式错误", name)
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if nameInUse(current, name) {
+					return updateFail(dns.RcodeYXDomain, "名称 %s 已存在", name)
+				}
+			} else if rrsetExists(current, name, hdr.Rrtype) {
+				return updateFail(dns.RcodeYXRrset, "记录集 %s %s 已存在", name, dns.TypeToString[hdr.Rrtype])
+			}
+		case dns.ClassINET:
+			key := rrsetKey{name, hdr.Rrtype}
+			required[key] = append(required[key], rr)
+		default:
+			return updateFail(dns.RcodeFormatError, "前提条件 %s 的类别不合法", name)
+		}
+	}
+
+	for key, rrs := range required {
+		var existing []dns.RR
+		for _, rr := range current {
+			if rr.Header().Name == key.name && rr.Header().Rrtype == key.rrtype {
+				existing = append(existing, rr)
+			}
+		}
+		if !sameRRSet(existing, rrs) {
+			return updateFail(dns.RcodeNXRrset, "记录集 %s %s 与前提条件不一致", key.name, dns.TypeToString[key.rrtype])
+		}
+	}
+	return nil
+}
+
+// prescanUpdate 预检更新部分的记录
+func prescanUpdate(zoneName string, updates []dns.RR) error {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		name := canonicalName(hdr.Name)
+		if !dns.IsSubDomain(zoneName, name) {
+			return updateFail(dns.RcodeNotZone, "更新记录 %s 不在区域 %s 内", name, zoneName)
+		}
+		meta := hdr.Rrtype == dns.TypeAXFR || hdr.Rrtype == dns.TypeIXFR ||
+			hdr.Rrtype == dns.TypeMAILA || hdr.Rrtype == dns.TypeMAILB
+		switch hdr.Class {
+		case dns.ClassINET:
+			if meta || hdr.Rrtype == dns.TypeANY || hdr.Rrtype == dns.TypeOPT || hdr.Rrtype == dns.TypeTSIG {
+				return updateFail(dns.RcodeFormatError, "不能添加 %s 类型的记录", dns.TypeToString[hdr.Rrtype])
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || hdr.Rdlength != 0 || meta {
+				return updateFail(dns.RcodeFormatError, "删除记录集 %s 的格式错误", name)
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 || meta || hdr.Rrtype == dns.TypeANY {
+				return updateFail(dns.RcodeFormatError, "删除记录 %s 的格式错误", name)
+			}
+		default:
+			return updateFail(dns.RcodeFormatError, "更新记录 %s 的类别不合法", name)
+		}
+	}
+	return nil
+}
+
+// addUpdateRecord 添加记录：与现有记录相同时只更新TTL；CNAME替换同名CNAME，与同名其他记录冲突的添加被忽略（RFC 2136 3.4.2.2）
+func addUpdateRecord(records []Record, rr dns.RR, record Record) []Record {
+	name := canonicalName(rr.Header().Name)
+	isCNAME := rr.Header().Rrtype == dns.TypeCNAME
+	for i, r := range records {
+		cur, ok := defaultViewRR(r)
+		if !ok || cur.Header().Name != name {
+			continue
+		}
+		curCNAME := cur.Header().Rrtype == dns.TypeCNAME
+		switch {
+		case isCNAME && curCNAME:
+			records[i] = record
+			return records
+		case isCNAME != curCNAME:
+			return records
+		case dns.IsDuplicate(cur, rr):
+			records[i].TTL = record.TTL
+			return records
+		}
+	}
+	return append(records, record)
+}
+
+// deleteUpdateRecord 删除与rr相同的记录，SOA与区域顶点的最后一条NS记录不删除
+func deleteUpdateRecord(records []Record, zoneName string, rr dns.RR) []Record {
+	target := dns.Copy(rr)
+	target.Header().Class = dns.ClassINET
+	name := canonicalName(target.Header().Name)
+	rrtype := target.Header().Rrtype
+	if rrtype == dns.TypeSOA {
+		return records
+	}
+	if name == zoneName && rrtype == dns.TypeNS {
+		count := 0
+		for _, r := range records {
+			if cur, ok := defaultViewRR(r); ok && cur.Header().Name == zoneName && cur.Header().Rrtype == dns.TypeNS {
+				count++
+			}
+		}
+		if count <= 1 {
+			return records
+		}
+	}
+	for i, r := range records {
+		if cur, ok := defaultViewRR(r); ok && dns.IsDuplicate(cur, target) {
+			return slices.Delete(records, i, i+1)
+		}
+	}
+	return records
+}
+
+// -------------------------- 辅助函数 --------------------------
+// zoneRRs 返回区域默认视图下的全部资源记录，区域顶点未显式配置的NS与SOA使用自动生成的记录
+func zoneRRs(domain Domain) []dns.RR {
+	z := newZone(domain)
+	var rrs []dns.RR
+	hasNS := false
+	for _, r := range domain.Records {
+		if rr, ok := defaultViewRR(r); ok {
+			rrs = append(rrs, rr)
+			hasNS = hasNS || (rr.Header().Name == z.name && rr.Header().Rrtype == dns.TypeNS)
+		}
+	}
+	rrs = append(rrs, z.soa)
+	if !hasNS {
+		rrs = append(rrs, z.ns...)
+	}
+	return rrs
+}
+
+// defaultViewRR 将默认视图的记录转换为资源记录，其他视图或无效的记录返回false
+func defaultViewRR(r Record) (dns.RR, bool) {
+	if r.View != "" {
+		return nil, false
+	}
+	rr, err := r.RR(canonicalName(r.Name))
+	return rr, err == nil
+}
+
+func nameInUse(rrs []dns.RR, name string) bool {
+	return slices.ContainsFunc(rrs, func(rr dns.RR) bool { return rr.Header().Name == name })
+}
+
+func rrsetExists(rrs []dns.RR, name string, rrtype uint16) bool {
+	return slices.ContainsFunc(rrs, func(rr dns.RR) bool {
+		return rr.Header().Name == name && rr.Header().Rrtype == rrtype
+	})
+}
+
+// sameRRSet 判断两个记录集是否包含相同的记录（忽略TTL与顺序）
+func sameRRSet(a, b []dns.RR) bool {
+	contains := func(set []dns.RR, rr dns.RR) bool {
+		return slices.ContainsFunc(set, func(other dns.RR) bool { return dns.IsDuplicate(other, rr) })
+	}
+	for _, rr := range a {
+		if !contains(b, rr) {
+			return false
+		}
+	}
+	for _, rr := range b {
+		if !contains(a, rr) {
+			return false
+		}
+	}
+	return len(a) > 0
+}
+
+// recordFromRR 将资源记录转换为解析记录（所有者名与目标域名不带结尾的点）
+func recordFromRR(rr dns.RR) (Record, error) {
+	hdr := rr.Header()
+	r := Record{Name: relativeName(canonicalName(hdr.Name)), Type: dns.TypeToString[hdr.Rrtype], TTL: int(hdr.Ttl)}
+	switch v := rr.(type) {
+	case *dns.A:
+		r.Value = v.A.String()
+	case *dns.AAAA:
+		r.Value = v.AAAA.String()
+	case *dns.CNAME:
+		r.Value = relativeName(v.Target)
+	case *dns.NS:
+		r.Value = relativeName(v.Ns)
+	case *dns.PTR:
+		r.Value = relativeName(v.Ptr)
+	case *dns.DNAME:
+		r.Value = relativeName(v.Target)
+	case *dns.MX:
+		r.Priority, r.Value = int(v.Preference), relativeName(v.Mx)
+	case *dns.SRV:
+		r.Priority, r.Weight, r.Port, r.Value = int(v.Priority), int(v.Weight), int(v.Port), relativeName(v.Target)
+	case *dns.CAA:
+		r.Flags, r.Tag, r.Value = int(v.Flag), v.Tag, v.Value
+	case *dns.TXT:
+		r.Value = strings.Join(v.Txt, "")
+	case *dns.SPF:
+		r.Value = strings.Join(v.Txt, "")
+	case *dns.HTTPS:
+		r.Priority, r.Value, r.Params = int(v.Priority), v.Target, svcbParams(v.Value)
+	case *dns.SVCB:
+		r.Priority, r.Value, r.Params = int(v.Priority), v.Target, svcbParams(v.Value)
+	default:
+		r.Value = strings.TrimSpace(strings.TrimPrefix(rr.String(), hdr.String()))
+	}
+	if _, err := r.RR(hdr.Name); err != nil {
+		return Record{}, err
+	}
+	return r, nil
+}
+
+// svcbParams 将HTTPS/SVCB服务参数格式化为 key=value 形式
+func svcbParams(values []dns.SVCBKeyValue) string {
+	params := make([]string, 0, len(values))
+	for _, kv := range values {
+		if value := kv.String(); value != "" {
+			params = append(params, kv.Key().String()+"="+value)
+		} else {
+			params = append(params, kv.Key().String())
+		}
+	}
+	return strings.Join(params, " ")
+}
+
+// relativeName 去掉名称结尾的点（根名称除外），与配置文件中的书写方式一致
+func relativeName(name string) string {
+	if name == "." {
+		return name
+	}
+	return strings.TrimSuffix(name, ".")
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// updateTestDomain 动态更新测试使用的区域，另有一条其他视图的记录
+var updateTestDomain = Domain{
+	Name: "example.test",
+	Records: []Record{
+		{Name: "example.test", Type: "NS", Value: "ns1.example.test", TTL: 300},
+		{Name: "www.example.test", Type: "A", Value: "192.0.2.1", TTL: 300},
+		{Name: "www.example.test", Type: "A", Value: "192.0.2.2", TTL: 300},
+		{Name: "alias.example.test", Type: "CNAME", Value: "www.example.test", TTL: 300},
+		{Name: "www.example.test", Type: "A", Value: "10.0.0.1", TTL: 300, View: "internal"},
+	},
+}
+
+// updateRecords 将记录列表格式化为便于比较的字符串
+func updateRecords(records []Record) []string {
+	out := make([]string, 0, len(records))
+	for _, r := range records {
+		s := r.Name + " " + r.Type + " " + r.Value
+		if r.View != "" {
+			s += " @" + r.View
+		}
+		out = append(out, s)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestApplyUpdate(t *testing.T) {
+	unchanged := updateRecords(updateTestDomain.Records)
+	tests := []struct {
+		name  string
+		build func(m *dns.Msg)
+		rcode int      // 期望的拒绝应答码，RcodeSuccess 表示更新成功
+		want  []string // 更新成功后的记录，为nil表示与原记录一致
+	}{
+		{
+			name: "name in use",
+			build: func(m *dns.Msg) {
+				m.NameUsed(mustRRs(t, "www.example.test. 0 IN A 0.0.0.0"))
+				m.Insert(mustRRs(t, "new.example.test. 300 IN A 192.0.2.9"))
+			},
+			want: append(slices.Clone(unchanged), "new.example.test A 192.0.2.9"),
+		},
+		{
+			name:  "name not in use",
+			build: func(m *dns.Msg) { m.NameUsed(mustRRs(t, "missing.example.test. 0 IN A 0.0.0.0")) },
+			rcode: dns.RcodeNameError,
+		},
+		{
+			name:  "name exists",
+			build: func(m *dns.Msg) { m.NameNotUsed(mustRRs(t, "alias.example.test. 0 IN A 0.0.0.0")) },
+			rcode: dns.RcodeYXDomain,
+		},
+		{
+			name:  "rrset missing",
+			build: func(m *dns.Msg) { m.RRsetUsed(mustRRs(t, "www.example.test. 0 IN AAAA ::")) },
+			rcode: dns.RcodeNXRrset,
+		},
+		{
+			name:  "rrset exists",
+			build: func(m *dns.Msg) { m.RRsetNotUsed(mustRRs(t, "www.example.test. 0 IN A 0.0.0.0")) },
+			rcode: dns.RcodeYXRrset,
+		},
+		{
+			name: "apex SOA exists",
+			build: func(m *dns.Msg) {
+				m.RRsetUsed(mustRRs(t, "example.test. 0 IN SOA . . 0 0 0 0 0"))
+			},
+			want: unchanged,
+		},
+		{
+			name: "value dependent rrset matches",
+			build: func(m *dns.Msg) {
+				m.Used(mustRRs(t, "www.example.test. 0 IN A 192.0.2.2", "www.example.test. 0 IN A 192.0.2.1"))
+				m.Remove(mustRRs(t, "www.example.test. 0 IN A 192.0.2.1"))
+			},
+			want: slices.DeleteFunc(slices.Clone(unchanged), func(s string) bool { return s == "www.example.test A 192.0.2.1" }),
+		},
+		{
+			name:  "value dependent rrset differs",
+			build: func(m *dns.Msg) { m.Used(mustRRs(t, "www.example.test. 0 IN A 192.0.2.1")) },
+			rcode: dns.RcodeNXRrset,
+		},
+		{
+			name: "prerequisite with ttl",
+			build: func(m *dns.Msg) {
+				m.Answer = mustRRs(t, "www.example.test. 300 IN A 192.0.2.1", "www.example.test. 300 IN A 192.0.2.2") // Used 会将TTL置为0
+			},
+			rcode: dns.RcodeFormatError,
+		},
+		{
+			name:  "prerequisite outside zone",
+			build: func(m *dns.Msg) { m.NameUsed(mustRRs(t, "www.other.test. 0 IN A 0.0.0.0")) },
+			rcode: dns.RcodeNotZone,
+		},
+		{
+			name:  "update outside zone",
+			build: func(m *dns.Msg) { m.Insert(mustRRs(t, "www.other.test. 300 IN A 192.0.2.9")) },
+			rcode: dns.RcodeNotZone,
+		},
+		{
+			name: "failed update leaves zone untouched",
+			build: func(m *dns.Msg) {
+				m.Insert(mustRRs(t, "new.example.test. 300 IN A 192.0.2.9"))
+				m.Insert(mustRRs(t, "www.other.test. 300 IN A 192.0.2.9"))
+			},
+			rcode: dns.RcodeNotZone,
+		},
+		{
+			name: "delete rrset keeps other views",
+			build: func(m *dns.Msg) {
+				m.RemoveRRset(mustRRs(t, "www.example.test. 0 IN A 0.0.0.0"))
+			},
+			want: []string{"alias.example.test CNAME www.example.test", "example.test NS ns1.example.test", "www.example.test A 10.0.0.1 @internal"},
+		},
+		{
+			name: "delete name keeps apex NS",
+			build: func(m *dns.Msg) {
+				m.RemoveName(mustRRs(t, "example.test. 0 IN A 0.0.0.0", "alias.example.test. 0 IN A 0.0.0.0"))
+			},
+			want: slices.DeleteFunc(slices.Clone(unchanged), func(s string) bool { return s == "alias.example.test CNAME www.example.test" }),
+		},
+		{
+			name:  "last apex NS is kept",
+			build: func(m *dns.Msg) { m.Remove(mustRRs(t, "example.test. 0 IN NS ns1.example.test.")) },
+			want:  unchanged,
+		},
+		{
+			name: "CNAME conflicts are ignored",
+			build: func(m *dns.Msg) {
+				m.Insert(mustRRs(t, "www.example.test. 300 IN CNAME other.example.test.", "alias.example.test. 300 IN A 192.0.2.9"))
+			},
+			want: unchanged,
+		},
+		{
+			name:  "CNAME replaces CNAME",
+			build: func(m *dns.Msg) { m.Insert(mustRRs(t, "alias.example.test. 300 IN CNAME other.example.test.")) },
+			want: append(slices.DeleteFunc(slices.Clone(unchanged), func(s string) bool { return s == "alias.example.test CNAME www.example.test" }),
+				"alias.example.test CNAME other.example.test"),
+		},
+		{
+			name:  "duplicate add is not repeated",
+			build: func(m *dns.Msg) { m.Insert(mustRRs(t, "www.example.test. 60 IN A 192.0.2.1")) },
+			want:  unchanged,
+		},
+		{
+			name: "meta type cannot be added",
+			build: func(m *dns.Msg) {
+				m.Ns = append(m.Ns, &dns.ANY{Hdr: dns.RR_Header{Name: "www.example.test.", Rrtype: dns.TypeANY, Class: dns.ClassINET}})
+			},
+			rcode: dns.RcodeFormatError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain := updateTestDomain
+			domain.Records = slices.Clone(updateTestDomain.Records)
+			req := new(dns.Msg)
+			req.SetUpdate("example.test.")
+			tt.build(req)
+
+			records, err := applyUpdate(domain, req)
+			if tt.rcode != dns.RcodeSuccess {
+				var ue *updateError
+				if !errors.As(err, &ue) || ue.rcode != tt.rcode {
+					t.Fatalf("applyUpdate() error = %v, want rcode %s", err, dns.RcodeToString[tt.rcode])
+				}
+				if got := updateRecords(domain.Records); !slices.Equal(got, unchanged) {
+					t.Errorf("zone records were modified by a failed update: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyUpdate() error = %v", err)
+			}
+			want := slices.Clone(tt.want)
+			slices.Sort(want)
+			if got := updateRecords(records); !slices.Equal(got, want) {
+				t.Errorf("records = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package core
+
+import (
+	"cmp"
+	"crypto/tls"
+	"dnsm/internal/conf"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 上游选择策略
+const (
+	StrategySequential = "sequential"  // 按顺序依次尝试（默认）
+	StrategyParallel   = "parallel"    // 同时查询所有上游，采用最先返回的有效应答
+	StrategyRoundRobin = "round_robin" // 轮流选择起始上游，失败时依次尝试其余上游
+	StrategyFastest    = "fastest"     // 优先选择平均响应时间（EWMA）最短的上游
+)
+
+const (
+	defaultUpstreamTimeout = 3 * time.Second
+	rttEWMAWeight          = 0.3 // 新观测值在EWMA中的权重
+	fastestProbeEvery      = 16  // fastest 策略每隔多少次查询优先尝试一次尚无观测数据的上游
+)
+
+// -------------------------- 基础数据结构 --------------------------
+// UpstreamStats 上游运行状态
+type UpstreamStats struct {
+	Zone        string    `json:"zone,omitempty"` // 所属条件转发后缀（默认上游为空）
+	Address     string    `json:"address"`        // 上游地址
+	Queries     uint64    `json:"queries"`        // 查询次数
+	Failures    uint64    `json:"failures"`       // 失败次数
+	AvgRTTMs    float64   `json:"avg_rtt_ms"`     // 平均响应时间（EWMA，毫秒）
+	ConsecFails int       `json:"consec_fails"`   // 连续失败次数
+	OpenUntil   time.Time `json:"open_until"`     // 熔断截止时间（零值表示未熔断）
+}
+
+// upstreamState 上游的统计与熔断状态（配置重载时按地址保留）
+type upstreamState struct {
+	mu          sync.Mutex
+	queries     uint64
+	failures    uint64
+	rtt         time.Duration        // EWMA 平均响应时间
+	latency     prometheus.Histogram // 响应时间分布（Prometheus指标）
+	consecFails int
+	openUntil   time.Time
+}
+
+// upstream 单个上游服务器
+type upstream struct {
+	addr      string
+	timeout   time.Duration
+	state     *upstreamState
+	transport transport
+	peer      dnstapPeer // dnstap 中记录的传输协议与上游地址
+}
+
+// UpstreamGroup 一组上游服务器及其选择策略
+type UpstreamGroup struct {
+	tlsKey    string // 影响传输方式的配置（CA文件、引导DNS），相同时重载沿用已有连接
+	strategy  string
+	upstreams []*upstream
+	threshold int           // 熔断阈值（连续失败次数）
+	cooldown  time.Duration // 熔断时长
+	next      atomic.Uint32 // round_robin 轮转计数
+}
+
+// NewUpstreamGroup 根据转发配置创建上游组，previous 不为nil时沿用其中同地址上游的统计状态（以及可复用的连接）
+func NewUpstreamGroup(cfg conf.ForwardConfig, previous *UpstreamGroup) *UpstreamGroup {
+	tlsKey := cfg.CAFile + "|" + strings.Join(cfg.Bootstrap, ",")
+	prevs := make(map[string]*upstream)
+	if previous != nil {
+		for _, u := range previous.upstreams {
+			prevs[u.addr] = u
+		}
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultUpstreamTimeout
+	}
+	g := &UpstreamGroup{
+		tlsKey:    tlsKey,
+		strategy:  cfg.Strategy,
+		threshold: cfg.BreakerThreshold,
+		cooldown:  cfg.BreakerCooldown,
+	}
+	switch g.strategy {
+	case StrategySequential, StrategyParallel, StrategyRoundRobin, StrategyFastest:
+	default:
+		if g.strategy != "" {
+			log.Printf("Unknown upstream strategy %q, falling back to %s", g.strategy, StrategySequential)
+		}
+		g.strategy = StrategySequential
+	}
+
+	var tlsConfig *tls.Config
+	var bootstrap *bootstrapResolver
+	for _, uc := range cfg.Upstreams {
+		if uc.Address == "" {
+			continue
+		}
+		addr, err := parseUpstreamAddr(uc.Address)
+		if err != nil {
+			log.Printf("Skipping invalid upstream %s: %v", uc.Address, err)
+			continue
+		}
+
+		u := &upstream{addr: uc.Address, timeout: uc.Timeout, state: &upstreamState{latency: newLatencyHistogram()}, peer: upstreamPeer(addr)}
+		if u.timeout <= 0 {
+			u.timeout = timeout
+		}
+		if prev := prevs[uc.Address]; prev != nil {
+			u.state = prev.state
+			if previous.tlsKey == tlsKey {
+				u.transport = prev.transport
+			}
+		}
+		if u.transport == nil {
+			if tlsConfig == nil {
+				tlsConfig = newTLSConfig(cfg.CAFile)
+				bootstrap = newBootstrapResolver(cfg.Bootstrap)
+			}
+			u.transport = newTransport(addr, tlsConfig, bootstrap)
+		}
+		g.upstreams = append(g.upstreams, u)
+	}
+	return g
+}
+
+// -------------------------- 转发查询 --------------------------
+// Exchange 按策略向上游转发查询，返回应答及实际使用的上游地址；tap 不为nil时记录每次与上游的交互
+func (g *UpstreamGroup) Exchange(req *dns.Msg, tap *Dnstap) (*dns.Msg, string, error) {
+	candidates := g.candidates()
+	if len(candidates) == 0 {
+		return nil, "", fmt.Errorf("no upstream servers configured")
+	}
+	if g.strategy == StrategyParallel {
+		return g.race(req, candidates, tap)
+	}
+
+	// 依次尝试：SERVFAIL/REFUSED 视为软失败，继续尝试其余上游，全部失败时返回该应答
+	var fallback *dns.Msg
+	var fallbackAddr string
+	var lastErr error
+	for _, u := range candidates {
+		resp, err := g.exchangeOne(u, req, tap)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !usable(resp) {
+			if fallback == nil {
+				fallback, fallbackAddr = resp, u.addr
+			}
+			continue
+		}
+		return resp, u.addr, nil
+	}
+	if fallback != nil {
+		return fallback, fallbackAddr, nil
+	}
+	return nil, "", fmt.Errorf("failed to get a valid response from any of the configured upstream servers: %w", lastErr)
+}
+
+// race 同时向所有候选上游查询，返回最先到达的有效应答
+func (g *UpstreamGroup) race(req *dns.Msg, candidates []*upstream, tap *Dnstap) (*dns.Msg, string, error) {
+	type result struct {
+		resp *dns.Msg
+		addr string
+		err  error
+	}
+	results := make(chan result, len(candidates))
+	for _, u := range candidates {
+		go func(u *upstream) {
+			resp, err := g.exchangeOne(u, req, tap)
+			results <- result{resp: resp, addr: u.addr, err: err}
+		}(u)
+	}
+
+	var fallback *result
+	var lastErr error
+	for range candidates {
+		r := <-results
+		if r.err != nil {
+			lastErr = r.err
+			continue
+		}
+		if usable(r.resp) {
+			return r.resp, r.addr, nil
+		}
+		if fallback == nil {
+			fallback = &r
+		}
+	}
+	if fallback != nil {
+		return fallback.resp, fallback.addr, nil
+	}
+	return nil, "", fmt.Errorf("failed to get a valid response from any of the configured upstream servers: %w", lastErr)
+}
+
+// exchangeOne 通过上游对应的传输方式查询并记录统计
+func (g *UpstreamGroup) exchangeOne(u *upstream, req *dns.Msg, tap *Dnstap) (*dns.Msg, error) {
+	log.Printf("Attempting to forward query to upstream server: %s", u.addr)
+
+	start := time.Now()
+	tap.forwarderQuery(u.peer, req, start)
+	resp, err := u.transport.exchange(req, u.timeout)
+	if err == nil && resp == nil {
+		err = fmt.Errorf("upstream %s returned a nil response message", u.addr)
+	}
+	g.report(u, time.Since(start), err)
+
+	if err != nil {
+		log.Printf("Failed to exchange with upstream %s: %v", u.addr, err)
+		return nil, err
+	}
+	tap.forwarderResponse(u.peer, resp, start)
+	log.Printf("Successfully forwarded query to %s", u.addr)
+	return resp, nil
+}
+
+// -------------------------- 选择与熔断 --------------------------
+// candidates 按策略排列当前可用（未熔断）的上游；全部熔断时返回全部上游，避免完全不可用
+func (g *UpstreamGroup) candidates() []*upstream {
+	now := time.Now()
+	available := make([]*upstream, 0, len(g.upstreams))
+	for _, u := range g.upstreams {
+		u.state.mu.Lock()
+		open := now.Before(u.state.openUntil)
+		u.state.mu.Unlock()
+		if !open {
+			available = append(available, u)
+		}
+	}
+	if len(available) == 0 {
+		available = append(available, g.upstreams...)
+	}
+
+	switch g.strategy {
+	case StrategyRoundRobin:
+		if n := len(available); n > 1 {
+			start := int((g.next.Add(1) - 1) % uint32(n))
+			available = append(available[start:], available[:start]...)
+		}
+	case StrategyFastest:
+		// 按平均响应时间升序，尚无观测数据的上游（rtt为0）排在已测量的上游之后；
+		// 每 fastestProbeEvery 次查询把第一个尚无观测数据的上游提到最前，使其获得测量值
+		rtts := make(map[*upstream]time.Duration, len(available))
+		for _, u := range available {
+			u.state.mu.Lock()
+			rtts[u] = u.state.rtt
+			u.state.mu.Unlock()
+		}
+		slices.SortStableFunc(available, func(a, b *upstream) int {
+			switch ra, rb := rtts[a], rtts[b]; {
+			case ra == 0 || rb == 0:
+				return cmp.Compare(rb, ra) // 未测量的（0）排在后面
+			default:
+				return cmp.Compare(ra, rb)
+			}
+		})
+		if (g.next.Add(1)-1)%fastestProbeEvery == 0 {
+			if i := slices.IndexFunc(available, func(u *upstream) bool { return rtts[u] == 0 }); i > 0 {
+				probe := available[i]
+				copy(available[1:i+1], available[:i])
+				available[0] = probe
+			}
+		}
+	}
+	return available
+}
+
+// report 记录一次查询结果，更新EWMA响应时间与熔断状态
+func (g *UpstreamGroup) report(u *upstream, rtt time.Duration, err error) {
+	s := u.state
+	s.latency.Observe(rtt.Seconds())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queries++
+	if err != nil {
+		// 失败按不短于超时时间的响应时间计入EWMA，偶尔超时的上游在 fastest 策略中随之后移
+		s.observeRTT(max(rtt, u.timeout))
+		s.failures++
+		s.consecFails++
+		if g.threshold > 0 && s.consecFails >= g.threshold && g.cooldown > 0 {
+			s.openUntil = time.Now().Add(g.cooldown)
+			log.Printf("Upstream %s failed %d times in a row, skipping it for %s", u.addr, s.consecFails, g.cooldown)
+		}
+		return
+	}
+
+	s.consecFails = 0
+	s.openUntil = time.Time{}
+	s.observeRTT(rtt)
+}
+
+// observeRTT 将一次响应时间计入EWMA（调用方需持有锁）
+func (s *upstreamState) observeRTT(rtt time.Duration) {
+	if s.rtt == 0 {
+		s.rtt = max(rtt, 1)
+	} else {
+		s.rtt = time.Duration(rttEWMAWeight*float64(rtt) + (1-rttEWMAWeight)*float64(s.rtt))
+	}
+}
+
+// Stats 返回各上游的运行状态
+func (g *UpstreamGroup) Stats() []UpstreamStats {
+	stats := make([]UpstreamStats, 0, len(g.upstreams))
+	for _, u := range g.upstreams {
+		u.state.mu.Lock()
+		stats = append(stats, UpstreamStats{
+			Address:     u.addr,
+			Queries:     u.state.queries,
+			Failures:    u.state.failures,
+			AvgRTTMs:    float64(u.state.rtt) / float64(time.Millisecond),
+			ConsecFails: u.state.consecFails,
+			OpenUntil:   u.state.openUntil,
+		})
+		u.state.mu.Unlock()
+	}
+	return stats
+}
+
+// usable 判断应答是否可直接采用（SERVFAIL/REFUSED 需尝试其他上游）
+func usable(resp *dns.Msg) bool {
+	return resp.Rcode != dns.RcodeServerFailure && resp.Rcode != dns.RcodeRefused
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestUpstreams 创建 fastest 策略的上游组（不熔断），上游只用于排序，不实际发送查询
+func newTestUpstreams(addrs ...string) *UpstreamGroup {
+	g := &UpstreamGroup{strategy: StrategyFastest}
+	for _, addr := range addrs {
+		g.upstreams = append(g.upstreams, &upstream{
+			addr:    addr,
+			timeout: 2 * time.Second,
+			state:   &upstreamState{latency: newLatencyHistogram()},
+		})
+	}
+	return g
+}
+
+// firstCandidate 跳过 fastest 策略的探测轮次，返回常规排序下的首选上游
+func firstCandidate(g *UpstreamGroup) string {
+	if g.next.Load()%fastestProbeEvery == 0 {
+		g.next.Add(1)
+	}
+	return g.candidates()[0].addr
+}
+
+// TestFastestPenalizesFailures 失败计入EWMA后，原本最快的上游在排序中后移
+func TestFastestPenalizesFailures(t *testing.T) {
+	g := newTestUpstreams("192.0.2.1:53", "192.0.2.2:53")
+	fast, slow := g.upstreams[0], g.upstreams[1]
+	g.report(fast, 5*time.Millisecond, nil)
+	g.report(slow, 50*time.Millisecond, nil)
+	if got := firstCandidate(g); got != fast.addr {
+		t.Fatalf("first candidate = %s, want %s", got, fast.addr)
+	}
+
+	errTimeout := errors.New("i/o timeout")
+	g.report(fast, time.Millisecond, errTimeout)
+	if got := firstCandidate(g); got != slow.addr {
+		t.Errorf("first candidate after a timeout = %s, want %s", got, slow.addr)
+	}
+
+	// 恢复正常后逐渐回到最前
+	for range 20 {
+		g.report(fast, 5*time.Millisecond, nil)
+	}
+	if got := firstCandidate(g); got != fast.addr {
+		t.Errorf("first candidate after recovery = %s, want %s", got, fast.addr)
+	}
+}
+
+// TestFastestUnmeasuredUpstreams 尚无观测数据的上游排在已测量的上游之后，仅在探测轮次排在最前
+func TestFastestUnmeasuredUpstreams(t *testing.T) {
+	g := newTestUpstreams("192.0.2.1:53", "192.0.2.2:53", "192.0.2.3:53")
+	g.report(g.upstreams[1], 50*time.Millisecond, nil)
+	g.report(g.upstreams[2], 5*time.Millisecond, nil)
+
+	probes := 0
+	for range fastestProbeEvery {
+		order := g.candidates()
+		switch order[0].addr {
+		case "192.0.2.1:53":
+			probes++
+			if order[1].addr != "192.0.2.3:53" || order[2].addr != "192.0.2.2:53" {
+				t.Errorf("probe order = %s %s %s, want measured upstreams by latency after the probe", order[0].addr, order[1].addr, order[2].addr)
+			}
+		case "192.0.2.3:53":
+			if order[1].addr != "192.0.2.2:53" || order[2].addr != "192.0.2.1:53" {
+				t.Errorf("order = %s %s %s, want the unmeasured upstream last", order[0].addr, order[1].addr, order[2].addr)
+			}
+		default:
+			t.Fatalf("first candidate = %s, want the fastest measured upstream", order[0].addr)
+		}
+	}
+	if probes != 1 {
+		t.Errorf("unmeasured upstream was probed %d times in %d queries, want 1", probes, fastestProbeEvery)
+	}
+}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// -------------------------- 基础数据结构 --------------------------
+// ViewInfo 解析视图信息（用于接口展示）
+type ViewInfo struct {
+	Name    string   `json:"name"`    // 视图名称
+	Clients []string `json:"clients"` // 客户端网段
+}
+
+// view 编译后的解析视图
+type view struct {
+	name     string
+	clients  []string       // 配置中的客户端网段（原样保留用于展示）
+	prefixes []netip.Prefix // 解析后的客户端网段
+	index    *zoneIndex     // 视图记录覆盖默认视图记录后的解析索引
+}
+
+// viewTable 全部解析视图（与解析索引一起整体重建并通过原子指针发布）
+type viewTable struct {
+	views   []*view
+	domains []Domain // 构建时使用的域名快照，视图配置重载时据此重建
+}
+
+// -------------------------- 视图构建 --------------------------
+// buildViewTable 根据视图配置与域名快照构建视图表，无效的网段记录日志后跳过
+func buildViewTable(cfgs []conf.ViewConfig, domains []Domain) *viewTable {
+	t := &viewTable{domains: domains}
+	seen := make(map[string]bool, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg.Name == "" || seen[cfg.Name] {
+			log.Printf("Skipping view with empty or duplicate name %q", cfg.Name)
+			continue
+		}
+		seen[cfg.Name] = true
+
+		v := &view{name: cfg.Name, clients: cfg.Clients}
+		for _, client := range cfg.Clients {
+			prefix, err := parseClientPrefix(client)
+			if err != nil {
+				log.Printf("Skipping invalid client network %s in view %s: %v", client, cfg.Name, err)
+				continue
+			}
+			v.prefixes = append(v.prefixes, prefix)
+		}
+		v.index = buildZoneIndex(viewDomains(domains, cfg.Name))
+		t.views = append(t.views, v)
+	}
+	return t
+}
+
+// parseClientPrefix 解析客户端网段，单个IP按主机网段处理
+func parseClientPrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked(), nil
+}
+
+// viewDomains 生成视图可见的域名数据：
+//   - name 为空时（默认视图）只包含未归属视图的域名与记录
+//   - 否则包含默认视图与该视图的域名；视图记录按名称与类型覆盖默认视图记录，
+//     视图在某名称下有CNAME时该名称的默认记录全部失效，有其他类型时默认的CNAME失效
+func viewDomains(domains []Domain, name string) []Domain {
+	out := make([]Domain, 0, len(domains))
+	for _, domain := range domains {
+		if domain.View != "" && domain.View != name {
+			continue
+		}
+
+		type key struct {
+			owner  string
+			rrtype string
+		}
+		overridden := make(map[key]bool)
+		for _, r := range domain.Records {
+			if name == "" || r.View != name {
+				continue
+			}
+			owner, rrtype := canonicalName(r.Name), strings.ToUpper(r.Type)
+			overridden[key{owner, rrtype}] = true
+			if rrtype == "CNAME" {
+				overridden[key{owner, ""}] = true
+			} else {
+				overridden[key{owner, "CNAME"}] = true
+			}
+		}
+
+		records := make([]Record, 0, len(domain.Records))
+		for _, r := range domain.Records {
+			switch r.View {
+			case name:
+			case "":
+				owner := canonicalName(r.Name)
+				if overridden[key{owner, ""}] || overridden[key{owner, strings.ToUpper(r.Type)}] {
+					continue
+				}
+			default:
+				continue
+			}
+			records = append(records, r)
+		}
+		domain.Records = records
+		out = append(out, domain)
+	}
+	return out
+}
+
+// -------------------------- 视图选择 --------------------------
+// match 按客户端地址选择视图（最长前缀优先，前缀长度相同时按配置顺序），未匹配时返回nil
+func (t *viewTable) match(addr netip.Addr) *view {
+	var best *view
+	bestBits := -1
+	for _, v := range t.views {
+		for _, prefix := range v.prefixes {
+			if prefix.Bits() > bestBits && prefix.Contains(addr) {
+				best, bestBits = v, prefix.Bits()
+			}
+		}
+	}
+	return best
+}
+
+// lookup 按名称查找视图
+func (t *viewTable) lookup(name string) *view {
+	for _, v := range t.views {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// viewIndex 返回客户端所属视图的解析索引，未匹配任何视图时使用默认视图
+func (e *DNSEngine) viewIndex(w dns.ResponseWriter, req *dns.Msg) *zoneIndex {
+	table := e.views.Load()
+	if len(table.views) > 0 {
+		if addr, ok := clientAddr(w, req, e.conf.GetServer().ViewECS); ok {
+			if v := table.match(addr); v != nil {
+				return v.index
+			}
+		}
+	}
+	return e.index.Load()
+}
+
+// indexOf 返回指定视图的解析索引，名称为空时返回默认视图
+func (e *DNSEngine) indexOf(name string) (*zoneIndex, bool) {
+	if name == "" {
+		return e.index.Load(), true
+	}
+	if v := e.views.Load().lookup(name); v != nil {
+		return v.index, true
+	}
+	return nil, false
+}
+
+// clientAddr 返回用于选择视图的客户端地址：useECS 为true且请求携带EDNS Client Subnet时使用其中的地址，否则使用连接的远端地址
+func clientAddr(w dns.ResponseWriter, req *dns.Msg, useECS bool) (netip.Addr, bool) {
+	if useECS {
+		if opt := req.IsEdns0(); opt != nil {
+			for _, option := range opt.Option {
+				if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+					if addr, ok := netip.AddrFromSlice(subnet.Address); ok {
+						return addr.Unmap(), true
+					}
+				}
+			}
+		}
+	}
+
+	var ip net.IP
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		ip = addr.IP
+	case *net.TCPAddr:
+		ip = addr.IP
+	default:
+		return netip.Addr{}, false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	return addr.Unmap(), ok
+}
+
+// -------------------------- 视图管理 --------------------------
+// ReloadViews 视图配置变更后按最近一次的域名快照重建视图表
+func (e *DNSEngine) ReloadViews() {
+	e.viewMu.Lock()
+	defer e.viewMu.Unlock()
+	e.views.Store(buildViewTable(e.conf.GetViews(), e.views.Load().domains))
+}
+
+// HasView 判断视图是否存在（空名称表示默认视图，总是存在）
+func (e *DNSEngine) HasView(name string) bool {
+	_, ok := e.indexOf(name)
+	return ok
+}
+
+// Views 返回已配置的解析视图
+func (e *DNSEngine) Views() []ViewInfo {
+	table := e.views.Load()
+	views := make([]ViewInfo, 0, len(table.views))
+	for _, v := range table.views {
+		views = append(views, ViewInfo{Name: v.name, Clients: append([]string{}, v.clients...)})
+	}
+	return views
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const viewTestConfig = `domains:
+    - name: example.test
+      records:
+        - name: www.example.test
+          type: A
+          value: 192.0.2.1
+          ttl: 300
+        - name: www.example.test
+          type: A
+          value: 10.0.0.1
+          ttl: 300
+          view: internal
+        - name: www.example.test
+          type: CNAME
+          value: lab.example.test
+          ttl: 300
+          view: lab
+        - name: lab.example.test
+          type: A
+          value: 10.1.0.1
+          ttl: 300
+    - name: corp.test
+      view: internal
+      records:
+        - name: corp.test
+          type: A
+          value: 10.0.0.2
+          ttl: 300
+`
+
+// withECS 为查询附加EDNS Client Subnet
+func withECS(req *dns.Msg, subnet string) *dns.Msg {
+	req.SetEdns0(1232, false)
+	req.IsEdns0().Option = append(req.IsEdns0().Option, &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: 24,
+		Address:       net.ParseIP(subnet).To4(),
+	})
+	return req
+}
+
+// TestViews 按客户端网段（最长前缀优先）选择视图，视图记录覆盖默认记录，视图区域只对该视图可见；
+// 开启 view_ecs 时按EDNS Client Subnet中的地址选择视图
+func TestViews(t *testing.T) {
+	views := []conf.ViewConfig{
+		{Name: "internal", Clients: []string{"10.0.0.0/8"}},
+		{Name: "lab", Clients: []string{"10.1.0.0/16"}},
+	}
+	tests := []struct {
+		name      string
+		viewECS   bool
+		client    string
+		req       *dns.Msg
+		wantRcode int
+		want      []string // 应答记录的值
+	}{
+		{name: "default view", client: "192.0.2.100", req: question("www.example.test.", dns.TypeA), want: []string{"192.0.2.1"}},
+		{name: "view record overrides default", client: "10.2.0.1", req: question("www.example.test.", dns.TypeA), want: []string{"10.0.0.1"}},
+		{name: "longest prefix wins", client: "10.1.0.5", req: question("www.example.test.", dns.TypeA), want: []string{"lab.example.test.", "10.1.0.1"}},
+		{name: "view zone visible to its clients", client: "10.2.0.1", req: question("corp.test.", dns.TypeA), want: []string{"10.0.0.2"}},
+		{name: "view zone hidden from others", client: "192.0.2.100", req: question("corp.test.", dns.TypeA), wantRcode: dns.RcodeRefused},
+		{name: "ecs ignored by default", client: "127.0.0.1", req: withECS(question("www.example.test.", dns.TypeA), "10.2.0.1"), want: []string{"192.0.2.1"}},
+		{name: "ecs selects the view", viewECS: true, client: "127.0.0.1", req: withECS(question("www.example.test.", dns.TypeA), "10.2.0.1"), want: []string{"10.0.0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &conf.Config{
+				Views: views,
+				// 只允许本机递归：不由本地负责的名称对其他客户端返回REFUSED，而不是转发
+				Server: conf.DNSConfig{ViewECS: tt.viewECS, ACL: conf.ACLConfig{AllowRecursion: []string{"127.0.0.1/32"}}},
+			}
+			e := newTestEngine(t, cfg, viewTestConfig)
+			m := resolve(e, tt.client, tt.req)
+			if m == nil {
+				t.Fatal("no response")
+			}
+			if m.Rcode != tt.wantRcode {
+				t.Fatalf("rcode = %s, want %s", dns.RcodeToString[m.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+			var got []string
+			for _, rr := range m.Answer {
+				switch rr := rr.(type) {
+				case *dns.A:
+					got = append(got, rr.A.String())
+				case *dns.CNAME:
+					got = append(got, rr.Target)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("answer = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package core
+
+import (
+	"log"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// 区域默认参数（SOA字段未配置时使用）
+const (
+	defaultZoneTTL    = 3600   // 自动生成的SOA/NS记录TTL
+	defaultSOARefresh = 3600   // 从服务器刷新间隔
+	defaultSOARetry   = 600    // 刷新失败重试间隔
+	defaultSOAExpire  = 604800 // 从服务器数据过期时间
+	defaultSOAMinimum = 300    // 否定应答缓存时间
+
+	maxCNAMEChain = 8 // CNAME链最大长度
+)
+
+// -------------------------- 基础数据结构 --------------------------
+// zone 编译后的权威区域（由Domain生成）
+type zone struct {
+	name string   // 区域顶点（小写FQDN）
+	soa  *dns.SOA // 区域SOA记录
+	ns   []dns.RR // 区域顶点NS记录
+}
+
+// newZone 根据域名配置生成权威区域；SOA序列号取自域名数据（由DNSManager在区域首次加载与每次变更时设置），
+// 与其他区域的变更和索引重建无关
+func newZone(domain Domain) *zone {
+	name := canonicalName(domain.Name)
+	if name == "." {
+		return nil
+	}
+
+	nsNames := make([]string, 0, len(domain.NS))
+	for _, ns := range domain.NS {
+		if ns != "" {
+			nsNames = append(nsNames, canonicalName(ns))
+		}
+	}
+	if len(nsNames) == 0 {
+		nsNames = append(nsNames, "ns1."+name)
+	}
+
+	cfg := domain.SOA
+	soa := &dns.SOA{
+		Hdr:     dns.RR_Header{Name: name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: defaultZoneTTL},
+		Ns:      nsNames[0],
+		Mbox:    "hostmaster." + name,
+		Serial:  cfg.Serial,
+		Refresh: defaultSOARefresh,
+		Retry:   defaultSOARetry,
+		Expire:  defaultSOAExpire,
+		Minttl:  defaultSOAMinimum,
+	}
+	if cfg.MName != "" {
+		soa.Ns = canonicalName(cfg.MName)
+	}
+	if cfg.RName != "" {
+		soa.Mbox = canonicalName(cfg.RName)
+	}
+	if cfg.Refresh != 0 {
+		soa.Refresh = cfg.Refresh
+	}
+	if cfg.Retry != 0 {
+		soa.Retry = cfg.Retry
+	}
+	if cfg.Expire != 0 {
+		soa.Expire = cfg.Expire
+	}
+	if cfg.Minimum != 0 {
+		soa.Minttl = cfg.Minimum
+	}
+
+	z := &zone{name: name, soa: soa}
+	for _, ns := range nsNames {
+		z.ns = append(z.ns, &dns.NS{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: defaultZoneTTL},
+			Ns:  ns,
+		})
+	}
+	return z
+}
+
+// negativeSOA 返回否定应答（NXDOMAIN/NODATA）权威部分使用的SOA，TTL取SOA TTL与MINIMUM的较小值（RFC 2308）
+func (z *zone) negativeSOA() dns.RR {
+	soa := dns.Copy(z.soa).(*dns.SOA)
+	soa.Hdr.Ttl = min(soa.Hdr.Ttl, soa.Minttl)
+	return soa
+}
+
+// apexRRs 返回区域顶点自动生成的SOA/NS记录（所有者名使用owner）
+func (z *zone) apexRRs(qtype uint16, owner string) []dns.RR {
+	var rrs []dns.RR
+	switch qtype {
+	case dns.TypeSOA:
+		rrs = append(rrs, dns.Copy(z.soa))
+	case dns.TypeNS:
+		for _, ns := range z.ns {
+			rrs = append(rrs, dns.Copy(ns))
+		}
+	}
+	for _, rr := range rrs {
+		rr.Header().Name = owner
+	}
+	return rrs
+}
+
+// -------------------------- 权威应答 --------------------------
+// answerLocal 按权威区域语义生成本地应答，返回false表示qname不由本地负责（需要转发）
+//   - 找到记录：应答记录并设置AA位
+//   - 名称拥有CNAME：应答CNAME并继续解析目标（本地目标直接解析，外部目标转发上游）
+//   - 名称存在但无该类型记录：NODATA，权威部分携带SOA
+//   - 名称在区域内但不存在：NXDOMAIN，权威部分携带SOA
+//
+// idx 为客户端所属视图的解析索引，recursion 为false（客户端不允许递归）时不转发外部CNAME目标，只返回CNAME本身
+func (e *DNSEngine) answerLocal(idx *zoneIndex, m, req *dns.Msg, recursion bool) bool {
+	question := req.Question[0]
+	qtype := question.Qtype
+
+	owner := question.Name
+	name := canonicalName(owner)
+	if !idx.contains(name) {
+		return false
+	}
+
+	visited := make(map[string]bool, maxCNAMEChain)
+	for depth := 0; ; depth++ {
+		z := idx.findZone(name)
+		node := idx.node(name)
+		if z == nil && node == nil {
+			// CNAME目标不在本地，转发查询目标名称
+			if recursion {
+				e.chaseUpstream(m, req, owner, qtype)
+			}
+			return true
+		}
+		if depth == 0 {
+			m.Authoritative = z != nil
+		}
+
+		// 名称拥有CNAME时，除CNAME/ANY查询外均返回CNAME并解析其目标（RFC 1034 3.6.2）
+		if node != nil && qtype != dns.TypeCNAME && qtype != dns.TypeANY {
+			if cnames := node.rrsets[dns.TypeCNAME]; len(cnames) > 0 {
+				rr := dns.Copy(cnames[0].rr).(*dns.CNAME)
+				rr.Hdr.Name = owner
+				m.Answer = append(m.Answer, rr)
+
+				visited[name] = true
+				owner = rr.Target
+				name = canonicalName(owner)
+				if visited[name] || depth+1 >= maxCNAMEChain {
+					log.Printf("CNAME chain for %s is looping or longer than %d, stopping at %s", question.Name, maxCNAMEChain, owner)
+					m.Rcode = dns.RcodeServerFailure
+					return true
+				}
+				continue
+			}
+		}
+
+		answers := localRRs(z, node, name, owner, qtype)
+		switch {
+		case len(answers) > 0:
+			m.Answer = append(m.Answer, answers...)
+		case node != nil:
+			// NODATA
+			if z != nil {
+				m.Ns = append(m.Ns, z.negativeSOA())
+			}
+		default:
+			// NXDOMAIN（此时必然位于某个区域内）
+			m.Rcode = dns.RcodeNameError
+			m.Ns = append(m.Ns, z.negativeSOA())
+		}
+		return true
+	}
+}
+
+// chaseUpstream 向上游查询CNAME指向的外部目标，并将结果追加到应答中
+func (e *DNSEngine) chaseUpstream(m, req *dns.Msg, target string, qtype uint16) {
+	query := new(dns.Msg)
+	query.SetQuestion(target, qtype)
+	query.RecursionDesired = true
+	if opt := req.IsEdns0(); opt != nil {
+		query.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+
+	resp, err := e.ForwardRequest(query)
+	if err != nil || resp == nil {
+		log.Printf("Error resolving CNAME target %s: %v", target, err)
+		m.Rcode = dns.RcodeServerFailure
+		return
+	}
+	m.Answer = append(m.Answer, resp.Answer...)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+		m.Ns = append(m.Ns, resp.Ns...)
+	}
+	m.Rcode = resp.Rcode
+}
+
+// localRRs 生成名称下指定类型的应答记录（qtype为ANY时返回全部类型），
+// 区域顶点未显式配置SOA/NS时使用自动生成的记录
+func localRRs(z *zone, node *nameNode, name, owner string, qtype uint16) []dns.RR {
+	qtypes := []uint16{qtype}
+	if qtype == dns.TypeANY {
+		qtypes = qtypes[:0]
+		if node != nil {
+			for rrtype := range node.rrsets {
+				qtypes = append(qtypes, rrtype)
+			}
+		}
+		if z != nil && name == z.name {
+			qtypes = append(qtypes, dns.TypeSOA, dns.TypeNS)
+		}
+		slices.Sort(qtypes)
+		qtypes = slices.Compact(qtypes)
+	}
+
+	var rrs []dns.RR
+	for _, rrtype := range qtypes {
+		var records []localRecord
+		if node != nil {
+			records = node.rrsets[rrtype]
+		}
+		if len(records) == 0 && z != nil && name == z.name {
+			rrs = append(rrs, z.apexRRs(rrtype, owner)...)
+			continue
+		}
+		for _, record := range node.ordered(records) {
+			rr := dns.Copy(record.rr)
+			rr.Header().Name = owner
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
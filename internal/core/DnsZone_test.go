@@ -0,0 +1,214 @@
+package core
+
+import (
+	"dnsm/internal/conf"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// newTestEngine 以 domains 配置（YAML）创建引擎，cfg 为nil时使用空配置
+func newTestEngine(t *testing.T, cfg *conf.Config, domains string) *DNSEngine {
+	t.Helper()
+	if cfg == nil {
+		cfg = &conf.Config{}
+	}
+	m, _ := newTestManager(t, domains)
+	return New(cfg, m)
+}
+
+// resolve 以 client 的身份（UDP）向引擎查询，返回应答，未作应答时返回nil
+func resolve(e *DNSEngine, client string, req *dns.Msg) *dns.Msg {
+	w := newCaptureWriter(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}, &net.UDPAddr{IP: net.ParseIP(client), Port: 40000})
+	e.HandleRequest(w, req)
+	return w.msg
+}
+
+// question 构造单个问题的查询
+func question(name string, qtype uint16) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	return req
+}
+
+const authoritativeTestConfig = `domains:
+    - name: example.test
+      soa:
+        minimum: 60
+      records:
+        - name: www.example.test
+          type: A
+          value: 192.0.2.1
+          ttl: 300
+        - name: host.ent.example.test
+          type: A
+          value: 192.0.2.2
+          ttl: 300
+        - name: mail.example.test
+          type: MX
+          value: mx.example.test
+          priority: 10
+          ttl: 300
+`
+
+// TestAuthoritativeAnswers 本地区域的应答、NODATA与NXDOMAIN（权威部分携带SOA，TTL取SOA TTL与MINIMUM中较小者）
+func TestAuthoritativeAnswers(t *testing.T) {
+	e := newTestEngine(t, nil, authoritativeTestConfig)
+
+	tests := []struct {
+		name       string
+		qname      string
+		qtype      uint16
+		wantRcode  int
+		wantAnswer uint16 // 应答记录类型，0表示没有应答记录
+		wantSOA    bool   // 权威部分携带SOA
+	}{
+		{name: "answer", qname: "www.example.test.", qtype: dns.TypeA, wantRcode: dns.RcodeSuccess, wantAnswer: dns.TypeA},
+		{name: "case insensitive", qname: "WWW.Example.TEST.", qtype: dns.TypeA, wantRcode: dns.RcodeSuccess, wantAnswer: dns.TypeA},
+		{name: "mx", qname: "mail.example.test.", qtype: dns.TypeMX, wantRcode: dns.RcodeSuccess, wantAnswer: dns.TypeMX},
+		{name: "apex soa", qname: "example.test.", qtype: dns.TypeSOA, wantRcode: dns.RcodeSuccess, wantAnswer: dns.TypeSOA},
+		{name: "apex ns", qname: "example.test.", qtype: dns.TypeNS, wantRcode: dns.RcodeSuccess, wantAnswer: dns.TypeNS},
+		{name: "nodata", qname: "www.example.test.", qtype: dns.TypeAAAA, wantRcode: dns.RcodeSuccess, wantSOA: true},
+		{name: "nodata at apex", qname: "example.test.", qtype: dns.TypeA, wantRcode: dns.RcodeSuccess, wantSOA: true},
+		{name: "nodata at empty non-terminal", qname: "ent.example.test.", qtype: dns.TypeA, wantRcode: dns.RcodeSuccess, wantSOA: true},
+		{name: "nxdomain", qname: "missing.example.test.", qtype: dns.TypeA, wantRcode: dns.RcodeNameError, wantSOA: true},
+		{name: "nxdomain below existing name", qname: "a.www.example.test.", qtype: dns.TypeA, wantRcode: dns.RcodeNameError, wantSOA: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := resolve(e, "127.0.0.1", question(tt.qname, tt.qtype))
+			if m == nil {
+				t.Fatal("no response")
+			}
+			if m.Rcode != tt.wantRcode || !m.Authoritative {
+				t.Fatalf("rcode = %s, aa = %v, want %s with aa", dns.RcodeToString[m.Rcode], m.Authoritative, dns.RcodeToString[tt.wantRcode])
+			}
+			switch {
+			case tt.wantAnswer == 0 && len(m.Answer) != 0:
+				t.Errorf("answer = %v, want none", m.Answer)
+			case tt.wantAnswer != 0 && (len(m.Answer) != 1 || m.Answer[0].Header().Rrtype != tt.wantAnswer):
+				t.Errorf("answer = %v, want one %s record", m.Answer, dns.TypeToString[tt.wantAnswer])
+			case tt.wantAnswer != 0 && m.Answer[0].Header().Name != tt.qname:
+				t.Errorf("answer owner = %s, want the query name %s", m.Answer[0].Header().Name, tt.qname)
+			}
+			if !tt.wantSOA {
+				if len(m.Ns) != 0 {
+					t.Errorf("authority = %v, want none", m.Ns)
+				}
+				return
+			}
+			if len(m.Ns) != 1 {
+				t.Fatalf("authority = %v, want the zone SOA", m.Ns)
+			}
+			soa, ok := m.Ns[0].(*dns.SOA)
+			if !ok || soa.Hdr.Name != "example.test." || soa.Hdr.Ttl != 60 {
+				t.Errorf("authority = %v, want the example.test. SOA with TTL 60", m.Ns[0])
+			}
+		})
+	}
+}
+
+const cnameTestConfig = `domains:
+    - name: example.test
+      records:
+        - name: www.example.test
+          type: CNAME
+          value: web.example.test
+          ttl: 300
+        - name: web.example.test
+          type: CNAME
+          value: host.example.test
+          ttl: 300
+        - name: host.example.test
+          type: A
+          value: 192.0.2.1
+          ttl: 300
+        - name: dangling.example.test
+          type: CNAME
+          value: missing.example.test
+          ttl: 300
+        - name: cdn.example.test
+          type: CNAME
+          value: edge.upstream.test
+          ttl: 300
+        - name: loop1.example.test
+          type: CNAME
+          value: loop2.example.test
+          ttl: 300
+        - name: loop2.example.test
+          type: CNAME
+          value: loop1.example.test
+          ttl: 300
+`
+
+// TestCNAMEChasing CNAME链在本地逐级解析，外部目标转发上游（客户端不允许递归时只返回CNAME），循环返回SERVFAIL
+func TestCNAMEChasing(t *testing.T) {
+	upstream, _ := startBootstrapServer(t, map[string]string{"edge.upstream.test.": "198.51.100.10"})
+	cfg := &conf.Config{
+		Upstream: []string{upstream},
+		Server:   conf.DNSConfig{ACL: conf.ACLConfig{AllowRecursion: []string{"127.0.0.0/8"}}},
+	}
+	e := newTestEngine(t, cfg, cnameTestConfig)
+
+	tests := []struct {
+		name      string
+		client    string
+		qname     string
+		qtype     uint16
+		wantRcode int
+		want      []string // 应答记录（类型 值）
+	}{
+		{
+			name: "local chain", client: "127.0.0.1", qname: "www.example.test.", qtype: dns.TypeA, wantRcode: dns.RcodeSuccess,
+			want: []string{"CNAME web.example.test.", "CNAME host.example.test.", "A 192.0.2.1"},
+		},
+		{
+			name: "cname query is not chased", client: "127.0.0.1", qname: "www.example.test.", qtype: dns.TypeCNAME, wantRcode: dns.RcodeSuccess,
+			want: []string{"CNAME web.example.test."},
+		},
+		{
+			name: "target missing in the zone", client: "127.0.0.1", qname: "dangling.example.test.", qtype: dns.TypeA, wantRcode: dns.RcodeNameError,
+			want: []string{"CNAME missing.example.test."},
+		},
+		{
+			name: "external target forwarded", client: "127.0.0.1", qname: "cdn.example.test.", qtype: dns.TypeA, wantRcode: dns.RcodeSuccess,
+			want: []string{"CNAME edge.upstream.test.", "A 198.51.100.10"},
+		},
+		{
+			name: "external target without recursion", client: "192.0.2.100", qname: "cdn.example.test.", qtype: dns.TypeA, wantRcode: dns.RcodeSuccess,
+			want: []string{"CNAME edge.upstream.test."},
+		},
+		{
+			name: "loop", client: "127.0.0.1", qname: "loop1.example.test.", qtype: dns.TypeA, wantRcode: dns.RcodeServerFailure,
+			want: []string{"CNAME loop2.example.test.", "CNAME loop1.example.test."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := resolve(e, tt.client, question(tt.qname, tt.qtype))
+			if m == nil {
+				t.Fatal("no response")
+			}
+			if m.Rcode != tt.wantRcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[m.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+			var got []string
+			for _, rr := range m.Answer {
+				switch rr := rr.(type) {
+				case *dns.CNAME:
+					got = append(got, "CNAME "+rr.Target)
+				case *dns.A:
+					got = append(got, "A "+rr.A.String())
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("answer = %v, want %v", got, tt.want)
+			}
+			if len(m.Answer) > 0 && m.Answer[0].Header().Name != tt.qname {
+				t.Errorf("first answer owner = %s, want %s", m.Answer[0].Header().Name, tt.qname)
+			}
+		})
+	}
+}
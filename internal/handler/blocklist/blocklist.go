@@ -0,0 +1,29 @@
+package blocklist
+
+import (
+	logic "dnsm/internal/logic/blocklist"
+	"dnsm/internal/svc"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IBlocklist interface {
+	// Sources 查询拦截列表各来源的加载状态
+	Sources(c *gin.Context)
+	// Refresh 立即重新加载拦截列表
+	Refresh(c *gin.Context)
+	// Check 检查名称是否会被拦截
+	Check(c *gin.Context)
+}
+
+type Blocklist struct {
+	svcCtx    *svc.SvcContext
+	blocklist *logic.BlocklistLogic
+}
+
+func New(svcCtx *svc.SvcContext) IBlocklist {
+	return &Blocklist{
+		svcCtx:    svcCtx,
+		blocklist: logic.New(svcCtx),
+	}
+}
@@ -0,0 +1,45 @@
+package blocklist
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// Sources 查询拦截列表各来源的加载状态
+func (b *Blocklist) Sources(c *gin.Context) {
+	items := b.blocklist.Sources(c)
+	b.svcCtx.RESP.RESP_DATA(c, gin.H{
+		"items": items,
+		"total": len(items),
+	})
+}
+
+// Refresh 立即重新加载拦截列表（同步执行，远程列表较大时耗时较长），返回刷新后的来源状态
+func (b *Blocklist) Refresh(c *gin.Context) {
+	items, err := b.blocklist.Refresh(c)
+	if err != nil {
+		b.svcCtx.RESP.RESP_ERROR(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	b.svcCtx.RESP.RESP_DATA(c, gin.H{
+		"items": items,
+		"total": len(items),
+	})
+}
+
+// Check 检查名称是否会被拦截：?name=ads.example.com
+func (b *Blocklist) Check(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		b.svcCtx.RESP.RESP_PARAMS_ERROR(c, "name 参数不能为空")
+		return
+	}
+	if _, ok := dns.IsDomainName(name); !ok {
+		b.svcCtx.RESP.RESP_PARAMS_ERROR(c, "name 不是合法的域名")
+		return
+	}
+
+	b.svcCtx.RESP.RESP_DATA(c, b.blocklist.Check(c, name))
+}
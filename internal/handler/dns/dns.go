@@ -18,6 +18,8 @@ type IDNS interface {
 	CreateDomain(c *gin.Context)
 	// DeleteDomain 删除域名
 	DeleteDomain(c *gin.Context)
+	// UpdateDomainSettings 更新域名级设置
+	UpdateDomainSettings(c *gin.Context)
 	// GetRecords 获取域名下所有记录
 	GetRecords(c *gin.Context)
 	// AddRecord 添加解析记录
@@ -26,6 +28,10 @@ type IDNS interface {
 	UpdateRecord(c *gin.Context)
 	// DeleteRecord 删除解析记录
 	DeleteRecord(c *gin.Context)
+	// PTRConflicts 查询自动生成PTR的冲突列表
+	PTRConflicts(c *gin.Context)
+	// Views 查询已配置的解析视图
+	Views(c *gin.Context)
 }
 
 type DNS struct {
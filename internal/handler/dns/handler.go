@@ -2,8 +2,10 @@ package dns
 
 import (
 	"dnsm/internal/core"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -79,9 +81,21 @@ func (d *DNS) CreateDomain(c *gin.Context) {
 		return
 	}
 
+	for i := range req.Records {
+		req.Records[i].Type = strings.ToUpper(strings.TrimSpace(req.Records[i].Type))
+	}
+	if err := req.Validate(); err != nil {
+		d.svcCtx.RESP.RESP_PARAMS_ERROR(c, err.Error())
+		return
+	}
+	if err := d.dns.CheckDomainViews(c, req); err != nil {
+		d.svcCtx.RESP.RESP_PARAMS_ERROR(c, err.Error())
+		return
+	}
+
 	err := d.dns.CreateDomain(c, req)
 	if err != nil {
-		d.svcCtx.RESP.RESP_ERROR(c, http.StatusInternalServerError, err.Error())
+		d.svcCtx.RESP.RESP_ERROR(c, writeStatus(err), err.Error())
 		return
 	}
 
@@ -105,7 +119,30 @@ func (d *DNS) DeleteDomain(c *gin.Context) {
 	d.svcCtx.RESP.RESP_OK(c)
 }
 
-// GetRecords 获取域名下所有记录
+// UpdateDomainSettings 更新域名级设置（NS、SOA、多值记录应答顺序等），不影响解析记录
+func (d *DNS) UpdateDomainSettings(c *gin.Context) {
+	domainName := c.Param("domain")
+	if domainName == "" {
+		d.svcCtx.RESP.RESP_PARAMS_ERROR(c, "域名参数不能为空")
+		return
+	}
+
+	var req core.DomainSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		d.svcCtx.RESP.RESP_PARAMS_ERROR(c, "请求参数格式错误: "+err.Error())
+		return
+	}
+
+	err := d.dns.UpdateDomainSettings(c, domainName, req)
+	if err != nil {
+		d.svcCtx.RESP.RESP_ERROR(c, writeStatus(err), err.Error())
+		return
+	}
+
+	d.svcCtx.RESP.RESP_OK(c)
+}
+
+// GetRecords 获取域名下所有记录，可通过 ?view=<视图> 只查询某个视图的记录（?view= 表示默认视图）
 func (d *DNS) GetRecords(c *gin.Context) {
 	domainName := c.Param("domain")
 	if domainName == "" {
@@ -113,7 +150,7 @@ func (d *DNS) GetRecords(c *gin.Context) {
 		return
 	}
 
-	records, err := d.dns.GetRecords(c, domainName)
+	records, err := d.dns.GetRecords(c, domainName, viewParam(c))
 	if err != nil {
 		d.svcCtx.RESP.RESP_ERROR(c, http.StatusNotFound, err.Error())
 		return
@@ -147,9 +184,19 @@ func (d *DNS) AddRecord(c *gin.Context) {
 		return
 	}
 
+	req.Type = strings.ToUpper(strings.TrimSpace(req.Type))
+	if err := req.Validate(); err != nil {
+		d.svcCtx.RESP.RESP_PARAMS_ERROR(c, err.Error())
+		return
+	}
+	if err := d.dns.CheckView(c, req.View); err != nil {
+		d.svcCtx.RESP.RESP_PARAMS_ERROR(c, err.Error())
+		return
+	}
+
 	err := d.dns.AddRecord(c, domainName, req)
 	if err != nil {
-		d.svcCtx.RESP.RESP_ERROR(c, http.StatusInternalServerError, err.Error())
+		d.svcCtx.RESP.RESP_ERROR(c, writeStatus(err), err.Error())
 		return
 	}
 
@@ -171,9 +218,19 @@ func (d *DNS) UpdateRecord(c *gin.Context) {
 		return
 	}
 
-	err := d.dns.UpdateRecord(c, domainName, recordName, req)
+	req.Type = strings.ToUpper(strings.TrimSpace(req.Type))
+	if err := req.Validate(); err != nil {
+		d.svcCtx.RESP.RESP_PARAMS_ERROR(c, err.Error())
+		return
+	}
+	if err := d.dns.CheckView(c, req.View); err != nil {
+		d.svcCtx.RESP.RESP_PARAMS_ERROR(c, err.Error())
+		return
+	}
+
+	err := d.dns.UpdateRecord(c, domainName, recordSelector(c, recordName), req)
 	if err != nil {
-		d.svcCtx.RESP.RESP_ERROR(c, http.StatusInternalServerError, err.Error())
+		d.svcCtx.RESP.RESP_ERROR(c, writeStatus(err), err.Error())
 		return
 	}
 
@@ -189,11 +246,64 @@ func (d *DNS) DeleteRecord(c *gin.Context) {
 		return
 	}
 
-	err := d.dns.DeleteRecord(c, domainName, recordName)
+	err := d.dns.DeleteRecord(c, domainName, recordSelector(c, recordName))
 	if err != nil {
-		d.svcCtx.RESP.RESP_ERROR(c, http.StatusInternalServerError, err.Error())
+		d.svcCtx.RESP.RESP_ERROR(c, writeStatus(err), err.Error())
 		return
 	}
 
 	d.svcCtx.RESP.RESP_OK(c)
 }
+
+// PTRConflicts 查询自动生成PTR的冲突列表（同一IP被多个名称使用）
+func (d *DNS) PTRConflicts(c *gin.Context) {
+	conflicts := d.dns.PTRConflicts(c)
+
+	var data struct {
+		Items []core.PTRConflict `json:"items"`
+		Total int                `json:"total"`
+	}
+	data.Items = conflicts
+	data.Total = len(data.Items)
+	d.svcCtx.RESP.RESP_DATA(c, data)
+}
+
+// Views 查询已配置的解析视图
+func (d *DNS) Views(c *gin.Context) {
+	views := d.dns.Views(c)
+
+	var data struct {
+		Items []core.ViewInfo `json:"items"`
+		Total int             `json:"total"`
+	}
+	data.Items = views
+	data.Total = len(data.Items)
+	d.svcCtx.RESP.RESP_DATA(c, data)
+}
+
+// recordSelector 根据路径中的记录名和查询参数 type、value、view 构造记录选择条件
+// 同名存在多条记录时，可通过 ?type=A&value=1.2.3.4&view=office 指定具体记录
+func recordSelector(c *gin.Context, recordName string) core.RecordSelector {
+	return core.RecordSelector{
+		Name:  recordName,
+		Type:  c.Query("type"),
+		Value: c.Query("value"),
+		View:  viewParam(c),
+	}
+}
+
+// viewParam 读取查询参数 view，未携带时返回nil（不限制视图），?view= 表示默认视图
+func viewParam(c *gin.Context) *string {
+	if view, ok := c.GetQuery("view"); ok {
+		return &view
+	}
+	return nil
+}
+
+// writeStatus 修改操作失败时的HTTP状态码：从区域只读返回403，其他错误返回500
+func writeStatus(err error) int {
+	if errors.Is(err, core.ErrSecondaryZone) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,33 @@
+package forward
+
+import (
+	logic "dnsm/internal/logic/forward"
+	"dnsm/internal/svc"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IForward interface {
+	// QueryForwardZones 列出所有条件转发规则
+	QueryForwardZones(c *gin.Context)
+	// GetForwardZone 获取单条条件转发规则
+	GetForwardZone(c *gin.Context)
+	// CreateForwardZone 新增条件转发规则
+	CreateForwardZone(c *gin.Context)
+	// UpdateForwardZone 更新条件转发规则
+	UpdateForwardZone(c *gin.Context)
+	// DeleteForwardZone 删除条件转发规则
+	DeleteForwardZone(c *gin.Context)
+}
+
+type Forward struct {
+	svcCtx  *svc.SvcContext
+	forward *logic.ForwardLogic
+}
+
+func New(svcCtx *svc.SvcContext) IForward {
+	return &Forward{
+		svcCtx:  svcCtx,
+		forward: logic.New(svcCtx),
+	}
+}
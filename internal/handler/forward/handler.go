@@ -0,0 +1,99 @@
+package forward
+
+import (
+	"dnsm/internal/core"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueryForwardZones 列出所有条件转发规则
+func (f *Forward) QueryForwardZones(c *gin.Context) {
+	zones := f.forward.QueryForwardZones(c)
+	f.svcCtx.RESP.RESP_DATA(c, gin.H{
+		"items": zones,
+		"total": len(zones),
+	})
+}
+
+// GetForwardZone 获取单条条件转发规则
+func (f *Forward) GetForwardZone(c *gin.Context) {
+	name := c.Param("zone")
+	if name == "" {
+		f.svcCtx.RESP.RESP_PARAMS_ERROR(c, "转发域名参数不能为空")
+		return
+	}
+
+	zone, err := f.forward.GetForwardZone(c, name)
+	if err != nil {
+		f.svcCtx.RESP.RESP_ERROR(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	f.svcCtx.RESP.RESP_DATA(c, zone)
+}
+
+// CreateForwardZone 新增条件转发规则
+func (f *Forward) CreateForwardZone(c *gin.Context) {
+	var req core.ForwardZone
+	if err := c.ShouldBindJSON(&req); err != nil {
+		f.svcCtx.RESP.RESP_PARAMS_ERROR(c, "请求参数格式错误: "+err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		f.svcCtx.RESP.RESP_PARAMS_ERROR(c, err.Error())
+		return
+	}
+
+	if err := f.forward.CreateForwardZone(c, req); err != nil {
+		f.svcCtx.RESP.RESP_ERROR(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	f.svcCtx.RESP.RESP_OK(c)
+}
+
+// UpdateForwardZone 更新条件转发规则（请求体未指定名称时保持原名称）
+func (f *Forward) UpdateForwardZone(c *gin.Context) {
+	name := c.Param("zone")
+	if name == "" {
+		f.svcCtx.RESP.RESP_PARAMS_ERROR(c, "转发域名参数不能为空")
+		return
+	}
+
+	var req core.ForwardZone
+	if err := c.ShouldBindJSON(&req); err != nil {
+		f.svcCtx.RESP.RESP_PARAMS_ERROR(c, "请求参数格式错误: "+err.Error())
+		return
+	}
+	if req.Name == "" {
+		req.Name = name
+	}
+	if err := req.Validate(); err != nil {
+		f.svcCtx.RESP.RESP_PARAMS_ERROR(c, err.Error())
+		return
+	}
+
+	if err := f.forward.UpdateForwardZone(c, name, req); err != nil {
+		f.svcCtx.RESP.RESP_ERROR(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	f.svcCtx.RESP.RESP_OK(c)
+}
+
+// DeleteForwardZone 删除条件转发规则
+func (f *Forward) DeleteForwardZone(c *gin.Context) {
+	name := c.Param("zone")
+	if name == "" {
+		f.svcCtx.RESP.RESP_PARAMS_ERROR(c, "转发域名参数不能为空")
+		return
+	}
+
+	if err := f.forward.DeleteForwardZone(c, name); err != nil {
+		f.svcCtx.RESP.RESP_ERROR(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	f.svcCtx.RESP.RESP_OK(c)
+}
@@ -0,0 +1,106 @@
+package querylog
+
+import (
+	"dnsm/internal/core"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+// Query 按条件分页查询查询日志（按时间倒序）
+// 过滤参数：client（IP或网段）、name（名称，包含*时按通配匹配，否则按子串匹配）、type、rcode、source、
+// from/to（RFC3339时间或Unix秒）；分页参数与域名分页查询一致
+func (q *QueryLog) Query(c *gin.Context) {
+	// 获取分页参数，设置默认值
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	filter, err := queryLogFilter(c)
+	if err != nil {
+		q.svcCtx.RESP.RESP_PARAMS_ERROR(c, err.Error())
+		return
+	}
+
+	result, err := q.queryLog.Query(c, filter, page, pageSize)
+	if err != nil {
+		q.svcCtx.RESP.RESP_ERROR(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	q.svcCtx.RESP.RESP_DATA(c, result)
+}
+
+// queryLogFilter 解析并校验过滤参数
+func queryLogFilter(c *gin.Context) (core.QueryLogFilter, error) {
+	filter := core.QueryLogFilter{Name: c.Query("name")}
+
+	if client := c.Query("client"); client != "" {
+		if strings.Contains(client, "/") {
+			prefix, err := netip.ParsePrefix(client)
+			if err != nil {
+				return filter, fmt.Errorf("client 不是合法的IP或网段")
+			}
+			filter.Client = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked()
+		} else {
+			addr, err := netip.ParseAddr(client)
+			if err != nil {
+				return filter, fmt.Errorf("client 不是合法的IP或网段")
+			}
+			addr = addr.Unmap()
+			filter.Client = netip.PrefixFrom(addr, addr.BitLen())
+		}
+	}
+	if qtype := strings.ToUpper(c.Query("type")); qtype != "" {
+		if _, ok := dns.StringToType[qtype]; !ok {
+			return filter, fmt.Errorf("不支持的查询类型: %s", qtype)
+		}
+		filter.Type = qtype
+	}
+	if rcode := strings.ToUpper(c.Query("rcode")); rcode != "" {
+		if _, ok := dns.StringToRcode[rcode]; !ok {
+			return filter, fmt.Errorf("不支持的应答码: %s", rcode)
+		}
+		filter.Rcode = rcode
+	}
+	switch source := c.Query("source"); source {
+	case "", core.QuerySourceLocal, core.QuerySourceCache, core.QuerySourceUpstream,
+		core.QuerySourceBlocked, core.QuerySourceRPZ, core.QuerySourceRefused, core.QuerySourceLimited:
+		filter.Source = source
+	default:
+		return filter, fmt.Errorf("不支持的应答来源: %s", source)
+	}
+
+	var err error
+	if filter.From, err = parseTime(c.Query("from")); err != nil {
+		return filter, fmt.Errorf("from 时间格式错误: %w", err)
+	}
+	if filter.To, err = parseTime(c.Query("to")); err != nil {
+		return filter, fmt.Errorf("to 时间格式错误: %w", err)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return filter, fmt.Errorf("to 不能早于 from")
+	}
+	return filter, nil
+}
+
+// parseTime 解析RFC3339时间或Unix秒，空字符串返回零值
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,25 @@
+package querylog
+
+import (
+	logic "dnsm/internal/logic/querylog"
+	"dnsm/internal/svc"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IQueryLog interface {
+	// Query 按条件分页查询查询日志
+	Query(c *gin.Context)
+}
+
+type QueryLog struct {
+	svcCtx   *svc.SvcContext
+	queryLog *logic.QueryLogLogic
+}
+
+func New(svcCtx *svc.SvcContext) IQueryLog {
+	return &QueryLog{
+		svcCtx:   svcCtx,
+		queryLog: logic.New(svcCtx),
+	}
+}
@@ -0,0 +1,14 @@
+package secondary
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Status 查询各从区域的同步状态（序列号、最近一次传送与检查、下一次检查与过期时间）
+func (s *Secondary) Status(c *gin.Context) {
+	items := s.secondary.Status(c)
+	s.svcCtx.RESP.RESP_DATA(c, gin.H{
+		"items": items,
+		"total": len(items),
+	})
+}
@@ -0,0 +1,25 @@
+package secondary
+
+import (
+	logic "dnsm/internal/logic/secondary"
+	"dnsm/internal/svc"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ISecondary interface {
+	// Status 查询各从区域的同步状态
+	Status(c *gin.Context)
+}
+
+type Secondary struct {
+	svcCtx    *svc.SvcContext
+	secondary *logic.SecondaryLogic
+}
+
+func New(svcCtx *svc.SvcContext) ISecondary {
+	return &Secondary{
+		svcCtx:    svcCtx,
+		secondary: logic.New(svcCtx),
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import "github.com/gin-gonic/gin"
+
+// CacheStats 查询转发缓存统计
+func (s *Server) CacheStats(c *gin.Context) {
+	s.svcCtx.RESP.RESP_DATA(c, s.server.CacheStats(c))
+}
+
+// FlushCache 清空转发缓存
+func (s *Server) FlushCache(c *gin.Context) {
+	s.server.FlushCache(c)
+	s.svcCtx.RESP.RESP_OK(c)
+}
+
+// Refused 查询各客户端被拒绝的查询统计（按拒绝次数降序）
+func (s *Server) Refused(c *gin.Context) {
+	items := s.server.Refused(c)
+	s.svcCtx.RESP.RESP_DATA(c, gin.H{
+		"items": items,
+		"total": len(items),
+	})
+}
+
+// ResetRefused 清空拒绝统计
+func (s *Server) ResetRefused(c *gin.Context) {
+	s.server.ResetRefused(c)
+	s.svcCtx.RESP.RESP_OK(c)
+}
+
+// RateLimited 查询各客户端网段的限速统计（按被限速次数降序）
+func (s *Server) RateLimited(c *gin.Context) {
+	items := s.server.RateLimited(c)
+	s.svcCtx.RESP.RESP_DATA(c, gin.H{
+		"items": items,
+		"total": len(items),
+	})
+}
+
+// ResetRateLimited 清空限速统计
+func (s *Server) ResetRateLimited(c *gin.Context) {
+	s.server.ResetRateLimited(c)
+	s.svcCtx.RESP.RESP_OK(c)
+}
+
+// Upstreams 查询上游服务器运行状态
+func (s *Server) Upstreams(c *gin.Context) {
+	items := s.server.Upstreams(c)
+	s.svcCtx.RESP.RESP_DATA(c, gin.H{
+		"items": items,
+		"total": len(items),
+	})
+}
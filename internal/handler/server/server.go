@@ -0,0 +1,37 @@
+package server
+
+import (
+	logic "dnsm/internal/logic/server"
+	"dnsm/internal/svc"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IServer interface {
+	// CacheStats 查询转发缓存统计
+	CacheStats(c *gin.Context)
+	// FlushCache 清空转发缓存
+	FlushCache(c *gin.Context)
+	// Upstreams 查询上游服务器运行状态
+	Upstreams(c *gin.Context)
+	// Refused 查询各客户端被拒绝的查询统计
+	Refused(c *gin.Context)
+	// ResetRefused 清空拒绝统计
+	ResetRefused(c *gin.Context)
+	// RateLimited 查询各客户端网段的限速统计
+	RateLimited(c *gin.Context)
+	// ResetRateLimited 清空限速统计
+	ResetRateLimited(c *gin.Context)
+}
+
+type Server struct {
+	svcCtx *svc.SvcContext
+	server *logic.ServerLogic
+}
+
+func New(svcCtx *svc.SvcContext) IServer {
+	return &Server{
+		svcCtx: svcCtx,
+		server: logic.New(svcCtx),
+	}
+}
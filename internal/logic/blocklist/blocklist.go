@@ -0,0 +1,13 @@
+package blocklist
+
+import "dnsm/internal/svc"
+
+type BlocklistLogic struct {
+	svcCtx *svc.SvcContext
+}
+
+func New(svcCtx *svc.SvcContext) *BlocklistLogic {
+	return &BlocklistLogic{
+		svcCtx: svcCtx,
+	}
+}
@@ -0,0 +1,24 @@
+package blocklist
+
+import (
+	"context"
+	"dnsm/internal/core"
+)
+
+// Sources 查询拦截列表各来源的加载状态
+func (b *BlocklistLogic) Sources(ctx context.Context) []core.BlocklistSourceStatus {
+	return b.svcCtx.DNSEngine.BlocklistSources()
+}
+
+// Refresh 立即重新加载拦截列表，返回刷新后的来源状态
+func (b *BlocklistLogic) Refresh(ctx context.Context) ([]core.BlocklistSourceStatus, error) {
+	if err := b.svcCtx.DNSEngine.RefreshBlocklist(); err != nil {
+		return nil, err
+	}
+	return b.svcCtx.DNSEngine.BlocklistSources(), nil
+}
+
+// Check 检查名称是否会被拦截
+func (b *BlocklistLogic) Check(ctx context.Context, name string) core.BlockCheck {
+	return b.svcCtx.DNSEngine.CheckBlocked(name)
+}
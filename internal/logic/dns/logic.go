@@ -3,6 +3,7 @@ package dns
 import (
 	"context"
 	"dnsm/internal/core"
+	"fmt"
 )
 
 // QueryDomain 列出所有域名
@@ -31,9 +32,19 @@ func (d *DNSLogic) DeleteDomain(ctx context.Context, domainName string) error {
 	return d.svcCtx.DNSManager.DeleteDomain(domainName)
 }
 
-// GetRecords 获取域名下所有记录
-func (d *DNSLogic) GetRecords(ctx context.Context, domainName string) ([]core.Record, error) {
-	return d.svcCtx.DNSManager.GetRecords(domainName)
+// GetRecords 获取域名下所有记录，view 不为nil时只返回该视图的记录（空字符串表示默认视图）
+func (d *DNSLogic) GetRecords(ctx context.Context, domainName string, view *string) ([]core.Record, error) {
+	records, err := d.svcCtx.DNSManager.GetRecords(domainName)
+	if err != nil || view == nil {
+		return records, err
+	}
+	filtered := make([]core.Record, 0, len(records))
+	for _, r := range records {
+		if r.View == *view {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, nil
 }
 
 // AddRecord 添加解析记录
@@ -42,11 +53,47 @@ func (d *DNSLogic) AddRecord(ctx context.Context, domainName string, record core
 }
 
 // UpdateRecord 更新解析记录
-func (d *DNSLogic) UpdateRecord(ctx context.Context, domainName, recordName string, record core.Record) error {
-	return d.svcCtx.DNSManager.UpdateRecord(domainName, recordName, record)
+func (d *DNSLogic) UpdateRecord(ctx context.Context, domainName string, selector core.RecordSelector, record core.Record) error {
+	return d.svcCtx.DNSManager.UpdateRecord(domainName, selector, record)
 }
 
 // DeleteRecord 删除解析记录
-func (d *DNSLogic) DeleteRecord(ctx context.Context, domainName, recordName string) error {
-	return d.svcCtx.DNSManager.DeleteRecord(domainName, recordName)
+func (d *DNSLogic) DeleteRecord(ctx context.Context, domainName string, selector core.RecordSelector) error {
+	return d.svcCtx.DNSManager.DeleteRecord(domainName, selector)
+}
+
+// UpdateDomainSettings 更新域名级设置
+func (d *DNSLogic) UpdateDomainSettings(ctx context.Context, domainName string, settings core.DomainSettings) error {
+	return d.svcCtx.DNSManager.UpdateDomainSettings(domainName, settings)
+}
+
+// CheckView 检查视图是否已配置（空字符串表示默认视图）
+func (d *DNSLogic) CheckView(ctx context.Context, view string) error {
+	if !d.svcCtx.DNSEngine.HasView(view) {
+		return fmt.Errorf("视图 %s 不存在", view)
+	}
+	return nil
+}
+
+// CheckDomainViews 检查域名及其记录引用的视图是否均已配置
+func (d *DNSLogic) CheckDomainViews(ctx context.Context, domain core.Domain) error {
+	if err := d.CheckView(ctx, domain.View); err != nil {
+		return err
+	}
+	for _, r := range domain.Records {
+		if err := d.CheckView(ctx, r.View); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Views 查询已配置的解析视图
+func (d *DNSLogic) Views(ctx context.Context) []core.ViewInfo {
+	return d.svcCtx.DNSEngine.Views()
+}
+
+// PTRConflicts 查询自动生成PTR的冲突列表
+func (d *DNSLogic) PTRConflicts(ctx context.Context) []core.PTRConflict {
+	return d.svcCtx.DNSEngine.PTRConflicts()
 }
@@ -0,0 +1,13 @@
+package forward
+
+import "dnsm/internal/svc"
+
+type ForwardLogic struct {
+	svcCtx *svc.SvcContext
+}
+
+func New(svcCtx *svc.SvcContext) *ForwardLogic {
+	return &ForwardLogic{
+		svcCtx: svcCtx,
+	}
+}
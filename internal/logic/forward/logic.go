@@ -0,0 +1,31 @@
+package forward
+
+import (
+	"context"
+	"dnsm/internal/core"
+)
+
+// QueryForwardZones 列出所有条件转发规则
+func (f *ForwardLogic) QueryForwardZones(ctx context.Context) []core.ForwardZone {
+	return f.svcCtx.DNSManager.ListForwardZones()
+}
+
+// GetForwardZone 获取单条条件转发规则
+func (f *ForwardLogic) GetForwardZone(ctx context.Context, name string) (core.ForwardZone, error) {
+	return f.svcCtx.DNSManager.GetForwardZone(name)
+}
+
+// CreateForwardZone 新增条件转发规则
+func (f *ForwardLogic) CreateForwardZone(ctx context.Context, zone core.ForwardZone) error {
+	return f.svcCtx.DNSManager.AddForwardZone(zone)
+}
+
+// UpdateForwardZone 更新条件转发规则
+func (f *ForwardLogic) UpdateForwardZone(ctx context.Context, name string, zone core.ForwardZone) error {
+	return f.svcCtx.DNSManager.UpdateForwardZone(name, zone)
+}
+
+// DeleteForwardZone 删除条件转发规则
+func (f *ForwardLogic) DeleteForwardZone(ctx context.Context, name string) error {
+	return f.svcCtx.DNSManager.DeleteForwardZone(name)
+}
@@ -0,0 +1,11 @@
+package querylog
+
+import (
+	"context"
+	"dnsm/internal/core"
+)
+
+// Query 按条件分页查询查询日志
+func (q *QueryLogLogic) Query(ctx context.Context, filter core.QueryLogFilter, page, pageSize int) (core.QueryLogResult, error) {
+	return q.svcCtx.DNSEngine.QueryLog(filter, page, pageSize)
+}
@@ -0,0 +1,13 @@
+package querylog
+
+import "dnsm/internal/svc"
+
+type QueryLogLogic struct {
+	svcCtx *svc.SvcContext
+}
+
+func New(svcCtx *svc.SvcContext) *QueryLogLogic {
+	return &QueryLogLogic{
+		svcCtx: svcCtx,
+	}
+}
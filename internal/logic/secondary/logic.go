@@ -0,0 +1,11 @@
+package secondary
+
+import (
+	"context"
+	"dnsm/internal/core"
+)
+
+// Status 查询各从区域的同步状态
+func (s *SecondaryLogic) Status(ctx context.Context) []core.SecondaryStatus {
+	return s.svcCtx.DNSEngine.SecondaryStatus()
+}
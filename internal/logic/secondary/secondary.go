@@ -0,0 +1,13 @@
+package secondary
+
+import "dnsm/internal/svc"
+
+type SecondaryLogic struct {
+	svcCtx *svc.SvcContext
+}
+
+func New(svcCtx *svc.SvcContext) *SecondaryLogic {
+	return &SecondaryLogic{
+		svcCtx: svcCtx,
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"dnsm/internal/core"
+)
+
+// CacheStats 查询转发缓存统计
+func (s *ServerLogic) CacheStats(ctx context.Context) core.CacheStats {
+	return s.svcCtx.DNSEngine.CacheStats()
+}
+
+// FlushCache 清空转发缓存
+func (s *ServerLogic) FlushCache(ctx context.Context) {
+	s.svcCtx.DNSEngine.FlushCache()
+}
+
+// Refused 查询各客户端被拒绝的查询统计
+func (s *ServerLogic) Refused(ctx context.Context) []core.RefusedStats {
+	return s.svcCtx.DNSEngine.RefusedStats()
+}
+
+// ResetRefused 清空拒绝统计
+func (s *ServerLogic) ResetRefused(ctx context.Context) {
+	s.svcCtx.DNSEngine.ResetRefusedStats()
+}
+
+// RateLimited 查询各客户端网段的限速统计
+func (s *ServerLogic) RateLimited(ctx context.Context) []core.RateLimitStats {
+	return s.svcCtx.DNSEngine.RateLimitStats()
+}
+
+// ResetRateLimited 清空限速统计
+func (s *ServerLogic) ResetRateLimited(ctx context.Context) {
+	s.svcCtx.DNSEngine.ResetRateLimitStats()
+}
+
+// Upstreams 查询上游服务器运行状态
+func (s *ServerLogic) Upstreams(ctx context.Context) []core.UpstreamStats {
+	return s.svcCtx.DNSEngine.UpstreamStats()
+}
@@ -0,0 +1,13 @@
+package server
+
+import "dnsm/internal/svc"
+
+type ServerLogic struct {
+	svcCtx *svc.SvcContext
+}
+
+func New(svcCtx *svc.SvcContext) *ServerLogic {
+	return &ServerLogic{
+		svcCtx: svcCtx,
+	}
+}
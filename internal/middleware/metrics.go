@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"dnsm/internal/svc"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics 管理接口请求指标中间件：按方法、路由模板与状态码统计请求数与耗时
+func Metrics(ctx *svc.SvcContext) gin.HandlerFunc {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dnsm_http_requests_total",
+		Help: "Management API requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "dnsm_http_request_duration_seconds",
+		Help: "Management API request duration by method and route.",
+	}, []string{"method", "route"})
+	ctx.Metrics.MustRegister(requests, duration)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// 使用路由模板而非实际路径，避免标签随域名等路径参数无限增长
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		duration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
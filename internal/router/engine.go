@@ -48,6 +48,10 @@ func New(addr, mode string, svcCtx *svc.SvcContext) *GinEngine {
 	gin.SetMode(mode)
 	engin := gin.New()
 	engin.Use(gin.Recovery())
+	// 仅信任配置的反向代理转发的客户端地址（X-Forwarded-For/X-Real-IP），未配置时使用连接的远端地址
+	if err := engin.SetTrustedProxies(svcCtx.Conf.Gin.TrustedProxies); err != nil {
+		log.Fatalf("Invalid gin trusted_proxies: %v", err)
+	}
 
 	// 注册静态文件服务 - 使用Gin的StaticFS方法
 	consoleFS, assetsFS := Assets()
@@ -0,0 +1,73 @@
+package router
+
+import (
+	"crypto/subtle"
+	"dnsm/internal/conf"
+	"dnsm/internal/svc"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsHandler 指标接口，按配置要求基本认证或 Bearer 令牌（均未配置时不校验）；
+// 认证配置在每次请求时读取，配置文件重新加载后立即生效
+func metricsHandler(svcCtx *svc.SvcContext) http.Handler {
+	metrics := promhttp.HandlerFor(svcCtx.Metrics, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := svcCtx.Conf.GetMetrics()
+		if !metricsAuthorized(cfg, r) {
+			if cfg.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
+
+func metricsAuthorized(cfg conf.MetricsConfig, r *http.Request) bool {
+	basic := cfg.Username != "" && cfg.Password != ""
+	if !basic && cfg.BearerToken == "" {
+		return true
+	}
+	if basic {
+		if user, pass, ok := r.BasicAuth(); ok &&
+			subtle.ConstantTimeCompare([]byte(user), []byte(cfg.Username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(pass), []byte(cfg.Password)) == 1 {
+			return true
+		}
+	}
+	if cfg.BearerToken != "" {
+		const bearerPrefix = "Bearer "
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, bearerPrefix) &&
+			subtle.ConstantTimeCompare([]byte(auth[len(bearerPrefix):]), []byte(cfg.BearerToken)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeMetrics 配置了独立监听地址时，在该地址上单独提供指标接口（非阻塞）
+func ServeMetrics(svcCtx *svc.SvcContext) {
+	cfg := svcCtx.Conf.GetMetrics()
+	if !cfg.Enabled || cfg.Listen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, metricsHandler(svcCtx))
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Printf("Starting metrics server on %s%s\n", cfg.Listen, cfg.Path)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("The metrics server startup failed: %v", err)
+		}
+	}()
+}
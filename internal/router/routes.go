@@ -1,10 +1,16 @@
 package router
 
 import (
+	"dnsm/internal/handler/blocklist"
 	"dnsm/internal/handler/dns"
+	"dnsm/internal/handler/forward"
+	"dnsm/internal/handler/querylog"
+	"dnsm/internal/handler/secondary"
+	"dnsm/internal/handler/server"
 	"dnsm/internal/handler/user"
 	"dnsm/internal/middleware"
 	"net/http"
+	"net/netip"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,8 +26,24 @@ func RegisterBusinessRoutes(engine *GinEngine) {
 		})
 	})
 
+	// DNS-over-HTTPS：未配置独立端口时挂载到管理接口上（通常由反向代理提供HTTPS），
+	// 客户端地址按 gin.trusted_proxies 从转发头中解析，用于ACL、视图与限速
+	if doh := ctx.Conf.Server.DoH; doh.Enabled && doh.Port == 0 {
+		serveDoH := func(c *gin.Context) {
+			client, _ := netip.ParseAddr(c.ClientIP())
+			ctx.DNSEngine.ServeDoHFrom(c.Writer, c.Request, client)
+		}
+		engine.ginEngine.GET(doh.Path, serveDoH)
+		engine.ginEngine.POST(doh.Path, serveDoH)
+	}
+
+	// 指标：未配置独立监听地址时挂载到管理接口上
+	if m := ctx.Conf.GetMetrics(); m.Enabled && m.Listen == "" {
+		engine.ginEngine.GET(m.Path, gin.WrapH(metricsHandler(ctx)))
+	}
+
 	// 版本：/api/v1
-	v1 := engine.Group("/api/v1")
+	v1 := engine.Group("/api/v1", middleware.Metrics(ctx))
 	{
 		// 公共路由组
 		publicGroup := v1.Group("")
@@ -38,17 +60,67 @@ func RegisterBusinessRoutes(engine *GinEngine) {
 
 		{
 			// 域名相关接口
-			authGroup.GET("", dns.New(ctx).QueryDomain)                    // 列出所有域名
-			authGroup.GET("/page", dns.New(ctx).QueryDomainWithPagination) // 分页查询域名列表，包含记录数量
-			authGroup.GET("/:domain", dns.New(ctx).GetDomain)              // 获取单个域名详情
-			authGroup.POST("", dns.New(ctx).CreateDomain)                  // 创建/更新域名
-			authGroup.DELETE("/:domain", dns.New(ctx).DeleteDomain)        // 删除域名
+			authGroup.GET("", dns.New(ctx).QueryDomain)                           // 列出所有域名
+			authGroup.GET("/page", dns.New(ctx).QueryDomainWithPagination)        // 分页查询域名列表，包含记录数量
+			authGroup.GET("/:domain", dns.New(ctx).GetDomain)                     // 获取单个域名详情
+			authGroup.POST("", dns.New(ctx).CreateDomain)                         // 创建/更新域名
+			authGroup.DELETE("/:domain", dns.New(ctx).DeleteDomain)               // 删除域名
+			authGroup.PUT("/:domain/settings", dns.New(ctx).UpdateDomainSettings) // 更新域名级设置
 
 			// 记录相关接口
 			authGroup.GET("/:domain/records", dns.New(ctx).GetRecords)              // 获取域名下所有记录
 			authGroup.POST("/:domain/records", dns.New(ctx).AddRecord)              // 添加解析记录
 			authGroup.PUT("/:domain/records/:record", dns.New(ctx).UpdateRecord)    // 更新解析记录
 			authGroup.DELETE("/:domain/records/:record", dns.New(ctx).DeleteRecord) // 删除解析记录
+			authGroup.GET("/ptr-conflicts", dns.New(ctx).PTRConflicts)              // 自动生成PTR的冲突列表
+			authGroup.GET("/views", dns.New(ctx).Views)                             // 已配置的解析视图
+		}
+
+		// 条件转发规则接口（需权限校验）
+		forwardGroup := v1.Group("/forward-zones")
+		forwardGroup.Use(middleware.Auth(ctx))
+		{
+			forwardGroup.GET("", forward.New(ctx).QueryForwardZones)          // 列出所有条件转发规则
+			forwardGroup.GET("/:zone", forward.New(ctx).GetForwardZone)       // 获取单条条件转发规则
+			forwardGroup.POST("", forward.New(ctx).CreateForwardZone)         // 新增条件转发规则
+			forwardGroup.PUT("/:zone", forward.New(ctx).UpdateForwardZone)    // 更新条件转发规则
+			forwardGroup.DELETE("/:zone", forward.New(ctx).DeleteForwardZone) // 删除条件转发规则
+		}
+
+		// 拦截列表接口（需权限校验）
+		blocklistGroup := v1.Group("/blocklist")
+		blocklistGroup.Use(middleware.Auth(ctx))
+		{
+			blocklistGroup.GET("/sources", blocklist.New(ctx).Sources)  // 各来源的加载状态
+			blocklistGroup.POST("/refresh", blocklist.New(ctx).Refresh) // 立即重新加载
+			blocklistGroup.GET("/check", blocklist.New(ctx).Check)      // 检查名称是否会被拦截
+		}
+
+		// 从区域同步状态接口（需权限校验）
+		secondaryGroup := v1.Group("/secondary")
+		secondaryGroup.Use(middleware.Auth(ctx))
+		{
+			secondaryGroup.GET("", secondary.New(ctx).Status) // 各从区域的同步状态
+		}
+
+		// 查询日志接口（需权限校验）
+		queryLogGroup := v1.Group("/querylog")
+		queryLogGroup.Use(middleware.Auth(ctx))
+		{
+			queryLogGroup.GET("", querylog.New(ctx).Query) // 按条件分页查询查询日志
+		}
+
+		// 运行状态接口（需权限校验）
+		serverGroup := v1.Group("/server")
+		serverGroup.Use(middleware.Auth(ctx))
+		{
+			serverGroup.GET("/cache", server.New(ctx).CacheStats)              // 转发缓存统计
+			serverGroup.DELETE("/cache", server.New(ctx).FlushCache)           // 清空转发缓存
+			serverGroup.GET("/upstreams", server.New(ctx).Upstreams)           // 上游服务器运行状态
+			serverGroup.GET("/refused", server.New(ctx).Refused)               // 被拒绝查询的客户端统计
+			serverGroup.DELETE("/refused", server.New(ctx).ResetRefused)       // 清空拒绝统计
+			serverGroup.GET("/ratelimit", server.New(ctx).RateLimited)         // 被限速的客户端统计
+			serverGroup.DELETE("/ratelimit", server.New(ctx).ResetRateLimited) // 清空限速统计
 		}
 	}
 }
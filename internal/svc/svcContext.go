@@ -6,6 +6,8 @@ import (
 	"dnsm/internal/utils/jwt"
 	"dnsm/internal/utils/resp"
 	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type SvcContext struct {
@@ -14,6 +16,7 @@ type SvcContext struct {
 	DNSManager core.DNSManager
 	RESP       *resp.Resp
 	JWT        *jwt.JwtService
+	Metrics    *prometheus.Registry
 }
 
 func NewSvcContext() *SvcContext {
@@ -21,7 +24,6 @@ func NewSvcContext() *SvcContext {
 
 	// 加载配置
 	config, v, configPath := conf.New()
-	config.WatchConfigChanges(v)
 	s.Conf = config
 
 	// 初始化DNS管理器
@@ -30,8 +32,40 @@ func NewSvcContext() *SvcContext {
 		log.Fatalf("Failed to load DNS configuration: %v", err)
 	}
 
-	// 初始化DNS引擎
-	s.DNSEngine = core.New(config)
+	// 初始化DNS引擎（与管理器共用同一份解析数据）
+	s.DNSEngine = core.New(config, s.DNSManager)
+
+	// 指标
+	s.Metrics = prometheus.NewRegistry()
+	reloads := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dnsm_config_reloads_total",
+		Help: "Configuration file reloads by result.",
+	}, []string{"result"})
+	s.Metrics.MustRegister(s.DNSEngine, reloads,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "dnsm_zones",
+			Help: "Domains (authoritative zones) managed by dnsm.",
+		}, func() float64 { return float64(len(s.DNSManager.ListDomains())) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "dnsm_records",
+			Help: "Resource records across all managed domains.",
+		}, s.countRecords),
+	)
+
+	// 监听配置文件变化：外部修改的域名数据经管理器重新加载后同步到引擎，上游配置同步重建
+	config.WatchConfigChanges(v, func(err error) {
+		if err != nil {
+			reloads.WithLabelValues("failure").Inc()
+			return
+		}
+		if err := s.DNSManager.Load(); err != nil {
+			log.Printf("Failed to reload DNS records: %v", err)
+			reloads.WithLabelValues("failure").Inc()
+		} else {
+			reloads.WithLabelValues("success").Inc()
+		}
+		s.DNSEngine.ReloadConfig()
+	})
 
 	// 响应
 	s.RESP = resp.New()
@@ -41,3 +75,14 @@ func NewSvcContext() *SvcContext {
 
 	return s
 }
+
+// countRecords 统计DNSManager中全部域名的解析记录数量
+func (s *SvcContext) countRecords() float64 {
+	records := 0
+	for _, name := range s.DNSManager.ListDomains() {
+		if list, err := s.DNSManager.GetRecords(name); err == nil {
+			records += len(list)
+		}
+	}
+	return float64(records)
+}